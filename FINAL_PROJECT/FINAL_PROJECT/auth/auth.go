@@ -1,54 +1,209 @@
-package auth
-
-import (
-	"clinic-cli/db"
-	"clinic-cli/models"
-	"crypto/sha256"
-	"database/sql"
-	"encoding/hex"
-	"errors"
-	"fmt"
-)
-
-var CurrentUser *models.User
-
-func hashPassword(password string) string {
-	hash := sha256.New()
-	hash.Write([]byte(password))
-	return hex.EncodeToString(hash.Sum(nil))
-}
-
-func Register(username, password string) error {
-	if username == "" || password == "" {
-		return errors.New("username and password cannot be empty")
-	}
-
-	hashedPwd := hashPassword(password)
-
-	_, err := db.DB.Exec("INSERT INTO users (username, password_hash) VALUES (?, ?)", username, hashedPwd)
-	if err != nil {
-		return fmt.Errorf("could not register user (might already exist): %v", err)
-	}
-	return nil
-}
-
-func Login(username, password string) error {
-	hashedPwd := hashPassword(password)
-
-	row := db.DB.QueryRow("SELECT id, username FROM users WHERE username = ? AND password_hash = ?", username, hashedPwd)
-
-	user := &models.User{}
-	err := row.Scan(&user.ID, &user.Username)
-	if err == sql.ErrNoRows {
-		return errors.New("invalid username or password")
-	} else if err != nil {
-		return err
-	}
-
-	CurrentUser = user
-	return nil
-}
-
-func Logout() {
-	CurrentUser = nil
-}
+package auth
+
+import (
+	"clinic-cli/db"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/service"
+	"clinic-cli/models"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hash schemes recorded in users.hash_algorithm.
+const (
+	AlgoSHA256 = "sha256"
+	AlgoBcrypt = "bcrypt"
+)
+
+var CurrentUser *models.User
+
+var errInvalidCredentials = errors.New("invalid username or password")
+
+// hashPassword is the original unsalted scheme. It is only used to check
+// passwords of accounts that have not been upgraded to bcrypt yet.
+func hashPassword(password string) string {
+	hash := sha256.New()
+	hash.Write([]byte(password))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func Register(username, password string) error {
+	if username == "" || password == "" {
+		return errors.New("username and password cannot be empty")
+	}
+
+	hashedPwd, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.DB.Exec("INSERT INTO users (username, password_hash, hash_algorithm) VALUES (?, ?, ?)", username, string(hashedPwd), AlgoBcrypt)
+	if err != nil {
+		return fmt.Errorf("could not register user (might already exist): %v", err)
+	}
+	return nil
+}
+
+// Login accepts both bcrypt and legacy SHA-256 hashes. A legacy hash is
+// replaced with a bcrypt one as soon as its password has been verified.
+// After repeated failures the account has to wait before trying again.
+func Login(username, password string) error {
+	now := time.Now()
+	failures, err := loginFailures(username)
+	if err != nil {
+		return err
+	}
+	if wait := throttle.RetryAfter(failures, now); wait > 0 {
+		return lockedOut(wait)
+	}
+
+	// The attempt is counted before the password is checked, so parallel
+	// guesses cannot all slip past the check above; success resets it.
+	counted, err := recordFailure(username, now)
+	if err != nil {
+		return err
+	}
+	if wait := throttle.Admit(throttle.Counted(failures, now), counted); wait > 0 {
+		return lockedOut(wait)
+	}
+
+	user, err := checkPassword(username, password)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.DB.Exec("DELETE FROM login_failures WHERE username = ?", username); err != nil {
+		return err
+	}
+	CurrentUser = user
+	return nil
+}
+
+func lockedOut(wait time.Duration) error {
+	return fmt.Errorf("too many failed attempts, try again in %s", wait.Round(time.Second))
+}
+
+func checkPassword(username, password string) (*models.User, error) {
+	row := db.DB.QueryRow("SELECT id, username, password_hash, hash_algorithm FROM users WHERE username = ?", username)
+
+	user := &models.User{}
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.HashAlgorithm)
+	if err == sql.ErrNoRows {
+		// Unknown users cost as much as wrong passwords, so timing does not
+		// reveal which usernames exist.
+		service.ComparePassword("", password)
+		return nil, errInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	switch user.HashAlgorithm {
+	case AlgoBcrypt:
+		if !service.ComparePassword(user.PasswordHash, password) {
+			return nil, errInvalidCredentials
+		}
+	case AlgoSHA256:
+		if subtle.ConstantTimeCompare([]byte(user.PasswordHash), []byte(hashPassword(password))) != 1 {
+			return nil, errInvalidCredentials
+		}
+		// The password is already verified, so a failed upgrade must not
+		// lock the user out; it is retried on the next login.
+		if err := upgradeHash(user, password); err != nil {
+			slog.Warn("could not upgrade password hash", "user_id", user.ID, "error", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", user.HashAlgorithm)
+	}
+	return user, nil
+}
+
+// throttle is the backoff the API applies to accounts, so both front ends
+// treat failed logins alike.
+var throttle = service.DefaultAccountThrottle
+
+// failureTime is a fixed-width UTC layout, so stored times compare as text.
+const failureTime = "2006-01-02T15:04:05.000000000Z07:00"
+
+func loginFailures(username string) (*model.LoginThrottle, error) {
+	var last string
+	t := &model.LoginThrottle{Key: username}
+	err := db.DB.QueryRow("SELECT failures, last_failure_at FROM login_failures WHERE username = ?", username).Scan(&t.Failures, &last)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if t.LastFailureAt, err = time.Parse(time.RFC3339Nano, last); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// recordFailure counts an attempt in one statement and returns the new
+// count, forgetting failures older than the lockout.
+func recordFailure(username string, now time.Time) (*model.LoginThrottle, error) {
+	t := &model.LoginThrottle{Key: username, LastFailureAt: now}
+	err := db.DB.QueryRow(`INSERT INTO login_failures (username, failures, last_failure_at) VALUES (?1, 1, ?2)
+		ON CONFLICT (username) DO UPDATE SET
+			failures = CASE WHEN login_failures.last_failure_at < ?3 THEN 1 ELSE login_failures.failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures`,
+		username, now.UTC().Format(failureTime), throttle.ForgetBefore(now).UTC().Format(failureTime)).Scan(&t.Failures)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Unlock clears the failed logins of username so it can log in right away.
+func Unlock(username string) error {
+	_, err := db.DB.Exec("DELETE FROM login_failures WHERE username = ?", username)
+	return err
+}
+
+func upgradeHash(user *models.User, password string) error {
+	hashedPwd, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec("UPDATE users SET password_hash = ?, hash_algorithm = ? WHERE id = ? AND hash_algorithm = ?",
+		string(hashedPwd), AlgoBcrypt, user.ID, AlgoSHA256)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hashedPwd)
+	user.HashAlgorithm = AlgoBcrypt
+	return nil
+}
+
+// WeakHashUsers lists the users whose password is still stored with the
+// legacy SHA-256 scheme.
+func WeakHashUsers() ([]models.User, error) {
+	rows, err := db.DB.Query("SELECT id, username, hash_algorithm FROM users WHERE hash_algorithm <> ? ORDER BY id", AlgoBcrypt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.HashAlgorithm); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func Logout() {
+	CurrentUser = nil
+}
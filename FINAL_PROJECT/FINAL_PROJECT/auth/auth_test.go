@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"testing"
+
+	"clinic-cli/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogin_UpgradesLegacyHash(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db.InitDB()
+	t.Cleanup(func() { db.DB.Close() })
+	t.Cleanup(Logout)
+
+	_, err := db.DB.Exec("INSERT INTO users (username, password_hash) VALUES (?, ?)", "legacy", hashPassword("secret"))
+	require.NoError(t, err)
+	require.NoError(t, Register("modern", "secret"))
+
+	weak, err := WeakHashUsers()
+	require.NoError(t, err)
+	require.Len(t, weak, 1)
+	assert.Equal(t, "legacy", weak[0].Username)
+
+	assert.Error(t, Login("legacy", "wrong"))
+	require.NoError(t, Login("legacy", "secret"))
+	assert.Equal(t, AlgoBcrypt, CurrentUser.HashAlgorithm)
+
+	weak, err = WeakHashUsers()
+	require.NoError(t, err)
+	assert.Empty(t, weak)
+
+	// The upgraded hash keeps accepting the same password.
+	require.NoError(t, Login("legacy", "secret"))
+	assert.Error(t, Login("legacy", "wrong"))
+	require.NoError(t, Login("modern", "secret"))
+}
+
+func TestLogin_LocksOutAfterFailures(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db.InitDB()
+	t.Cleanup(func() { db.DB.Close() })
+	t.Cleanup(Logout)
+
+	require.NoError(t, Register("ann", "secret"))
+	for i := 0; i < throttle.FreeAttempts; i++ {
+		assert.Equal(t, errInvalidCredentials, Login("ann", "wrong"))
+	}
+	assert.Equal(t, errInvalidCredentials, Login("ann", "wrong"))
+	assert.ErrorContains(t, Login("ann", "secret"), "too many failed attempts")
+
+	require.NoError(t, Unlock("ann"))
+	require.NoError(t, Login("ann", "secret"))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"clinic-cli/internal/config"
+	"clinic-cli/internal/handler"
+	"clinic-cli/internal/logging"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/notify"
+	"clinic-cli/internal/service"
+	"clinic-cli/internal/worker"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	cfg := config.Load()
+
+	logger, err := logging.New(os.Stderr, logging.Config{Format: cfg.LogFormat, Level: cfg.LogLevel})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	if err := run(cfg); err != nil {
+		slog.Error("server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run serves until it is interrupted. It returns instead of exiting, so
+// the deferred cleanup, closing the database above all, always runs.
+func run(cfg *config.Config) error {
+	store, err := openStorage(cfg.DBUrl)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer store.Close()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(store, os.Args[2:]); err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.AutoMigrate {
+		if err := migrateUp(store); err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+
+	mailChan := make(chan model.Email, 100)
+
+	authService := service.NewAuthService(store.repos, mailChan, service.AuthConfig{
+		JWTSecret:       cfg.JWTSecret,
+		AccessTokenTTL:  time.Duration(cfg.AccessTokenMinutes) * time.Minute,
+		RefreshTokenTTL: time.Duration(cfg.RefreshTokenHours) * time.Hour,
+		ResetTokenTTL:   time.Duration(cfg.ResetTokenMinutes) * time.Minute,
+		VerifyTokenTTL:  time.Duration(cfg.VerifyTokenHours) * time.Hour,
+	})
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid CLINIC_TIMEZONE %q: %w", cfg.Timezone, err)
+	}
+	clinicService := service.NewClinicService(store.repos, service.ClinicConfig{
+		SlotLength: time.Duration(cfg.SlotMinutes) * time.Minute,
+		Location:   loc,
+	})
+	h := handler.NewHandler(authService, clinicService)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	notifier, err := notify.New(notify.Config{
+		Transport: cfg.Notifier,
+		SMTP: notify.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		},
+		WebhookURL: cfg.WebhookURL,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid notifier configuration: %w", err)
+	}
+	go worker.StartEmailWorker(ctx, notifier, mailChan)
+	dispatcher := worker.NewDispatcher(store.repos, notifier, loc, worker.DispatcherConfig{
+		PollInterval: time.Duration(cfg.OutboxPollSeconds) * time.Second,
+		MaxAttempts:  cfg.OutboxMaxAttempts,
+	})
+	go dispatcher.Run(ctx)
+	reminders := worker.NewReminderScheduler(store.repos, worker.ReminderConfig{
+		Offsets:      cfg.ReminderOffsets,
+		PollInterval: time.Duration(cfg.ReminderPollSeconds) * time.Second,
+	})
+	go reminders.Run(ctx)
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.AppPort,
+		Handler:           handler.NewRouter(h, cfg.JWTSecret),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("server shutdown failed", "error", err)
+		}
+	}()
+
+	slog.Info("server listening", "addr", srv.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info("server stopped")
+	return nil
+}
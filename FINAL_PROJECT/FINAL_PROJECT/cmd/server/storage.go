@@ -0,0 +1,118 @@
+package main
+
+import (
+	"clinic-cli/internal/db"
+	"clinic-cli/internal/migrate"
+	"clinic-cli/internal/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+type storage struct {
+	repos   *repository.Registry
+	sqlDB   *sql.DB
+	dialect migrate.Dialect
+	close   func()
+}
+
+func (s *storage) Close() {
+	s.close()
+}
+
+// openStorage picks the storage backend from the DATABASE_URL scheme.
+func openStorage(url string) (*storage, error) {
+	if db.IsSQLiteURL(url) {
+		conn, err := db.ConnectSQLite(url)
+		if err != nil {
+			return nil, err
+		}
+		return &storage{
+			repos:   repository.NewSQLiteRegistry(conn),
+			sqlDB:   conn,
+			dialect: migrate.SQLite,
+			close:   func() { conn.Close() },
+		}, nil
+	}
+
+	database, err := db.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB := stdlib.OpenDBFromPool(database.Pool)
+	return &storage{
+		repos:   repository.NewPostgresRegistry(database.Pool),
+		sqlDB:   sqlDB,
+		dialect: migrate.Postgres,
+		close: func() {
+			sqlDB.Close()
+			database.Close()
+		},
+	}, nil
+}
+
+func migrateUp(store *storage) error {
+	m, err := migrate.New(store.sqlDB, store.dialect)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	applied, err := m.Up(ctx)
+	for _, mig := range applied {
+		slog.Info("applied migration", "version", mig.Version, "name", mig.Name)
+	}
+	return err
+}
+
+// runMigrate implements `server migrate up|down [steps]|status`.
+func runMigrate(store *storage, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: server migrate up|down [steps]|status")
+	}
+
+	m, err := migrate.New(store.sqlDB, store.dialect)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		return migrateUp(store)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		reverted, err := m.Down(ctx, steps)
+		for _, mig := range reverted {
+			slog.Info("reverted migration", "version", mig.Version, "name", mig.Name)
+		}
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", st.Version, st.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
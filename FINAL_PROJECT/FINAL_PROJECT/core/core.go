@@ -1,90 +1,297 @@
-package core
-
-import (
-	"clinic-cli/auth"
-	"clinic-cli/db"
-	"clinic-cli/models"
-	"fmt"
-)
-
-func ListDoctors() ([]models.Doctor, error) {
-	rows, err := db.DB.Query("SELECT id, name, specialization FROM doctors")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var doctors []models.Doctor
-	for rows.Next() {
-		var doc models.Doctor
-		if err := rows.Scan(&doc.ID, &doc.Name, &doc.Specialization); err != nil {
-			return nil, err
-		}
-		doctors = append(doctors, doc)
-	}
-	return doctors, nil
-}
-
-func BookAppointment(doctorID int, dateTime string) error {
-	if auth.CurrentUser == nil {
-		return fmt.Errorf("not logged in")
-	}
-
-	var count int
-	err := db.DB.QueryRow("SELECT COUNT(*) FROM appointments WHERE doctor_id = ? AND datetime = ?", doctorID, dateTime).Scan(&count)
-	if err != nil {
-		return err
-	}
-	if count > 0 {
-		return fmt.Errorf("this slot is already booked")
-	}
-
-	_, err = db.DB.Exec("INSERT INTO appointments (user_id, doctor_id, datetime) VALUES (?, ?, ?)",
-		auth.CurrentUser.ID, doctorID, dateTime)
-	return err
-}
-
-func ListMyAppointments() ([]struct {
-	ID             int
-	DoctorName     string
-	Specialization string
-	DateTime       string
-}, error) {
-	if auth.CurrentUser == nil {
-		return nil, fmt.Errorf("not logged in")
-	}
-
-	query := `
-		SELECT a.id, d.name, d.specialization, a.datetime
-		FROM appointments a
-		JOIN doctors d ON a.doctor_id = d.id
-		WHERE a.user_id = ?
-		ORDER BY a.datetime
-	`
-	rows, err := db.DB.Query(query, auth.CurrentUser.ID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var result []struct {
-		ID             int
-		DoctorName     string
-		Specialization string
-		DateTime       string
-	}
-
-	for rows.Next() {
-		var item struct {
-			ID             int
-			DoctorName     string
-			Specialization string
-			DateTime       string
-		}
-		if err := rows.Scan(&item.ID, &item.DoctorName, &item.Specialization, &item.DateTime); err != nil {
-			return nil, err
-		}
-		result = append(result, item)
-	}
-	return result, nil
-}
+package core
+
+import (
+	"clinic-cli/auth"
+	"clinic-cli/db"
+	"clinic-cli/internal/importer"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/schedule"
+	"clinic-cli/internal/service"
+	"clinic-cli/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DateTimeLayout is the format appointments are entered and stored in,
+// interpreted in the machine's local time zone.
+const DateTimeLayout = "2006-01-02 15:04"
+
+var (
+	ErrSlotTaken  = errors.New("this slot is already booked")
+	ErrTimeInPast = errors.New("this time is in the past, pick a future slot")
+	ErrSameSlot   = errors.New("the appointment is already at this time, pick another slot")
+)
+
+// parseFutureTime parses an appointment time entered by the user and, like
+// the API, rejects times that have already passed.
+func parseFutureTime(dateTime string) (time.Time, error) {
+	at, err := time.ParseInLocation(DateTimeLayout, dateTime, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date/time, expected YYYY-MM-DD HH:MM")
+	}
+	if !at.After(time.Now()) {
+		return time.Time{}, ErrTimeInPast
+	}
+	return at, nil
+}
+
+func ListDoctors() ([]models.Doctor, error) {
+	return SearchDoctors("")
+}
+
+// SearchDoctors lists doctors by name whose name contains filter, matching
+// as GET /doctors?q= does. An empty filter lists every doctor.
+func SearchDoctors(filter string) ([]models.Doctor, error) {
+	where, order, args := repository.SQLiteDoctorSearch(model.DoctorQuery{Search: strings.TrimSpace(filter), Sort: model.SortName})
+	rows, err := db.DB.Query("SELECT id, name, specialization FROM doctors WHERE "+where+" ORDER BY "+order, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var doctors []models.Doctor
+	for rows.Next() {
+		var doc models.Doctor
+		if err := rows.Scan(&doc.ID, &doc.Name, &doc.Specialization); err != nil {
+			return nil, err
+		}
+		doctors = append(doctors, doc)
+	}
+	return doctors, nil
+}
+
+func BookAppointment(doctorID int, dateTime string) error {
+	if auth.CurrentUser == nil {
+		return fmt.Errorf("not logged in")
+	}
+
+	at, err := parseFutureTime(dateTime)
+	if err != nil {
+		return err
+	}
+
+	hours, err := WorkingHours(doctorID)
+	if err != nil {
+		return err
+	}
+	if ok, err := schedule.IsFree(hours, nil, at, schedule.DefaultSlotLength, time.Local); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("this time is outside the doctor's working hours, check the doctor's availability")
+	}
+	booked, err := bookedTimes(doctorID)
+	if err != nil {
+		return err
+	}
+	if ok, err := schedule.IsFree(hours, booked, at, schedule.DefaultSlotLength, time.Local); err != nil {
+		return err
+	} else if !ok {
+		return ErrSlotTaken
+	}
+
+	// The unique index on (doctor_id, datetime) makes the insert itself the
+	// arbiter when two clients race for the same slot.
+	res, err := db.DB.Exec("INSERT INTO appointments (user_id, doctor_id, datetime) VALUES (?, ?, ?) ON CONFLICT (doctor_id, datetime) DO NOTHING",
+		auth.CurrentUser.ID, doctorID, at.Format(DateTimeLayout))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSlotTaken
+	}
+	return nil
+}
+
+// RescheduleAppointment moves one of the current user's appointments to a
+// new free slot, with the same or another doctor, keeping its ID and
+// remembering the old time. The move is a single UPDATE, so the unique index
+// rejects it without giving up the original slot if the new one was taken.
+func RescheduleAppointment(appointmentID, doctorID int, dateTime string) error {
+	if auth.CurrentUser == nil {
+		return fmt.Errorf("not logged in")
+	}
+
+	var currentDoctor int
+	var current string
+	err := db.DB.QueryRow("SELECT doctor_id, datetime FROM appointments WHERE id = ? AND user_id = ?",
+		appointmentID, auth.CurrentUser.ID).Scan(&currentDoctor, &current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("appointment %d not found", appointmentID)
+	}
+	if err != nil {
+		return err
+	}
+	if doctorID == 0 {
+		doctorID = currentDoctor
+	}
+
+	at, err := parseFutureTime(dateTime)
+	if err != nil {
+		return err
+	}
+	if doctorID == currentDoctor && at.Format(DateTimeLayout) == current {
+		return ErrSameSlot
+	}
+
+	hours, err := WorkingHours(doctorID)
+	if err != nil {
+		return err
+	}
+	if ok, err := schedule.IsFree(hours, nil, at, schedule.DefaultSlotLength, time.Local); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("this time is outside the doctor's working hours, check the doctor's availability")
+	}
+	booked, err := bookedTimesExcept(doctorID, appointmentID)
+	if err != nil {
+		return err
+	}
+	if ok, err := schedule.IsFree(hours, booked, at, schedule.DefaultSlotLength, time.Local); err != nil {
+		return err
+	} else if !ok {
+		return ErrSlotTaken
+	}
+
+	_, err = db.DB.Exec("UPDATE appointments SET previous_datetime = datetime, doctor_id = ?, datetime = ? WHERE id = ? AND user_id = ?",
+		doctorID, at.Format(DateTimeLayout), appointmentID, auth.CurrentUser.ID)
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return ErrSlotTaken
+	}
+	return err
+}
+
+func ListMyAppointments() ([]struct {
+	ID             int
+	DoctorName     string
+	Specialization string
+	DateTime       string
+}, error) {
+	if auth.CurrentUser == nil {
+		return nil, fmt.Errorf("not logged in")
+	}
+
+	query := `
+		SELECT a.id, d.name, d.specialization, a.datetime
+		FROM appointments a
+		JOIN doctors d ON a.doctor_id = d.id
+		WHERE a.user_id = ?
+		ORDER BY a.datetime
+	`
+	rows, err := db.DB.Query(query, auth.CurrentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []struct {
+		ID             int
+		DoctorName     string
+		Specialization string
+		DateTime       string
+	}
+
+	for rows.Next() {
+		var item struct {
+			ID             int
+			DoctorName     string
+			Specialization string
+			DateTime       string
+		}
+		if err := rows.Scan(&item.ID, &item.DoctorName, &item.Specialization, &item.DateTime); err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// WorkingHours returns the doctor's weekly template, or the clinic default
+// week when none has been configured.
+func WorkingHours(doctorID int) ([]model.WorkingHours, error) {
+	rows, err := db.DB.Query("SELECT weekday, start_time, end_time FROM working_hours WHERE doctor_id = ?", doctorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hours []model.WorkingHours
+	for rows.Next() {
+		var h model.WorkingHours
+		if err := rows.Scan(&h.Weekday, &h.Start, &h.End); err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+	if len(hours) == 0 {
+		return schedule.DefaultWeek(), nil
+	}
+	return hours, nil
+}
+
+func DoctorAvailability(doctorID int, from, to time.Time) ([]model.Slot, error) {
+	hours, err := WorkingHours(doctorID)
+	if err != nil {
+		return nil, err
+	}
+	booked, err := bookedTimes(doctorID)
+	if err != nil {
+		return nil, err
+	}
+	return schedule.FreeSlots(hours, booked, from, to, schedule.DefaultSlotLength, time.Local)
+}
+
+func bookedTimes(doctorID int) ([]time.Time, error) {
+	return bookedTimesExcept(doctorID, 0)
+}
+
+func bookedTimesExcept(doctorID, appointmentID int) ([]time.Time, error) {
+	rows, err := db.DB.Query("SELECT datetime FROM appointments WHERE doctor_id = ? AND id <> ?", doctorID, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var booked []time.Time
+	for rows.Next() {
+		var dateTime string
+		if err := rows.Scan(&dateTime); err != nil {
+			return nil, err
+		}
+		// Older rows were free text; anything unparseable cannot block a slot.
+		if t, err := time.ParseInLocation(DateTimeLayout, dateTime, time.Local); err == nil {
+			booked = append(booked, t)
+		}
+	}
+	return booked, nil
+}
+
+// ImportDoctors loads doctors from a CSV or JSON file, updating those whose
+// external ID is already known. It runs the API's import against the CLI
+// database, so nothing is written if any row is invalid; the report then
+// lists the bad rows along with service.ErrImportRows.
+func ImportDoctors(path string) (*importer.Report, error) {
+	format, err := importer.FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	repos := &repository.Registry{Doctor: repository.NewSQLiteDoctorRepository(db.DB)}
+	return service.NewClinicService(repos, service.ClinicConfig{}).ImportDoctors(context.Background(), f, format)
+}
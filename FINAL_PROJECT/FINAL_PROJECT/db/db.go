@@ -1,71 +1,188 @@
-package db
-
-import (
-	"database/sql"
-	"log"
-
-	_ "modernc.org/sqlite"
-)
-
-var DB *sql.DB
-
-func InitDB() {
-	var err error
-	DB, err = sql.Open("sqlite", "./clinic.db")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	createTables()
-	seedDoctors()
-}
-
-func createTables() {
-	query := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT UNIQUE,
-		password_hash TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS doctors (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT,
-		specialization TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS appointments (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER,
-		doctor_id INTEGER,
-		datetime TEXT,
-		FOREIGN KEY(user_id) REFERENCES users(id),
-		FOREIGN KEY(doctor_id) REFERENCES doctors(id)
-	);
-	`
-	_, err := DB.Exec(query)
-	if err != nil {
-		log.Fatalf("Error creating tables: %v", err)
-	}
-}
-
-func seedDoctors() {
-	row := DB.QueryRow("SELECT COUNT(*) FROM doctors")
-	var count int
-	row.Scan(&count)
-
-	if count == 0 {
-		doctors := []struct {
-			Name           string
-			Specialization string
-		}{}
-
-		for _, d := range doctors {
-			_, err := DB.Exec("INSERT INTO doctors (name, specialization) VALUES (?, ?)", d.Name, d.Specialization)
-			if err != nil {
-				log.Printf("Error seeding doctor %s: %v", d.Name, err)
-			}
-		}
-		log.Println("Database seeded with initial doctors.")
-	}
-}
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+
+	_ "modernc.org/sqlite"
+)
+
+var DB *sql.DB
+
+func InitDB() {
+	var err error
+	DB, err = sql.Open("sqlite", "./clinic.db")
+	if err != nil {
+		fatal("error opening database", err)
+	}
+
+	createTables()
+}
+
+func createTables() {
+	query := `
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT UNIQUE,
+		password_hash TEXT,
+		hash_algorithm TEXT NOT NULL DEFAULT 'sha256'
+	);
+
+	CREATE TABLE IF NOT EXISTS doctors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT,
+		specialization TEXT,
+		external_id TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS appointments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		doctor_id INTEGER,
+		datetime TEXT,
+		previous_datetime TEXT,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(doctor_id) REFERENCES doctors(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS login_failures (
+		username TEXT PRIMARY KEY,
+		failures INTEGER NOT NULL,
+		last_failure_at TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS working_hours (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		doctor_id INTEGER,
+		weekday INTEGER,
+		start_time TEXT,
+		end_time TEXT,
+		FOREIGN KEY(doctor_id) REFERENCES doctors(id)
+	);
+	`
+	_, err := DB.Exec(query)
+	if err != nil {
+		fatal("error creating tables", err)
+	}
+
+	// Databases created before a column existed get it added in place.
+	if err := addColumnIfMissing("appointments", "previous_datetime", "TEXT"); err != nil {
+		fatal("error upgrading tables", err)
+	}
+	// Databases from before the index may hold double bookings, which
+	// would stop it from being built.
+	if err := setAsideDoubleBookings(); err != nil {
+		fatal("error upgrading tables", err)
+	}
+	if _, err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS uq_appointments_doctor_datetime ON appointments(doctor_id, datetime)"); err != nil {
+		fatal("error upgrading tables", err)
+	}
+	// Existing users all have SHA-256 hashes, which the default records.
+	if err := addColumnIfMissing("users", "hash_algorithm", "TEXT NOT NULL DEFAULT 'sha256'"); err != nil {
+		fatal("error upgrading tables", err)
+	}
+	if err := addColumnIfMissing("doctors", "external_id", "TEXT"); err != nil {
+		fatal("error upgrading tables", err)
+	}
+	if _, err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS uq_doctors_external_id ON doctors(external_id)"); err != nil {
+		fatal("error upgrading tables", err)
+	}
+}
+
+// fatal logs err and exits; the CLI cannot run without its tables.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// laterDuplicate matches the appointments a of a doctor and time that was
+// booked earlier by another row.
+const laterDuplicate = `EXISTS (SELECT 1 FROM appointments b
+	WHERE b.doctor_id = a.doctor_id AND b.datetime = a.datetime AND b.id < a.id)`
+
+// setAsideDoubleBookings keeps the first appointment booked for each doctor
+// and time and moves the later ones to appointment_conflicts, logging each
+// so the patients can be offered another slot. Nothing is deleted.
+func setAsideDoubleBookings() error {
+	rows, err := DB.Query("SELECT a.id, a.user_id, a.doctor_id, a.datetime FROM appointments a WHERE " + laterDuplicate)
+	if err != nil {
+		return err
+	}
+	type booking struct {
+		id, doctorID int
+		userID       sql.NullInt64
+		datetime     string
+	}
+	var duplicates []booking
+	for rows.Next() {
+		var b booking
+		if err := rows.Scan(&b.id, &b.userID, &b.doctorID, &b.datetime); err != nil {
+			rows.Close()
+			return err
+		}
+		duplicates = append(duplicates, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(duplicates) == 0 {
+		return err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS appointment_conflicts (
+		id INTEGER PRIMARY KEY,
+		user_id INTEGER,
+		doctor_id INTEGER,
+		datetime TEXT,
+		previous_datetime TEXT,
+		set_aside_at TEXT NOT NULL
+	)`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO appointment_conflicts (id, user_id, doctor_id, datetime, previous_datetime, set_aside_at)
+		SELECT a.id, a.user_id, a.doctor_id, a.datetime, a.previous_datetime, datetime('now')
+		FROM appointments a WHERE ` + laterDuplicate); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM appointments AS a WHERE " + laterDuplicate); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, b := range duplicates {
+		slog.Warn("double booking moved to appointment_conflicts",
+			"appointment_id", b.id, "user_id", b.userID.Int64, "doctor_id", b.doctorID, "datetime", b.datetime)
+	}
+	return nil
+}
+
+func addColumnIfMissing(table, column, definition string) error {
+	rows, err := DB.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
@@ -0,0 +1,37 @@
+// Package apperr classifies errors by what went wrong from the caller's point
+// of view, so that the HTTP layer can pick a status without knowing every
+// sentinel error of every package.
+package apperr
+
+import "errors"
+
+// The kinds of error. A sentinel declares its kind with New, and callers test
+// for a kind with errors.Is. Errors of no kind are internal failures.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrForbidden    = errors.New("forbidden")
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrValidation is well-formed input that breaks a rule of the domain,
+	// such as a booking outside working hours. Malformed input is reported
+	// field by field with a *validation.Error instead.
+	ErrValidation = errors.New("validation failed")
+)
+
+// New returns a sentinel error of the given kind.
+func New(kind error, message string) error {
+	return &kindError{kind: kind, message: message}
+}
+
+type kindError struct {
+	kind    error
+	message string
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// IsSQLiteURL reports whether a DATABASE_URL points at a SQLite file
+// rather than a Postgres server.
+func IsSQLiteURL(url string) bool {
+	return strings.HasPrefix(url, "sqlite://")
+}
+
+// ConnectSQLite opens the SQLite database referenced by a sqlite:// URL
+// (e.g. sqlite://clinic_api.db or sqlite://:memory:). The schema is created
+// by the migrations in internal/migrate.
+func ConnectSQLite(url string) (*sql.DB, error) {
+	path := strings.TrimPrefix(url, "sqlite://")
+	if path == "" {
+		return nil, fmt.Errorf("sqlite url %q has no path", url)
+	}
+
+	conn, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("unable to open sqlite database: %w", err)
+	}
+	// SQLite allows a single writer; one connection also keeps :memory:
+	// databases shared across all queries.
+	conn.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to open sqlite database: %w", err)
+	}
+
+	slog.Info("connected to database", "driver", "sqlite", "path", path)
+	return conn, nil
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"clinic-cli/internal/ical"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/service"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// calendar presents appointments for a patient, titled by doctor, or for a
+// doctor, titled by patient.
+func (h *Handler) calendar(name string, forDoctor bool) ical.Calendar {
+	return ical.Calendar{
+		Name:       name,
+		Location:   h.ClinicService.Location(),
+		SlotLength: h.ClinicService.SlotLength(),
+		Summary: func(app model.Appointment) string {
+			if forDoctor {
+				return "Appointment with " + app.PatientEmail
+			}
+			if app.DoctorName == "" {
+				return fmt.Sprintf("Appointment with doctor #%d", app.DoctorID)
+			}
+			return "Appointment with " + app.DoctorName
+		},
+	}
+}
+
+func writeCalendar(w http.ResponseWriter, cal ical.Calendar, apps []model.Appointment, filename string) {
+	w.Header().Set("Content-Type", ical.ContentType)
+	if filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+	w.WriteHeader(http.StatusOK)
+	cal.Write(w, apps, time.Now())
+}
+
+// AppointmentICS downloads one appointment as an .ics file.
+func (h *Handler) AppointmentICS(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	actor := actorFromRequest(r)
+	app, err := h.ClinicService.Appointment(r.Context(), actor, id)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	cal := h.calendar("", actor.Role == model.RoleDoctor)
+	writeCalendar(w, cal, []model.Appointment{*app}, fmt.Sprintf("appointment-%d.ics", app.ID))
+}
+
+// RotateCalendarFeed returns a new subscription path for the caller's
+// appointments. The previous path stops working.
+func (h *Handler) RotateCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	path, err := h.ClinicService.RotateCalendarFeed(r.Context(), actorFromRequest(r))
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, map[string]string{"path": path})
+}
+
+// CalendarFeed serves a subscribable feed. The secret in the path is the
+// only credential, since calendar apps cannot send bearer tokens.
+func (h *Handler) CalendarFeed(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apps, err := h.ClinicService.CalendarFeed(r.Context(), kind, chi.URLParam(r, "token"))
+		if err != nil {
+			fail(w, r, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		writeCalendar(w, h.calendar("Clinic appointments", kind == service.FeedDoctor), apps, "")
+	}
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"clinic-cli/internal/apperr"
+	"clinic-cli/internal/middleware"
+	"clinic-cli/internal/problem"
+	"clinic-cli/internal/validation"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// errNotDoctor rejects doctor-only views for accounts without a doctor.
+var errNotDoctor = apperr.New(apperr.ErrForbidden, "account is not linked to a doctor")
+
+// fail answers with the problem err describes. It is the one place where
+// errors become statuses: validation errors are 400 with the offending
+// fields, and other errors are mapped by their apperr kind. Errors of no
+// kind are logged and answered with a bare 500, so that database messages
+// and other internals never reach the client.
+func fail(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Write(w, r, problemFor(r, err))
+}
+
+func problemFor(r *http.Request, err error) *problem.Details {
+	// Checked first: a body cut off by its size limit also fails to parse.
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return problem.New(http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+	}
+	if invalid, ok := validation.As(err); ok {
+		return problem.Invalid(invalid)
+	}
+
+	switch {
+	case errors.Is(err, apperr.ErrNotFound):
+		return problem.New(http.StatusNotFound, err.Error())
+	case errors.Is(err, apperr.ErrConflict):
+		return problem.New(http.StatusConflict, err.Error())
+	case errors.Is(err, apperr.ErrForbidden):
+		return problem.New(http.StatusForbidden, err.Error())
+	case errors.Is(err, apperr.ErrUnauthorized):
+		return problem.New(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, apperr.ErrValidation):
+		return problem.New(http.StatusUnprocessableEntity, err.Error())
+	}
+	slog.ErrorContext(r.Context(), "request failed", "method", r.Method, "route", middleware.Route(r), "error", err)
+	return problem.New(http.StatusInternalServerError, "The server could not complete the request")
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"clinic-cli/internal/problem"
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/service"
+	"clinic-cli/internal/validation"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFail(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		detail string
+	}{
+		{"not found", service.ErrDoctorNotFound, http.StatusNotFound, "doctor not found"},
+		{"wrapped conflict", fmt.Errorf("%w: scheduled -> completed", service.ErrInvalidTransition), http.StatusConflict, "illegal status transition: scheduled -> completed"},
+		{"repository conflict", repository.ErrEmailTaken, http.StatusConflict, "email address already registered"},
+		{"forbidden", errNotDoctor, http.StatusForbidden, "account is not linked to a doctor"},
+		{"unauthorized", service.ErrInvalidCredentials, http.StatusUnauthorized, "invalid credentials"},
+		{"domain rule", service.ErrSlotUnavailable, http.StatusUnprocessableEntity, "requested time is outside the doctor's working hours"},
+		{"validation", validation.Body("time", service.ErrTimeInPast), http.StatusBadRequest, "Invalid request"},
+		{"too large", &http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge, "Request body exceeds 10 bytes"},
+		{"internals stay hidden", errors.New(`pq: relation "users" does not exist`), http.StatusInternalServerError, "The server could not complete the request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			fail(rec, httptest.NewRequest(http.MethodGet, "/api/v1/things/1", nil), tt.err)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+			var got problem.Details
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, tt.status, got.Status)
+			assert.Equal(t, http.StatusText(tt.status), got.Title)
+			assert.Equal(t, tt.detail, got.Detail)
+			assert.Equal(t, "/api/v1/things/1", got.Instance)
+		})
+	}
+}
@@ -1,151 +1,660 @@
-package handler
-
-import (
-	"clinic-cli/internal/middleware"
-	"clinic-cli/internal/model"
-	"clinic-cli/internal/service"
-	"encoding/json"
-	"net/http"
-	"strconv"
-
-	"github.com/go-chi/chi/v5"
-	"github.com/golang-jwt/jwt/v5"
-)
-
-type Handler struct {
-	AuthService   *service.AuthService
-	ClinicService *service.ClinicService
-}
-
-func NewHandler(as *service.AuthService, cs *service.ClinicService) *Handler {
-	return &Handler{AuthService: as, ClinicService: cs}
-}
-
-func jsonResponse(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
-}
-
-func errorResponse(w http.ResponseWriter, status int, message string) {
-	jsonResponse(w, status, map[string]string{"error": message})
-}
-
-type RegisterRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
-
-func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
-	var req RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errorResponse(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	user, err := h.AuthService.Register(r.Context(), req.Email, req.Password, model.RolePatient)
-	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-	jsonResponse(w, http.StatusCreated, user)
-}
-
-type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
-
-func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errorResponse(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	token, err := h.AuthService.Login(r.Context(), req.Email, req.Password)
-	if err != nil {
-		errorResponse(w, http.StatusUnauthorized, err.Error())
-		return
-	}
-	jsonResponse(w, http.StatusOK, map[string]string{"token": token})
-}
-
-func (h *Handler) ListDoctors(w http.ResponseWriter, r *http.Request) {
-	doctors, err := h.ClinicService.ListDoctors(r.Context())
-	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, "Failed to fetch doctors")
-		return
-	}
-	jsonResponse(w, http.StatusOK, doctors)
-}
-
-type CreateDoctorRequest struct {
-	Name           string `json:"name"`
-	Specialization string `json:"specialization"`
-}
-
-func (h *Handler) CreateDoctor(w http.ResponseWriter, r *http.Request) {
-	var req CreateDoctorRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errorResponse(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	doc, err := h.ClinicService.CreateDoctor(r.Context(), req.Name, req.Specialization)
-	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, "Failed to create doctor")
-		return
-	}
-	jsonResponse(w, http.StatusCreated, doc)
-}
-
-type BookAppointmentRequest struct {
-	DoctorID int    `json:"doctor_id"`
-	Time     string `json:"time"`
-}
-
-func (h *Handler) BookAppointment(w http.ResponseWriter, r *http.Request) {
-	claims := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
-	patientID := int(claims["sub"].(float64))
-
-	var req BookAppointmentRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errorResponse(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	app, err := h.ClinicService.BookAppointment(r.Context(), patientID, req.DoctorID, req.Time)
-	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-	jsonResponse(w, http.StatusCreated, app)
-}
-
-func (h *Handler) MyAppointments(w http.ResponseWriter, r *http.Request) {
-	claims := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
-	patientID := int(claims["sub"].(float64))
-
-	apps, err := h.ClinicService.MyAppointments(r.Context(), patientID)
-	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, "Failed to fetch appointments")
-		return
-	}
-	jsonResponse(w, http.StatusOK, apps)
-}
-
-func (h *Handler) CancelAppointment(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		errorResponse(w, http.StatusBadRequest, "Invalid ID")
-		return
-	}
-
-	if err := h.ClinicService.CancelAppointment(r.Context(), id); err != nil {
-		errorResponse(w, http.StatusInternalServerError, "Failed to cancel")
-		return
-	}
-	jsonResponse(w, http.StatusOK, map[string]string{"message": "cancelled"})
-}
+package handler
+
+import (
+	"clinic-cli/internal/importer"
+	"clinic-cli/internal/middleware"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/problem"
+	"clinic-cli/internal/service"
+	"clinic-cli/internal/validation"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Handler struct {
+	AuthService   *service.AuthService
+	ClinicService *service.ClinicService
+}
+
+func NewHandler(as *service.AuthService, cs *service.ClinicService) *Handler {
+	return &Handler{AuthService: as, ClinicService: cs}
+}
+
+func jsonResponse(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// actorFromRequest describes the authenticated caller for the service layer.
+// It must only be used behind AuthMiddleware.
+func actorFromRequest(r *http.Request) service.Actor {
+	claims := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	actor := service.Actor{UserID: int(claims["sub"].(float64))}
+	if role, ok := claims["role"].(string); ok {
+		actor.Role = model.Role(role)
+	}
+	if doctorID, ok := claims["doctor_id"].(float64); ok {
+		actor.DoctorID = int(doctorID)
+	}
+	return actor
+}
+
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+	var req RegisterRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.AuthService.Register(r.Context(), req.Email, req.Password, model.RolePatient)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, user)
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Device   string `json:"device,omitempty"`
+}
+
+// Login opens a session for the device, named by the request or, failing
+// that, by its User-Agent.
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Device == "" {
+		req.Device = r.UserAgent()
+	}
+
+	tokens, err := h.AuthService.Login(r.Context(), req.Email, req.Password, req.Device, clientIP(r))
+	var throttled *service.ThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		problem.Write(w, r, problem.New(http.StatusTooManyRequests, err.Error()))
+		return
+	}
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, tokens)
+}
+
+// clientIP is the address the request came from. Forwarding headers are
+// ignored because any client can set them to dodge per-address throttling.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	tokens, err := h.AuthService.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, tokens)
+}
+
+// VerifyEmail is the target of the link in the verification e-mail.
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	err := h.AuthService.VerifyEmail(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"message": "email verified"})
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.AuthService.ResendVerification(r.Context(), req.Email); err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusAccepted, map[string]string{"message": "if the account needs verification, an email has been sent"})
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ForgotPassword always answers 202 so the response does not reveal whether
+// the address is registered.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.AuthService.ForgotPassword(r.Context(), req.Email); err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusAccepted, map[string]string{"message": "if the account exists, a reset email has been sent"})
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	err := h.AuthService.ResetPassword(r.Context(), req.Token, req.Password)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"message": "password updated"})
+}
+
+// Logout revokes the session the access token belongs to.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	userID := int(claims["sub"].(float64))
+
+	if err := h.AuthService.Logout(r.Context(), userID, claims["sid"].(string)); err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"message": "logged out"})
+}
+
+// LogoutAll revokes every session of the caller, including the current one.
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	userID := int(claims["sub"].(float64))
+
+	if err := h.AuthService.LogoutAll(r.Context(), userID); err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"message": "logged out everywhere"})
+}
+
+type SessionResponse struct {
+	model.Session
+	Current bool `json:"current"`
+}
+
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	userID := int(claims["sub"].(float64))
+
+	sessions, err := h.AuthService.Sessions(r.Context(), userID)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, SessionResponse{Session: s, Current: s.ID == claims["sid"]})
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// RevokeSession signs out one of the caller's other devices.
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	userID := int(claims["sub"].(float64))
+
+	err := h.AuthService.Logout(r.Context(), userID, chi.URLParam(r, "id"))
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"message": "session revoked"})
+}
+
+// ListDoctors serves the catalogue filtered by ?specialization= and ?q=,
+// ordered by ?sort= and paged with ?limit= and the returned next_cursor.
+func (h *Handler) ListDoctors(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := service.DoctorSearch{
+		Specialization: query.Get("specialization"),
+		Query:          query.Get("q"),
+		Sort:           query.Get("sort"),
+		Cursor:         query.Get("cursor"),
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			fail(w, r, validation.Query("limit", errInvalidLimit))
+			return
+		}
+		search.Limit = n
+	}
+
+	page, err := h.ClinicService.ListDoctors(r.Context(), search)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, page)
+}
+
+type CreateDoctorRequest struct {
+	Name           string `json:"name"`
+	Specialization string `json:"specialization"`
+}
+
+func (h *Handler) CreateDoctor(w http.ResponseWriter, r *http.Request) {
+	var req CreateDoctorRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	doc, err := h.ClinicService.CreateDoctor(r.Context(), req.Name, req.Specialization)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, doc)
+}
+
+type CreateDoctorAccountRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// CreateDoctorAccount serves POST /admin/doctors/{id}/account, giving an
+// existing doctor a login of their own.
+func (h *Handler) CreateDoctorAccount(w http.ResponseWriter, r *http.Request) {
+	doctorID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateDoctorAccountRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.AuthService.CreateDoctorAccount(r.Context(), req.Email, req.Password, doctorID)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, user)
+}
+
+// UnlockUser clears the failed-login lockout of an account.
+func (h *Handler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.AuthService.Unlock(r.Context(), userID)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"message": "user unlocked"})
+}
+
+type BookAppointmentRequest struct {
+	DoctorID int    `json:"doctor_id"`
+	Time     string `json:"time"`
+}
+
+func (h *Handler) BookAppointment(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	patientID := int(claims["sub"].(float64))
+
+	var req BookAppointmentRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	app, err := h.ClinicService.BookAppointment(r.Context(), patientID, req.DoctorID, req.Time)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, app)
+}
+
+type RescheduleAppointmentRequest struct {
+	DoctorID int    `json:"doctor_id,omitempty"`
+	Time     string `json:"time"`
+}
+
+// RescheduleAppointment serves PATCH /appointments/{id}. Omitting doctor_id
+// keeps the current doctor.
+func (h *Handler) RescheduleAppointment(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	patientID := int(claims["sub"].(float64))
+
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var req RescheduleAppointmentRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	app, err := h.ClinicService.RescheduleAppointment(r.Context(), patientID, id, req.DoctorID, req.Time)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, app)
+}
+
+func (h *Handler) MyAppointments(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	patientID := int(claims["sub"].(float64))
+
+	apps, err := h.ClinicService.MyAppointments(r.Context(), patientID)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, apps)
+}
+
+func (h *Handler) CancelAppointment(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.ClinicService.CancelAppointment(r.Context(), actorFromRequest(r), id)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"message": "cancelled"})
+}
+
+// AppointmentReminders shows which reminders have gone out for an
+// appointment.
+func (h *Handler) AppointmentReminders(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	reminders, err := h.ClinicService.AppointmentReminders(r.Context(), actorFromRequest(r), id)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, reminders)
+}
+
+type UpdateStatusRequest struct {
+	Status model.AppointmentStatus `json:"status"`
+}
+
+// UpdateAppointmentStatus serves PATCH /appointments/{id}/status for doctors
+// (their own appointments only) and admins.
+func (h *Handler) UpdateAppointmentStatus(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateStatusRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	app, err := h.ClinicService.UpdateAppointmentStatus(r.Context(), actorFromRequest(r), id, req.Status)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, app)
+}
+
+// DoctorAgenda serves GET /doctors/me/agenda?view=day|week&date=YYYY-MM-DD
+// for the doctor linked to the caller's account. The view defaults to day and
+// the date to today in clinic time.
+func (h *Handler) DoctorAgenda(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	doctorID, ok := claims["doctor_id"].(float64)
+	if !ok {
+		fail(w, r, errNotDoctor)
+		return
+	}
+
+	view := r.URL.Query().Get("view")
+	if view == "" {
+		view = service.AgendaViewDay
+	}
+
+	loc := h.ClinicService.Location()
+	date := time.Now().In(loc)
+	if v := r.URL.Query().Get("date"); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			fail(w, r, validation.Query("date", errInvalidDate))
+			return
+		}
+		date = d
+	}
+
+	agenda, err := h.ClinicService.DoctorAgenda(r.Context(), int(doctorID), view, date)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, agenda)
+}
+
+type AvailabilityResponse struct {
+	DoctorID    int          `json:"doctor_id"`
+	SlotMinutes int          `json:"slot_minutes"`
+	From        time.Time    `json:"from"`
+	To          time.Time    `json:"to"`
+	Slots       []model.Slot `json:"slots"`
+}
+
+// DoctorAvailability serves GET /doctors/{id}/availability?from=&to=. Both
+// bounds accept YYYY-MM-DD (a whole day in clinic time, to is inclusive) or
+// RFC 3339; the default window is the next seven days.
+func (h *Handler) DoctorAvailability(w http.ResponseWriter, r *http.Request) {
+	doctorID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	loc := h.ClinicService.Location()
+	var err error
+	from := time.Now().In(loc)
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = parseRangeBound(v, loc, false); err != nil {
+			fail(w, r, validation.Query("from", errInvalidRangeBound))
+			return
+		}
+	}
+	to := from.AddDate(0, 0, 7)
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = parseRangeBound(v, loc, true); err != nil {
+			fail(w, r, validation.Query("to", errInvalidRangeBound))
+			return
+		}
+	}
+
+	slots, err := h.ClinicService.DoctorAvailability(r.Context(), doctorID, from, to)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, AvailabilityResponse{
+		DoctorID:    doctorID,
+		SlotMinutes: int(h.ClinicService.SlotLength() / time.Minute),
+		From:        from,
+		To:          to,
+		Slots:       slots,
+	})
+}
+
+func parseRangeBound(v string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if day, err := time.ParseInLocation("2006-01-02", v, loc); err == nil {
+		if endOfDay {
+			return day.AddDate(0, 0, 1), nil
+		}
+		return day, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func (h *Handler) GetWorkingHours(w http.ResponseWriter, r *http.Request) {
+	doctorID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	hours, err := h.ClinicService.GetWorkingHours(r.Context(), doctorID)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, hours)
+}
+
+// maxImportBytes bounds the body of a doctor import.
+const maxImportBytes = 5 << 20
+
+// ImportDoctors ingests a CSV (text/csv) or JSON (application/json) list of
+// doctors. Any invalid row fails the whole import with 422 and a report of
+// every problem.
+func (h *Handler) ImportDoctors(w http.ResponseWriter, r *http.Request) {
+	format, err := importer.FormatOf(r.Header.Get("Content-Type"))
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusUnsupportedMediaType, err.Error()))
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	report, err := h.ClinicService.ImportDoctors(r.Context(), body, format)
+	switch {
+	case errors.Is(err, service.ErrImportRows):
+		// The report is the answer: it lists every invalid row.
+		jsonResponse(w, http.StatusUnprocessableEntity, report)
+		return
+	case err != nil:
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, report)
+}
+
+func (h *Handler) SetWorkingHours(w http.ResponseWriter, r *http.Request) {
+	doctorID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var hours []model.WorkingHours
+	if !decodeJSON(w, r, &hours) {
+		return
+	}
+
+	err := h.ClinicService.SetWorkingHours(r.Context(), doctorID, hours)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, hours)
+}
+
+// ListOutbox shows the latest notification events, e.g. ?status=dead for the
+// deliveries that gave up.
+func (h *Handler) ListOutbox(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			fail(w, r, validation.Query("limit", errInvalidLimit))
+			return
+		}
+		limit = n
+	}
+
+	status := model.OutboxStatus(r.URL.Query().Get("status"))
+	events, err := h.ClinicService.OutboxEvents(r.Context(), status, limit)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, events)
+}
+
+func (h *Handler) GetOutboxEvent(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	event, err := h.ClinicService.OutboxEvent(r.Context(), id)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, event)
+}
+
+// ReplayOutboxEvent sends a dead event through the dispatcher again.
+func (h *Handler) ReplayOutboxEvent(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	event, err := h.ClinicService.ReplayOutboxEvent(r.Context(), id)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, event)
+}
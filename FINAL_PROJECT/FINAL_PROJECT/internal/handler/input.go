@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"clinic-cli/internal/validation"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxBodyBytes bounds JSON request bodies.
+const maxBodyBytes = 1 << 20
+
+var (
+	errInvalidID         = errors.New("must be a positive integer")
+	errUnknownField      = errors.New("is not a known field")
+	errMalformedJSON     = errors.New("is not valid JSON")
+	errBodyRequired      = errors.New("is required")
+	errTrailingValues    = errors.New("must hold a single JSON value")
+	errInvalidLimit      = errors.New("must be a positive integer")
+	errInvalidDate       = errors.New("must be a date as YYYY-MM-DD")
+	errInvalidRangeBound = errors.New("must be a date as YYYY-MM-DD or an RFC 3339 time")
+)
+
+// decodeJSON reads the request body into dst, rejecting unknown fields and
+// bodies over maxBodyBytes. On failure it has already answered the request.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errTrailingValues
+	}
+	if err == nil {
+		return true
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		fail(w, r, err)
+	case errors.Is(err, io.EOF):
+		fail(w, r, validation.Body("", errBodyRequired))
+	case errors.As(err, &typeErr):
+		fail(w, r, validation.Body(typeErr.Field, fmt.Errorf("must be %s", jsonType(typeErr.Type.Kind().String()))))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields.
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		fail(w, r, validation.Body(field, errUnknownField))
+	case errors.Is(err, errTrailingValues):
+		fail(w, r, validation.Body("", err))
+	default:
+		fail(w, r, validation.Body("", errMalformedJSON))
+	}
+	return false
+}
+
+// jsonType names the JSON type a Go kind decodes from.
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"):
+		return "an integer"
+	case strings.HasPrefix(kind, "float"):
+		return "a number"
+	case kind == "slice", kind == "array":
+		return "an array"
+	case kind == "struct", kind == "map":
+		return "an object"
+	case kind == "bool":
+		return "a boolean"
+	}
+	return "a " + kind
+}
+
+// pathID parses the {id} URL parameter. On failure it has already answered
+// the request.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		fail(w, r, validation.Field(validation.InPath, "id", errInvalidID))
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/openapi"
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/service"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPI_DescribesEveryRoute(t *testing.T) {
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+	router := NewRouter(NewHandler(nil, nil), "secret").(chi.Routes)
+
+	routed := map[string]bool{}
+	err = chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = strings.ReplaceAll(route, "/*/", "/")
+		routed[method+" "+route] = true
+		return nil
+	})
+	require.NoError(t, err)
+
+	described := map[string]bool{}
+	for _, rt := range spec.Routes() {
+		described[rt.Method+" "+rt.Path] = true
+	}
+	assert.Equal(t, routed, described)
+}
+
+// conformanceClient sends requests through the router and fails the test
+// when a response is not what the specification promises.
+type conformanceClient struct {
+	t      *testing.T
+	spec   *openapi.Spec
+	router http.Handler
+}
+
+func (c *conformanceClient) do(method, path, token, contentType, body string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	c.router.ServeHTTP(rec, req)
+
+	route, _, _ := c.spec.Find(method, req.URL.Path)
+	if assert.NotNil(c.t, route, "%s %s is not described", method, path) {
+		assert.NoError(c.t, route.ValidateResponse(rec.Code, rec.Header(), rec.Body.Bytes()))
+	}
+	return rec
+}
+
+func (c *conformanceClient) json(method, path, token, body string, want int, out any) {
+	c.t.Helper()
+	rec := c.do(method, path, token, "application/json", body)
+	require.Equal(c.t, want, rec.Code, "%s %s: %s", method, path, rec.Body.String())
+	if out != nil {
+		require.NoError(c.t, json.Unmarshal(rec.Body.Bytes(), out))
+	}
+}
+
+func TestOpenAPI_ResponsesConform(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRegistry()
+	auth := service.NewAuthService(repos, make(chan model.Email, 100), service.AuthConfig{JWTSecret: "secret"})
+	clinic := service.NewClinicService(repos, service.ClinicConfig{})
+	c := &conformanceClient{t: t, spec: openapi.MustLoad(), router: NewRouter(NewHandler(auth, clinic), "secret")}
+
+	admin := loginAs(t, auth, model.RoleAdmin).AccessToken
+	c.json(http.MethodGet, "/health", "", "", http.StatusOK, nil)
+	assert.Equal(t, http.StatusOK, c.do(http.MethodGet, "/openapi.json", "", "", "").Code)
+	assert.Equal(t, http.StatusOK, c.do(http.MethodGet, "/docs", "", "", "").Code)
+
+	// Accounts and sessions.
+	var user model.User
+	c.json(http.MethodPost, "/api/v1/auth/register", "", `{"email":"ann@example.com","password":"password123"}`, http.StatusCreated, &user)
+	c.json(http.MethodPost, "/api/v1/auth/register", "", `{"email":"not-an-email"}`, http.StatusBadRequest, nil)
+	c.json(http.MethodPost, "/api/v1/auth/register", "", `{"email":"ann@example.com","password":"password456"}`, http.StatusConflict, nil)
+	require.NoError(t, repos.User.MarkEmailVerified(ctx, user.ID, time.Now()))
+	var tokens service.TokenPair
+	c.json(http.MethodPost, "/api/v1/auth/login", "", `{"email":"ann@example.com","password":"password123"}`, http.StatusOK, &tokens)
+	c.json(http.MethodPost, "/api/v1/auth/login", "", `{"email":"ann@example.com","password":"wrong"}`, http.StatusUnauthorized, nil)
+	c.json(http.MethodPost, "/api/v1/auth/refresh", "", fmt.Sprintf(`{"refresh_token":%q}`, tokens.RefreshToken), http.StatusOK, &tokens)
+	c.json(http.MethodPost, "/api/v1/auth/refresh", "", `{"refresh_token":"stale"}`, http.StatusUnauthorized, nil)
+	c.json(http.MethodGet, "/api/v1/auth/verify?token=nope", "", "", http.StatusBadRequest, nil)
+	c.json(http.MethodPost, "/api/v1/auth/verify/resend", "", `{"email":"ann@example.com"}`, http.StatusAccepted, nil)
+	c.json(http.MethodPost, "/api/v1/auth/password/forgot", "", `{"email":"ann@example.com"}`, http.StatusAccepted, nil)
+	c.json(http.MethodPost, "/api/v1/auth/password/reset", "", `{"token":"nope","password":"password456"}`, http.StatusBadRequest, nil)
+	patient := tokens.AccessToken
+	c.json(http.MethodGet, "/api/v1/auth/sessions", patient, "", http.StatusOK, nil)
+	c.json(http.MethodDelete, "/api/v1/auth/sessions/nope", patient, "", http.StatusNotFound, nil)
+	assert.Equal(t, http.StatusUnauthorized, c.do(http.MethodGet, "/api/v1/auth/sessions", "", "", "").Code)
+
+	// Doctors.
+	var doctor model.Doctor
+	c.json(http.MethodPost, "/api/v1/admin/doctors", admin, `{"name":"Dr. Grey","specialization":"Surgery"}`, http.StatusCreated, &doctor)
+	c.json(http.MethodPost, "/api/v1/admin/doctors", admin, `{"name":""}`, http.StatusBadRequest, nil)
+	assert.Equal(t, http.StatusForbidden, c.do(http.MethodPost, "/api/v1/admin/doctors", patient, "", "").Code)
+	doctorPath := fmt.Sprintf("/api/v1/doctors/%d", doctor.ID)
+	adminDoctorPath := fmt.Sprintf("/api/v1/admin/doctors/%d", doctor.ID)
+	c.json(http.MethodPut, adminDoctorPath+"/hours", admin, `[{"weekday":1,"start":"09:00","end":"17:00"}]`, http.StatusOK, nil)
+	c.json(http.MethodPut, adminDoctorPath+"/hours", admin, `[{"weekday":9,"start":"9am"}]`, http.StatusBadRequest, nil)
+	c.json(http.MethodGet, doctorPath+"/hours", "", "", http.StatusOK, nil)
+	c.json(http.MethodGet, doctorPath+"/availability?from=2030-01-07&to=2030-01-08", "", "", http.StatusOK, nil)
+	c.json(http.MethodGet, "/api/v1/doctors/abc/availability", "", "", http.StatusBadRequest, nil)
+	c.json(http.MethodGet, "/api/v1/doctors/4242/hours", "", "", http.StatusNotFound, nil)
+	c.json(http.MethodGet, "/api/v1/doctors?q=grey&sort=-name&limit=1", "", "", http.StatusOK, nil)
+	c.json(http.MethodGet, "/api/v1/doctors?limit=1000", "", "", http.StatusBadRequest, nil)
+	c.json(http.MethodPost, adminDoctorPath+"/account", admin, `{"email":"grey@example.com","password":"password123"}`, http.StatusCreated, nil)
+	c.json(http.MethodPost, adminDoctorPath+"/account", admin, `{"email":"grey2@example.com","password":"password123"}`, http.StatusConflict, nil)
+	var doctorTokens service.TokenPair
+	c.json(http.MethodPost, "/api/v1/auth/login", "", `{"email":"grey@example.com","password":"password123"}`, http.StatusOK, &doctorTokens)
+	doc := doctorTokens.AccessToken
+
+	rec := c.do(http.MethodPost, "/api/v1/admin/doctors/import", admin, "text/csv", "external_id,name,specialization\nh-1,Dr. House,Diagnostics\n")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = c.do(http.MethodPost, "/api/v1/admin/doctors/import", admin, "application/json", `[{"external_id":"h-2","name":""}]`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	rec = c.do(http.MethodPost, "/api/v1/admin/doctors/import", admin, "application/xml", "<doctors/>")
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	// Appointments.
+	var app model.Appointment
+	c.json(http.MethodPost, "/api/v1/appointments", patient, fmt.Sprintf(`{"doctor_id":%d,"time":"2030-01-07 09:00"}`, doctor.ID), http.StatusCreated, &app)
+	c.json(http.MethodPost, "/api/v1/appointments", patient, fmt.Sprintf(`{"doctor_id":%d,"time":"2030-01-07 09:00"}`, doctor.ID), http.StatusConflict, nil)
+	c.json(http.MethodPost, "/api/v1/appointments", patient, fmt.Sprintf(`{"doctor_id":%d,"time":"2030-01-08 09:00"}`, doctor.ID), http.StatusUnprocessableEntity, nil)
+	c.json(http.MethodPost, "/api/v1/appointments", patient, `{"doctor_id":"one"}`, http.StatusBadRequest, nil)
+	appPath := fmt.Sprintf("/api/v1/appointments/%d", app.ID)
+	c.json(http.MethodPatch, appPath, patient, `{"time":"2030-01-07 10:00"}`, http.StatusOK, nil)
+	c.json(http.MethodGet, "/api/v1/appointments", patient, "", http.StatusOK, nil)
+	c.json(http.MethodGet, appPath+"/reminders", patient, "", http.StatusOK, nil)
+	assert.Equal(t, http.StatusOK, c.do(http.MethodGet, appPath+"/calendar.ics", patient, "", "").Code)
+	c.json(http.MethodGet, "/api/v1/doctors/me/agenda?view=week&date=2030-01-07", doc, "", http.StatusOK, nil)
+	c.json(http.MethodGet, "/api/v1/doctors/me/agenda?view=month", doc, "", http.StatusBadRequest, nil)
+	c.json(http.MethodPatch, appPath+"/status", doc, `{"status":"checked_in"}`, http.StatusOK, nil)
+	c.json(http.MethodPatch, appPath+"/status", doc, `{"status":"lost"}`, http.StatusBadRequest, nil)
+	c.json(http.MethodDelete, appPath, patient, "", http.StatusConflict, nil)
+
+	var feed struct{ Path string }
+	c.json(http.MethodPost, "/api/v1/calendar/feed", patient, "", http.StatusCreated, &feed)
+	assert.Equal(t, http.StatusOK, c.do(http.MethodGet, feed.Path, "", "", "").Code)
+	c.json(http.MethodGet, "/calendar/doctor/nope.ics", "", "", http.StatusNotFound, nil)
+
+	// Administration.
+	var events []model.OutboxEvent
+	c.json(http.MethodGet, "/api/v1/admin/outbox?status=pending", admin, "", http.StatusOK, &events)
+	require.NotEmpty(t, events)
+	outboxPath := fmt.Sprintf("/api/v1/admin/outbox/%d", events[0].ID)
+	c.json(http.MethodGet, outboxPath, admin, "", http.StatusOK, nil)
+	c.json(http.MethodPost, outboxPath+"/replay", admin, "", http.StatusConflict, nil)
+	c.json(http.MethodGet, "/api/v1/admin/outbox?status=lost", admin, "", http.StatusBadRequest, nil)
+	c.json(http.MethodPost, fmt.Sprintf("/api/v1/admin/users/%d/unlock", user.ID), admin, "", http.StatusOK, nil)
+	c.json(http.MethodPost, "/api/v1/admin/users/4242/unlock", admin, "", http.StatusNotFound, nil)
+
+	c.json(http.MethodPost, "/api/v1/auth/logout-all", doc, "", http.StatusOK, nil)
+	c.json(http.MethodPost, "/api/v1/auth/logout", patient, "", http.StatusOK, nil)
+}
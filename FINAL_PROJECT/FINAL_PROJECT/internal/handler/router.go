@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"clinic-cli/internal/middleware"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/openapi"
+	"clinic-cli/internal/problem"
+	"clinic-cli/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func NewRouter(h *Handler, jwtSecret string) http.Handler {
+	spec := openapi.MustLoad()
+	// validate goes after the authentication and role checks of each route.
+	validate := middleware.ValidateRequest(spec)
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.AccessLog)
+	r.Use(middleware.Recover)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "No such route"))
+	})
+
+	r.Get("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openapi.Document())
+	})
+	r.Get("/docs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(openapi.DocsPage())
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(validate)
+
+		r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+			jsonResponse(w, http.StatusOK, map[string]string{"status": "ok"})
+		})
+
+		r.Get("/calendar/patient/{token}.ics", h.CalendarFeed(service.FeedPatient))
+		r.Get("/calendar/doctor/{token}.ics", h.CalendarFeed(service.FeedDoctor))
+	})
+
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(validate)
+
+			r.Post("/auth/register", h.Register)
+			r.Post("/auth/login", h.Login)
+			r.Post("/auth/refresh", h.Refresh)
+			r.Post("/auth/password/forgot", h.ForgotPassword)
+			r.Post("/auth/password/reset", h.ResetPassword)
+			r.Get("/auth/verify", h.VerifyEmail)
+			r.Post("/auth/verify/resend", h.ResendVerification)
+			r.Get("/doctors", h.ListDoctors)
+			r.Get("/doctors/{id}/availability", h.DoctorAvailability)
+			r.Get("/doctors/{id}/hours", h.GetWorkingHours)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(jwtSecret, h.AuthService))
+
+			r.Group(func(r chi.Router) {
+				r.Use(validate)
+
+				r.Post("/auth/logout", h.Logout)
+				r.Post("/auth/logout-all", h.LogoutAll)
+				r.Get("/auth/sessions", h.ListSessions)
+				r.Delete("/auth/sessions/{id}", h.RevokeSession)
+
+				r.Get("/appointments", h.MyAppointments)
+				r.Patch("/appointments/{id}", h.RescheduleAppointment)
+				r.Delete("/appointments/{id}", h.CancelAppointment)
+				r.Get("/appointments/{id}/reminders", h.AppointmentReminders)
+				r.Get("/appointments/{id}/calendar.ics", h.AppointmentICS)
+				r.Post("/calendar/feed", h.RotateCalendarFeed)
+			})
+
+			r.With(middleware.RequireVerifiedEmail(h.AuthService), validate).Post("/appointments", h.BookAppointment)
+			r.With(middleware.RequireRole(model.RoleDoctor), validate).Get("/doctors/me/agenda", h.DoctorAgenda)
+			r.With(middleware.RequireRole(model.RoleDoctor, model.RoleAdmin), validate).Patch("/appointments/{id}/status", h.UpdateAppointmentStatus)
+
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(middleware.AdminOnly)
+				r.Use(validate)
+
+				r.Post("/doctors", h.CreateDoctor)
+				r.Post("/doctors/import", h.ImportDoctors)
+				r.Put("/doctors/{id}/hours", h.SetWorkingHours)
+				r.Post("/doctors/{id}/account", h.CreateDoctorAccount)
+				r.Post("/users/{id}/unlock", h.UnlockUser)
+
+				r.Get("/outbox", h.ListOutbox)
+				r.Get("/outbox/{id}", h.GetOutboxEvent)
+				r.Post("/outbox/{id}/replay", h.ReplayOutboxEvent)
+			})
+		})
+	})
+
+	return r
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/service"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loginAs registers a user with the given role and returns its token pair.
+func loginAs(t *testing.T, auth *service.AuthService, role model.Role) *service.TokenPair {
+	t.Helper()
+	ctx := context.Background()
+	email := string(role) + "@example.com"
+	_, err := auth.Register(ctx, email, "password123", role)
+	require.NoError(t, err)
+	tokens, err := auth.Login(ctx, email, "password123", "test", "")
+	require.NoError(t, err)
+	return tokens
+}
+
+func signedToken(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRouter_Protection(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	auth := service.NewAuthService(repos, make(chan model.Email, 10), service.AuthConfig{JWTSecret: "secret"})
+	router := NewRouter(NewHandler(auth, nil), "secret")
+
+	patient := loginAs(t, auth, model.RolePatient)
+	revoked := loginAs(t, auth, model.RoleAdmin)
+	require.NoError(t, repos.Session.Revoke(context.Background(), revoked.SessionID, time.Now()))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"health is public", http.MethodGet, "/health", "", http.StatusOK},
+		{"appointments require auth", http.MethodGet, "/api/v1/appointments", "", http.StatusUnauthorized},
+		{"bad token rejected", http.MethodGet, "/api/v1/appointments", "garbage", http.StatusUnauthorized},
+		{"sessionless token rejected", http.MethodGet, "/api/v1/auth/sessions", signedToken(t, "secret", jwt.MapClaims{"sub": 1, "role": "admin"}), http.StatusUnauthorized},
+		{"revoked session rejected", http.MethodGet, "/api/v1/auth/sessions", revoked.AccessToken, http.StatusUnauthorized},
+		{"live session accepted", http.MethodGet, "/api/v1/auth/sessions", patient.AccessToken, http.StatusOK},
+		{"admin routes reject patients", http.MethodPost, "/api/v1/admin/doctors", patient.AccessToken, http.StatusForbidden},
+		{"agenda rejects patients", http.MethodGet, "/api/v1/doctors/me/agenda", patient.AccessToken, http.StatusForbidden},
+		{"booking requires a verified email", http.MethodPost, "/api/v1/appointments", patient.AccessToken, http.StatusForbidden},
+		{"status changes reject patients", http.MethodPatch, "/api/v1/appointments/1/status", patient.AccessToken, http.StatusForbidden},
+		{"unknown route", http.MethodGet, "/api/v1/nope", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestRouter_RequestID(t *testing.T) {
+	router := NewRouter(NewHandler(nil, nil), "secret")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Regexp(t, "^[0-9a-f]{16}$", rec.Header().Get("X-Request-ID"), "one is made up")
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Request-ID", "proxy-123")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, "proxy-123", rec.Header().Get("X-Request-ID"), "the client's is kept")
+
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Request-ID", "forged\nlevel=ERROR")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.NotContains(t, rec.Header().Get("X-Request-ID"), "forged", "a malformed one is replaced")
+}
+
+func TestRouter_ValidationErrors(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	auth := service.NewAuthService(repos, make(chan model.Email, 10), service.AuthConfig{JWTSecret: "secret"})
+	clinic := service.NewClinicService(repos, service.ClinicConfig{})
+	router := NewRouter(NewHandler(auth, clinic), "secret")
+
+	patient := loginAs(t, auth, model.RolePatient)
+	user, err := repos.User.GetByEmail(context.Background(), "patient@example.com")
+	require.NoError(t, err)
+	require.NoError(t, repos.User.MarkEmailVerified(context.Background(), user.ID, time.Now()))
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		body  string
+		want  int
+		field string
+	}{
+		{"malformed email", "/api/v1/auth/register", "", `{"email":"ann","password":"password123"}`, http.StatusBadRequest, "email"},
+		{"password without digits", "/api/v1/auth/register", "", `{"email":"ann@example.com","password":"passwordonly"}`, http.StatusBadRequest, "password"},
+		{"unknown field", "/api/v1/auth/register", "", `{"email":"ann@example.com","password":"password123","admin":true}`, http.StatusBadRequest, "admin"},
+		{"missing doctor", "/api/v1/appointments", patient.AccessToken, `{"doctor_id":0,"time":"2030-01-07 09:00"}`, http.StatusBadRequest, "doctor_id"},
+		{"time in the past", "/api/v1/appointments", patient.AccessToken, `{"doctor_id":1,"time":"2020-01-06 09:00"}`, http.StatusBadRequest, "time"},
+		{"body too large", "/api/v1/auth/register", "", `{"email":"` + strings.Repeat("a", 1<<20) + `"}`, http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+			if tt.field == "" {
+				return
+			}
+			var body struct {
+				Fields []struct{ Field string }
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			require.Len(t, body.Fields, 1)
+			assert.Equal(t, tt.field, body.Fields[0].Field)
+		})
+	}
+}
+
+func TestRouter_LoginThrottled(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	policy := service.ThrottlePolicy{FreeAttempts: 1, LockoutAfter: 5, BaseDelay: time.Minute, Lockout: time.Hour}
+	auth := service.NewAuthService(repos, make(chan model.Email, 10), service.AuthConfig{JWTSecret: "secret", AccountThrottle: policy})
+	router := NewRouter(NewHandler(auth, nil), "secret")
+
+	login := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"email":"ann@example.com","password":"wrong"}`))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login().Code)
+	assert.Equal(t, http.StatusUnauthorized, login().Code)
+	rec := login()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+}
+
+func TestRouter_CalendarFeed(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRegistry()
+	auth := service.NewAuthService(repos, make(chan model.Email, 10), service.AuthConfig{JWTSecret: "secret"})
+	clinic := service.NewClinicService(repos, service.ClinicConfig{})
+	router := NewRouter(NewHandler(auth, clinic), "secret")
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	patient := loginAs(t, auth, model.RolePatient)
+	user, err := repos.User.GetByEmail(ctx, "patient@example.com")
+	require.NoError(t, err)
+	doctor, err := repos.Doctor.Create(ctx, "Dr. Grey", "Surgery")
+	require.NoError(t, err)
+	app, err := repos.Appointment.Create(ctx, user.ID, doctor.ID, time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/api/v1/calendar/feed", patient.AccessToken)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var feed struct{ Path string }
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &feed))
+	require.True(t, strings.HasPrefix(feed.Path, "/calendar/patient/"))
+
+	rec = serve(http.MethodGet, feed.Path, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "SUMMARY:Appointment with Dr. Grey")
+
+	// The same secret does not open a doctor feed.
+	doctorPath := strings.Replace(feed.Path, "/patient/", "/doctor/", 1)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, doctorPath, "").Code)
+
+	_, err = repos.Appointment.Cancel(ctx, app.ID)
+	require.NoError(t, err)
+	rec = serve(http.MethodGet, fmt.Sprintf("/api/v1/appointments/%d/calendar.ics", app.ID), patient.AccessToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "STATUS:CANCELLED")
+
+	// Rotating retires the old URL.
+	serve(http.MethodPost, "/api/v1/calendar/feed", patient.AccessToken)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, feed.Path, "").Code)
+
+	// The secret in the path is the only credential, so it stays out of the logs.
+	assert.Contains(t, logs.String(), "/calendar/patient/{token}.ics")
+	assert.NotContains(t, logs.String(), strings.TrimSuffix(path.Base(feed.Path), ".ics"))
+}
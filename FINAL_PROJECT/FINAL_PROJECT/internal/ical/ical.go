@@ -0,0 +1,113 @@
+// Package ical renders appointments as iCalendar (RFC 5545) documents that
+// calendar apps can import or subscribe to.
+package ical
+
+import (
+	"bufio"
+	"clinic-cli/internal/model"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const ContentType = "text/calendar; charset=utf-8"
+
+// Calendar describes how appointments are presented. Times are always
+// written in UTC, which every client converts correctly; Location is only
+// advertised as the calendar's display time zone.
+type Calendar struct {
+	Name       string
+	Location   *time.Location
+	SlotLength time.Duration
+	// Summary titles an event, e.g. with the doctor for a patient's feed.
+	Summary func(model.Appointment) string
+}
+
+// Write renders apps as one VCALENDAR. now is used as the DTSTAMP of every
+// event.
+func (c Calendar) Write(w io.Writer, apps []model.Appointment, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//clinic-cli//appointments//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+	if c.Location != nil {
+		line("X-WR-TIMEZONE", c.Location.String())
+	}
+	for _, app := range apps {
+		line("BEGIN", "VEVENT")
+		line("UID", UID(app.ID))
+		line("DTSTAMP", utc(now))
+		line("DTSTART", utc(app.Time))
+		line("DTEND", utc(app.Time.Add(c.SlotLength)))
+		line("SEQUENCE", fmt.Sprint(app.Revision))
+		line("SUMMARY", escape(c.summary(app)))
+		if app.Specialization != "" {
+			line("CATEGORIES", escape(app.Specialization))
+		}
+		if app.Status == model.StatusCancelled {
+			line("STATUS", "CANCELLED")
+		} else {
+			line("STATUS", "CONFIRMED")
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// UID identifies an appointment across exports and feed refreshes, so
+// calendar apps update the event instead of duplicating it.
+func UID(appointmentID int) string {
+	return fmt.Sprintf("appointment-%d@clinic-cli", appointmentID)
+}
+
+func (c Calendar) summary(app model.Appointment) string {
+	if c.Summary != nil {
+		return c.Summary(app)
+	}
+	return fmt.Sprintf("Appointment #%d", app.ID)
+}
+
+func utc(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// writeFolded ends the content line with CRLF and folds it so that no line
+// exceeds 75 octets, without splitting a UTF-8 sequence.
+func writeFolded(w *bufio.Writer, s string) {
+	const limit = 75
+	width := limit
+	for len(s) > width {
+		cut := width
+		for cut > 0 && !utf8Start(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// The leading space of a continuation line counts towards the limit.
+		width = limit - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+func utf8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,53 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"clinic-cli/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendar_Write(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	previous := time.Date(2030, 1, 7, 8, 0, 0, 0, time.UTC)
+	apps := []model.Appointment{
+		{ID: 1, Time: time.Date(2030, 1, 7, 9, 30, 0, 0, berlin), Status: model.StatusScheduled, DoctorName: "Dr. Grey, MD", PreviousTime: &previous, Revision: 3},
+		{ID: 2, Time: time.Date(2030, 7, 1, 9, 30, 0, 0, berlin), Status: model.StatusCancelled, DoctorName: "Dr. Grey, MD"},
+	}
+	cal := Calendar{
+		Name:       "My appointments",
+		Location:   berlin,
+		SlotLength: 30 * time.Minute,
+		Summary:    func(a model.Appointment) string { return "Appointment with " + a.DoctorName },
+	}
+
+	var sb strings.Builder
+	require.NoError(t, cal.Write(&sb, apps, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)))
+	out := sb.String()
+
+	assert.True(t, strings.HasPrefix(out, "BEGIN:VCALENDAR\r\n"))
+	assert.Contains(t, out, "X-WR-TIMEZONE:Europe/Berlin\r\n")
+	// 09:30 in Berlin is 08:30 UTC in winter and 07:30 UTC in summer.
+	assert.Contains(t, out, "UID:appointment-1@clinic-cli\r\nDTSTAMP:20300101T000000Z\r\nDTSTART:20300107T083000Z\r\nDTEND:20300107T090000Z\r\nSEQUENCE:3\r\n")
+	assert.Contains(t, out, "DTSTART:20300701T073000Z\r\n")
+	assert.Contains(t, out, `SUMMARY:Appointment with Dr. Grey\, MD`)
+	assert.Equal(t, 1, strings.Count(out, "STATUS:CANCELLED"))
+	assert.Equal(t, 1, strings.Count(out, "STATUS:CONFIRMED"))
+}
+
+func TestWriteFolded(t *testing.T) {
+	var sb strings.Builder
+	cal := Calendar{Name: strings.Repeat("é", 100)}
+	require.NoError(t, cal.Write(&sb, nil, time.Now()))
+
+	for _, line := range strings.Split(strings.TrimSuffix(sb.String(), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+	unfolded := strings.ReplaceAll(sb.String(), "\r\n ", "")
+	assert.Contains(t, unfolded, "X-WR-CALNAME:"+strings.Repeat("é", 100)+"\r\n")
+}
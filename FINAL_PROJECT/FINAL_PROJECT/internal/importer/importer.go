@@ -0,0 +1,256 @@
+// Package importer reads doctor lists from CSV or JSON for bulk import and
+// validates them row by row, so one report can point at every bad row.
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	JSON Format = "json"
+)
+
+// MaxRows bounds a single import, which runs in one transaction.
+const MaxRows = 5000
+
+const (
+	maxExternalID     = 64
+	maxName           = 200
+	maxSpecialization = 100
+)
+
+var (
+	ErrUnknownFormat = errors.New("unsupported format, expected CSV or JSON")
+	ErrTooManyRows   = fmt.Errorf("too many rows, at most %d per import", MaxRows)
+)
+
+// Row is one doctor to create, or to update if a doctor with the same
+// ExternalID exists. Line is the CSV line number, or the 1-based position in
+// a JSON array.
+type Row struct {
+	Line           int    `json:"row"`
+	ExternalID     string `json:"external_id"`
+	Name           string `json:"name"`
+	Specialization string `json:"specialization"`
+}
+
+type RowError struct {
+	Line       int    `json:"row"`
+	ExternalID string `json:"external_id,omitempty"`
+	Field      string `json:"field,omitempty"`
+	Message    string `json:"error"`
+}
+
+// Result is what happened to a valid row.
+type Result struct {
+	Line       int    `json:"row"`
+	ExternalID string `json:"external_id"`
+	DoctorID   int    `json:"doctor_id"`
+	Created    bool   `json:"created"`
+}
+
+// Report sums up an import. Nothing is written unless Errors is empty.
+type Report struct {
+	Created int        `json:"created"`
+	Updated int        `json:"updated"`
+	Rows    []Result   `json:"rows"`
+	Errors  []RowError `json:"errors"`
+}
+
+// Add records the outcome of an applied row.
+func (r *Report) Add(res Result) {
+	if res.Created {
+		r.Created++
+	} else {
+		r.Updated++
+	}
+	r.Rows = append(r.Rows, res)
+}
+
+// FormatOf picks the format from a file name or a Content-Type.
+func FormatOf(nameOrType string) (Format, error) {
+	if mediaType, _, err := mime.ParseMediaType(nameOrType); err == nil {
+		switch mediaType {
+		case "text/csv":
+			return CSV, nil
+		case "application/json":
+			return JSON, nil
+		}
+	}
+	switch strings.ToLower(filepath.Ext(nameOrType)) {
+	case ".csv":
+		return CSV, nil
+	case ".json":
+		return JSON, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// Parse reads and validates every row. The error is only set when the
+// document as a whole cannot be read; problems with individual rows are
+// returned as RowErrors, and only rows without errors are returned.
+func Parse(r io.Reader, format Format) ([]Row, []RowError, error) {
+	var rows []Row
+	var rowErrs []RowError
+	var err error
+	switch format {
+	case CSV:
+		rows, rowErrs, err = parseCSV(r)
+	case JSON:
+		rows, rowErrs, err = parseJSON(r)
+	default:
+		return nil, nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows)+len(rowErrs) > MaxRows {
+		return nil, nil, ErrTooManyRows
+	}
+
+	valid := []Row{}
+	seen := make(map[string]int)
+	for _, row := range rows {
+		if e := validate(row); e != nil {
+			rowErrs = append(rowErrs, *e)
+			continue
+		}
+		if first, ok := seen[row.ExternalID]; ok {
+			rowErrs = append(rowErrs, RowError{
+				Line: row.Line, ExternalID: row.ExternalID, Field: "external_id",
+				Message: fmt.Sprintf("duplicates row %d", first),
+			})
+			continue
+		}
+		seen[row.ExternalID] = row.Line
+		valid = append(valid, row)
+	}
+	sortErrors(rowErrs)
+	return valid, rowErrs, nil
+}
+
+var columns = []string{"external_id", "name", "specialization"}
+
+func parseCSV(r io.Reader) ([]Row, []RowError, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	// Short rows are reported per row rather than failing the document.
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errors.New("empty CSV, expected a header row")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	index := make(map[string]int)
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		index[h] = i
+	}
+	for _, c := range columns {
+		if _, ok := index[c]; !ok {
+			return nil, nil, fmt.Errorf("CSV header must contain %s", strings.Join(columns, ", "))
+		}
+	}
+
+	var rows []Row
+	var rowErrs []RowError
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, rowErrs, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(rows)+len(rowErrs) >= MaxRows {
+			return nil, nil, ErrTooManyRows
+		}
+		line, _ := cr.FieldPos(0)
+		if len(record) != len(header) {
+			rowErrs = append(rowErrs, RowError{Line: line, Message: fmt.Sprintf("expected %d fields, got %d", len(header), len(record))})
+			continue
+		}
+		rows = append(rows, Row{
+			Line:           line,
+			ExternalID:     strings.TrimSpace(record[index["external_id"]]),
+			Name:           strings.TrimSpace(record[index["name"]]),
+			Specialization: strings.TrimSpace(record[index["specialization"]]),
+		})
+	}
+}
+
+func parseJSON(r io.Reader) ([]Row, []RowError, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON, expected an array of doctors: %w", err)
+	}
+	if len(raw) > MaxRows {
+		return nil, nil, ErrTooManyRows
+	}
+
+	var rows []Row
+	var rowErrs []RowError
+	for i, item := range raw {
+		var fields struct {
+			ExternalID     string `json:"external_id"`
+			Name           string `json:"name"`
+			Specialization string `json:"specialization"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(item))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&fields); err != nil {
+			rowErrs = append(rowErrs, RowError{Line: i + 1, Message: "invalid row: " + err.Error()})
+			continue
+		}
+		rows = append(rows, Row{
+			Line:           i + 1,
+			ExternalID:     strings.TrimSpace(fields.ExternalID),
+			Name:           strings.TrimSpace(fields.Name),
+			Specialization: strings.TrimSpace(fields.Specialization),
+		})
+	}
+	return rows, rowErrs, nil
+}
+
+func validate(row Row) *RowError {
+	check := []struct {
+		field, value string
+		max          int
+	}{
+		{"external_id", row.ExternalID, maxExternalID},
+		{"name", row.Name, maxName},
+		{"specialization", row.Specialization, maxSpecialization},
+	}
+	for _, c := range check {
+		msg := ""
+		switch {
+		case c.value == "":
+			msg = "is required"
+		case len(c.value) > c.max:
+			msg = fmt.Sprintf("must be at most %d characters", c.max)
+		}
+		if msg != "" {
+			return &RowError{Line: row.Line, ExternalID: row.ExternalID, Field: c.field, Message: c.field + " " + msg}
+		}
+	}
+	return nil
+}
+
+func sortErrors(errs []RowError) {
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+}
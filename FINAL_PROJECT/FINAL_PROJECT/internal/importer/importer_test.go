@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_CSV(t *testing.T) {
+	doc := "Name,external_id,specialization\n" +
+		"Dr. Grey,g-1,Surgery\n" +
+		"Dr. House,,Diagnostics\n" +
+		"Dr. Shepherd,g-1,Neurosurgery\n" +
+		"Dr. Short,s-1\n" +
+		"\"Wilson, James\",w-1,Oncology\n"
+
+	rows, errs, err := Parse(strings.NewReader(doc), CSV)
+	require.NoError(t, err)
+	assert.Equal(t, []Row{
+		{Line: 2, ExternalID: "g-1", Name: "Dr. Grey", Specialization: "Surgery"},
+		{Line: 6, ExternalID: "w-1", Name: "Wilson, James", Specialization: "Oncology"},
+	}, rows)
+
+	require.Len(t, errs, 3)
+	assert.Equal(t, RowError{Line: 3, Field: "external_id", Message: "external_id is required"}, errs[0])
+	assert.Equal(t, RowError{Line: 4, ExternalID: "g-1", Field: "external_id", Message: "duplicates row 2"}, errs[1])
+	assert.Equal(t, 5, errs[2].Line)
+
+	_, _, err = Parse(strings.NewReader("name,specialization\nDr. Grey,Surgery\n"), CSV)
+	assert.Error(t, err, "the external_id column is required")
+}
+
+func TestParse_JSON(t *testing.T) {
+	doc := `[
+		{"external_id": "g-1", "name": "Dr. Grey", "specialization": "Surgery"},
+		{"external_id": "h-1", "name": "Dr. House", "speciality": "Diagnostics"},
+		{"external_id": "w-1", "name": "Dr. Wilson"}
+	]`
+
+	rows, errs, err := Parse(strings.NewReader(doc), JSON)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "g-1", rows[0].ExternalID)
+
+	require.Len(t, errs, 2)
+	assert.Equal(t, 2, errs[0].Line)
+	assert.Contains(t, errs[0].Message, "speciality")
+	assert.Equal(t, "specialization", errs[1].Field)
+
+	_, _, err = Parse(strings.NewReader(`{"name": "Dr. Grey"}`), JSON)
+	assert.Error(t, err)
+}
+
+func TestFormatOf(t *testing.T) {
+	for in, want := range map[string]Format{
+		"doctors.CSV":                     CSV,
+		"/tmp/doctors.json":               JSON,
+		"text/csv; charset=utf-8":         CSV,
+		"application/json; charset=utf-8": JSON,
+	} {
+		got, err := FormatOf(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := FormatOf("doctors.xlsx")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, Config{Format: FormatJSON, Level: "warn"})
+	require.NoError(t, err)
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	logger.InfoContext(ctx, "too quiet")
+	logger.With("user_id", 7).WarnContext(ctx, "loud enough")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &line), "only the warning is written")
+	assert.Equal(t, "loud enough", line["msg"])
+	assert.Equal(t, "req-1", line["request_id"])
+	assert.EqualValues(t, 7, line["user_id"])
+
+	out.Reset()
+	logger.Warn("no request")
+	assert.NotContains(t, out.String(), "request_id")
+
+	_, err = New(&out, Config{Format: "xml"})
+	assert.Error(t, err)
+	_, err = New(&out, Config{Level: "chatty"})
+	assert.Error(t, err)
+}
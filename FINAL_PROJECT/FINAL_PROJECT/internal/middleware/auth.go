@@ -1,65 +1,144 @@
-package middleware
-
-import (
-	"clinic-cli/internal/model"
-	"context"
-	"fmt"
-	"net/http"
-	"strings"
-
-	"github.com/golang-jwt/jwt/v5"
-)
-
-type contextKey string
-
-const UserContextKey contextKey = "user"
-
-func AuthMiddleware(secret string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Authorization header required", http.StatusUnauthorized)
-				return
-			}
-
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return []byte(secret), nil
-			})
-
-			if err != nil || !token.Valid {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
-				return
-			}
-
-			if claims, ok := token.Claims.(jwt.MapClaims); ok {
-				ctx := context.WithValue(r.Context(), UserContextKey, claims)
-				next.ServeHTTP(w, r.WithContext(ctx))
-			} else {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-			}
-		})
-	}
-}
-
-func AdminOnly(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		claims, ok := r.Context().Value(UserContextKey).(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		role, ok := claims["role"].(string)
-		if !ok || model.Role(role) != model.RoleAdmin {
-			http.Error(w, "Forbidden: Admin access required", http.StatusForbidden)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
+package middleware
+
+import (
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/problem"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type contextKey string
+
+const UserContextKey contextKey = "user"
+
+// SessionChecker reports whether the session an access token was issued for
+// is still active, so revoked sessions lose access before their tokens
+// expire.
+type SessionChecker interface {
+	SessionActive(ctx context.Context, sessionID string) (bool, error)
+}
+
+func AuthMiddleware(secret string, sessions SessionChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				problem.Write(w, r, problem.New(http.StatusUnauthorized, "Authorization header required"))
+				return
+			}
+
+			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+				}
+				return []byte(secret), nil
+			})
+
+			if err != nil || !token.Valid {
+				problem.Write(w, r, problem.New(http.StatusUnauthorized, "Invalid token"))
+				return
+			}
+
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok {
+				problem.Write(w, r, problem.New(http.StatusUnauthorized, "Invalid token claims"))
+				return
+			}
+
+			sessionID, _ := claims["sid"].(string)
+			if sessionID == "" {
+				problem.Write(w, r, problem.New(http.StatusUnauthorized, "Invalid token claims"))
+				return
+			}
+			active, err := sessions.SessionActive(r.Context(), sessionID)
+			if err != nil {
+				problem.Write(w, r, problem.New(http.StatusInternalServerError, "Failed to verify session"))
+				return
+			}
+			if !active {
+				problem.Write(w, r, problem.New(http.StatusUnauthorized, "Session has been revoked"))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), UserContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// EmailChecker reports whether a user has verified their e-mail address.
+type EmailChecker interface {
+	EmailVerified(ctx context.Context, userID int) (bool, error)
+}
+
+// RequireVerifiedEmail rejects users who have not verified their e-mail
+// address yet. It must run after AuthMiddleware.
+func RequireVerifiedEmail(users EmailChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(UserContextKey).(jwt.MapClaims)
+			if !ok {
+				problem.Write(w, r, problem.New(http.StatusUnauthorized, "Unauthorized"))
+				return
+			}
+			userID, _ := claims["sub"].(float64)
+
+			verified, err := users.EmailVerified(r.Context(), int(userID))
+			if err != nil {
+				problem.Write(w, r, problem.New(http.StatusInternalServerError, "Failed to check email verification"))
+				return
+			}
+			if !verified {
+				problem.Write(w, r, problem.New(http.StatusForbidden, "Forbidden: email address not verified"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole lets the request through only when the authenticated user has
+// one of the given roles. It must run after AuthMiddleware.
+func RequireRole(roles ...model.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(UserContextKey).(jwt.MapClaims)
+			if !ok {
+				problem.Write(w, r, problem.New(http.StatusUnauthorized, "Unauthorized"))
+				return
+			}
+
+			role, _ := claims["role"].(string)
+			for _, allowed := range roles {
+				if model.Role(role) == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			problem.Write(w, r, problem.New(http.StatusForbidden, "Forbidden: insufficient role"))
+		})
+	}
+}
+
+func AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(UserContextKey).(jwt.MapClaims)
+		if !ok {
+			problem.Write(w, r, problem.New(http.StatusUnauthorized, "Unauthorized"))
+			return
+		}
+
+		role, ok := claims["role"].(string)
+		if !ok || model.Role(role) != model.RoleAdmin {
+			problem.Write(w, r, problem.New(http.StatusForbidden, "Forbidden: Admin access required"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
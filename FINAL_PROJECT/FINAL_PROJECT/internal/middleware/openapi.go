@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"bytes"
+	"clinic-cli/internal/openapi"
+	"clinic-cli/internal/problem"
+	"clinic-cli/internal/validation"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// maxValidatedBody bounds the bodies ValidateRequest buffers. Larger bodies,
+// such as doctor imports, reach the handler unchecked so that it can apply
+// its own limit.
+const maxValidatedBody = 1 << 20
+
+// ValidateRequest rejects requests whose parameters or body do not match the
+// OpenAPI specification with 400 and the list of offending fields, or 415 for
+// an unsupported content type. Requests for routes the specification does
+// not describe pass through, so the router can answer 404 or 405.
+//
+// It belongs after authentication and role checks, so that callers without
+// access learn nothing about the expected input.
+func ValidateRequest(spec *openapi.Spec) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, params, _ := spec.Find(r.Method, r.URL.Path)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var body []byte
+			if route.Operation.RequestBody != nil {
+				buf, err := io.ReadAll(io.LimitReader(r.Body, maxValidatedBody+1))
+				if err != nil {
+					problem.Write(w, r, problem.New(http.StatusBadRequest, "Failed to read request body"))
+					return
+				}
+				if len(buf) <= maxValidatedBody {
+					body = buf
+					r.Body = io.NopCloser(bytes.NewReader(buf))
+				} else {
+					r.Body = struct {
+						io.Reader
+						io.Closer
+					}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+				}
+			}
+
+			err := route.ValidateRequest(r, params, body)
+			var unsupported *openapi.UnsupportedMediaTypeError
+			if errors.As(err, &unsupported) {
+				problem.Write(w, r, problem.New(http.StatusUnsupportedMediaType, "Unsupported content type "+unsupported.ContentType))
+				return
+			}
+			if invalid, ok := validation.As(err); ok {
+				problem.Write(w, r, problem.Invalid(invalid))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
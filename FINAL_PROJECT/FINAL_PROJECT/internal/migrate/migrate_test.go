@@ -0,0 +1,102 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+
+	"clinic-cli/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	for _, d := range []Dialect{Postgres, SQLite} {
+		migrations, err := load(files, d.dir)
+		require.NoError(t, err, d.Name)
+		require.NotEmpty(t, migrations, d.Name)
+		for i, m := range migrations {
+			assert.NotEmpty(t, m.Down, "%s migration %d has no down script", d.Name, m.Version)
+			if i > 0 {
+				assert.Greater(t, m.Version, migrations[i-1].Version)
+			}
+		}
+	}
+}
+
+func TestDialectsShareVersions(t *testing.T) {
+	pg, err := load(files, Postgres.dir)
+	require.NoError(t, err)
+	lite, err := load(files, SQLite.dir)
+	require.NoError(t, err)
+	require.Len(t, lite, len(pg))
+	for i := range pg {
+		assert.Equal(t, pg[i].Version, lite[i].Version)
+		assert.Equal(t, pg[i].Name, lite[i].Name)
+	}
+}
+
+func TestMigrator_UpDownSQLite(t *testing.T) {
+	ctx := context.Background()
+	conn, err := db.ConnectSQLite("sqlite://:memory:")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	m, err := New(conn, SQLite)
+	require.NoError(t, err)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(m.migrations))
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied, "second run must be a no-op")
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	for _, st := range statuses {
+		assert.True(t, st.Applied)
+	}
+
+	reverted, err := m.Down(ctx, len(m.migrations))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(m.migrations))
+
+	var tables int
+	require.NoError(t, conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'`).Scan(&tables))
+	assert.Zero(t, tables)
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(m.migrations), "schema must be re-creatable after a full rollback")
+}
+
+func TestMigrator_UniqueSlotCancelsDoubleBookings(t *testing.T) {
+	ctx := context.Background()
+	conn, err := db.ConnectSQLite("sqlite://:memory:")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	m, err := New(conn, SQLite)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	_, err = m.Down(ctx, len(m.migrations)-2)
+	require.NoError(t, err)
+
+	_, err = conn.Exec(`
+		INSERT INTO users (id, email, password_hash) VALUES (1, 'ann@example.com', 'x'), (2, 'bob@example.com', 'x');
+		INSERT INTO doctors (id, name, specialization) VALUES (1, 'Dr. Grey', 'Surgery');
+		INSERT INTO appointments (id, patient_id, doctor_id, time) VALUES
+			(1, 1, 1, '2030-01-07 09:00:00'), (2, 2, 1, '2030-01-07 09:00:00');`)
+	require.NoError(t, err)
+
+	_, err = m.Up(ctx)
+	require.NoError(t, err, "a double booking must not block the migration")
+	var status string
+	require.NoError(t, conn.QueryRow(`SELECT status FROM appointments WHERE id = 1`).Scan(&status))
+	assert.Equal(t, "scheduled", status)
+	require.NoError(t, conn.QueryRow(`SELECT status FROM appointments WHERE id = 2`).Scan(&status))
+	assert.Equal(t, "cancelled", status, "the later booking gives way")
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS doctor_working_hours (
+    id SERIAL PRIMARY KEY,
+    doctor_id INTEGER NOT NULL REFERENCES doctors(id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    start_time TEXT NOT NULL,
+    end_time TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_working_hours_doctor ON doctor_working_hours(doctor_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS uq_appointments_doctor_time;
@@ -0,0 +1,19 @@
+-- A doctor can hold at most one live appointment per start time; cancelled
+-- rows are kept for history and free the slot again.
+--
+-- Double bookings made before the index existed would stop it from being
+-- built: the first booking of each slot keeps it and later ones are
+-- cancelled, so the patients can be offered another time.
+UPDATE appointments SET status = 'cancelled'
+WHERE status <> 'cancelled'
+  AND EXISTS (
+    SELECT 1 FROM appointments earlier
+    WHERE earlier.doctor_id = appointments.doctor_id
+      AND earlier.time = appointments.time
+      AND earlier.status <> 'cancelled'
+      AND earlier.id < appointments.id
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_appointments_doctor_time
+    ON appointments(doctor_id, time)
+    WHERE status <> 'cancelled';
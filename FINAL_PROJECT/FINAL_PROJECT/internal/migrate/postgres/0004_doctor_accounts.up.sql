@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN doctor_id INTEGER REFERENCES doctors(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_users_doctor ON users(doctor_id);
@@ -0,0 +1,4 @@
+ALTER TABLE appointments ADD COLUMN checked_in_at TIMESTAMPTZ;
+ALTER TABLE appointments ADD COLUMN completed_at TIMESTAMPTZ;
+ALTER TABLE appointments ADD COLUMN cancelled_at TIMESTAMPTZ;
+ALTER TABLE appointments ADD COLUMN no_show_at TIMESTAMPTZ;
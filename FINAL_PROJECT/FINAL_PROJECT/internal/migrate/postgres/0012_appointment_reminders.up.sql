@@ -0,0 +1,10 @@
+-- One row per reminder queued for an appointment. The appointment time is
+-- part of the key so a rescheduled appointment is reminded again.
+CREATE TABLE IF NOT EXISTS appointment_reminders (
+    appointment_id INTEGER NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    offset_minutes INTEGER NOT NULL,
+    appointment_time TIMESTAMPTZ NOT NULL,
+    outbox_id INTEGER NOT NULL REFERENCES outbox(id),
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (appointment_id, offset_minutes, appointment_time)
+);
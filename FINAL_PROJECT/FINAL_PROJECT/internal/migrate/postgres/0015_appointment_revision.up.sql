@@ -0,0 +1,10 @@
+-- Bumped on every reschedule and status change; calendar exports use it as
+-- the iCalendar SEQUENCE. Existing rows count the changes they show.
+ALTER TABLE appointments ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;
+
+UPDATE appointments SET revision =
+    CASE WHEN previous_time IS NOT NULL THEN 1 ELSE 0 END
+    + CASE WHEN checked_in_at IS NOT NULL THEN 1 ELSE 0 END
+    + CASE WHEN completed_at IS NOT NULL THEN 1 ELSE 0 END
+    + CASE WHEN cancelled_at IS NOT NULL OR status = 'cancelled' THEN 1 ELSE 0 END
+    + CASE WHEN no_show_at IS NOT NULL THEN 1 ELSE 0 END;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS uq_users_doctor;
+
+ALTER TABLE users DROP COLUMN doctor_id;
@@ -0,0 +1 @@
+ALTER TABLE appointments ADD COLUMN previous_time DATETIME;
@@ -0,0 +1,4 @@
+ALTER TABLE appointments DROP COLUMN no_show_at;
+ALTER TABLE appointments DROP COLUMN cancelled_at;
+ALTER TABLE appointments DROP COLUMN completed_at;
+ALTER TABLE appointments DROP COLUMN checked_in_at;
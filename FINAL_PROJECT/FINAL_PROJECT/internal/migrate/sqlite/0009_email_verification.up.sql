@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME;
+
+-- Accounts created before verification existed keep working.
+UPDATE users SET email_verified_at = created_at;
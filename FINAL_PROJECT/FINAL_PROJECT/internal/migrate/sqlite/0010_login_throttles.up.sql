@@ -0,0 +1,6 @@
+-- Failed login attempts, keyed by "account:<email>" or "ip:<address>".
+CREATE TABLE IF NOT EXISTS login_throttles (
+    throttle_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at DATETIME NOT NULL
+);
@@ -0,0 +1,4 @@
+-- SHA-256 of the secret in the user's calendar feed URL.
+ALTER TABLE users ADD COLUMN calendar_token_hash TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_calendar_token ON users(calendar_token_hash);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_doctors_external_id;
+ALTER TABLE doctors DROP COLUMN external_id;
@@ -0,0 +1,4 @@
+-- Identifier of the doctor in an external system, used to upsert imports.
+ALTER TABLE doctors ADD COLUMN external_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_doctors_external_id ON doctors(external_id);
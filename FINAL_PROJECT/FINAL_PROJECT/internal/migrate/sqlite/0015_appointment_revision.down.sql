@@ -0,0 +1 @@
+ALTER TABLE appointments DROP COLUMN revision;
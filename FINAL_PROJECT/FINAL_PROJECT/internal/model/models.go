@@ -1,45 +1,238 @@
-package model
-
-import "time"
-
-type Role string
-
-const (
-	RoleAdmin   Role = "admin"
-	RolePatient Role = "patient"
-)
-
-type User struct {
-	ID           int       `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	Role         Role      `json:"role"`
-	CreatedAt    time.Time `json:"created_at"`
-}
-
-type Doctor struct {
-	ID             int       `json:"id"`
-	Name           string    `json:"name"`
-	Specialization string    `json:"specialization"`
-	CreatedAt      time.Time `json:"created_at"`
-}
-
-type AppointmentStatus string
-
-const (
-	StatusScheduled AppointmentStatus = "scheduled"
-	StatusCancelled AppointmentStatus = "cancelled"
-	StatusCompleted AppointmentStatus = "completed"
-)
-
-type Appointment struct {
-	ID        int               `json:"id"`
-	PatientID int               `json:"patient_id"`
-	DoctorID  int               `json:"doctor_id"`
-	Time      time.Time         `json:"time"`
-	Status    AppointmentStatus `json:"status"`
-	CreatedAt time.Time         `json:"created_at"`
-
-	DoctorName     string `json:"doctor_name,omitempty"`
-	Specialization string `json:"specialization,omitempty"`
-}
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Role string
+
+const (
+	RoleAdmin   Role = "admin"
+	RolePatient Role = "patient"
+	RoleDoctor  Role = "doctor"
+)
+
+// User.DoctorID links a doctor-role account to its Doctor row.
+type User struct {
+	ID           int       `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	Role         Role      `json:"role"`
+	DoctorID     *int      `json:"doctor_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+}
+
+func (u User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+type Doctor struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	Specialization string `json:"specialization"`
+	// ExternalID is set for doctors managed through bulk imports.
+	ExternalID string    `json:"external_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DoctorSort orders the doctor catalogue. A leading "-" sorts descending;
+// "created" follows creation order.
+type DoctorSort string
+
+const (
+	SortName               DoctorSort = "name"
+	SortNameDesc           DoctorSort = "-name"
+	SortSpecialization     DoctorSort = "specialization"
+	SortSpecializationDesc DoctorSort = "-specialization"
+	SortCreated            DoctorSort = "created"
+	SortCreatedDesc        DoctorSort = "-created"
+)
+
+// DoctorQuery selects one page of the catalogue. Search matches names
+// case-insensitively; Specialization must match exactly, ignoring case.
+type DoctorQuery struct {
+	Specialization string
+	Search         string
+	Sort           DoctorSort
+	Limit          int
+	// After continues a listing behind the last doctor of the previous page.
+	After *DoctorCursor
+}
+
+// DoctorCursor is the position of a doctor in a sorted listing: the
+// lower-cased sort key and the ID breaking ties.
+type DoctorCursor struct {
+	Key string `json:"k,omitempty"`
+	ID  int    `json:"id"`
+}
+
+// DoctorPage is one page of the catalogue. Total counts every doctor
+// matching the filters, not just this page.
+type DoctorPage struct {
+	Doctors    []Doctor `json:"doctors"`
+	Total      int      `json:"total"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+type AppointmentStatus string
+
+const (
+	StatusScheduled AppointmentStatus = "scheduled"
+	StatusCheckedIn AppointmentStatus = "checked_in"
+	StatusCompleted AppointmentStatus = "completed"
+	StatusCancelled AppointmentStatus = "cancelled"
+	StatusNoShow    AppointmentStatus = "no_show"
+)
+
+type Appointment struct {
+	ID        int               `json:"id"`
+	PatientID int               `json:"patient_id"`
+	DoctorID  int               `json:"doctor_id"`
+	Time      time.Time         `json:"time"`
+	Status    AppointmentStatus `json:"status"`
+	CreatedAt time.Time         `json:"created_at"`
+	// PreviousTime is set when the appointment has been rescheduled.
+	PreviousTime *time.Time `json:"previous_time,omitempty"`
+	// Lifecycle timestamps, set when the appointment enters that status.
+	CheckedInAt *time.Time `json:"checked_in_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	NoShowAt    *time.Time `json:"no_show_at,omitempty"`
+	// Revision counts the reschedules and status changes so far.
+	Revision int `json:"revision"`
+
+	DoctorName     string `json:"doctor_name,omitempty"`
+	Specialization string `json:"specialization,omitempty"`
+	PatientEmail   string `json:"patient_email,omitempty"`
+}
+
+// WorkingHours is one entry of a doctor's weekly template. Start and End are
+// wall-clock times ("HH:MM") in the clinic's time zone.
+type WorkingHours struct {
+	Weekday time.Weekday `json:"weekday"`
+	Start   string       `json:"start"`
+	End     string       `json:"end"`
+}
+
+type Slot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// AgendaDay groups a doctor's live appointments for one calendar day.
+type AgendaDay struct {
+	Date         string        `json:"date"`
+	Appointments []Appointment `json:"appointments"`
+}
+
+type Agenda struct {
+	DoctorID int         `json:"doctor_id"`
+	View     string      `json:"view"`
+	From     time.Time   `json:"from"`
+	To       time.Time   `json:"to"`
+	Days     []AgendaDay `json:"days"`
+}
+
+// Session is one signed-in device. Access tokens carry the session ID so the
+// session can be revoked server-side; RefreshHash is the SHA-256 of the
+// current refresh token, which changes on every refresh.
+type Session struct {
+	ID          string     `json:"id"`
+	UserID      int        `json:"user_id"`
+	Device      string     `json:"device"`
+	RefreshHash string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  time.Time  `json:"last_used_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the session can still be used at now.
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// LoginThrottle counts consecutive failed logins for one account or client
+// address.
+type LoginThrottle struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+}
+
+type OutboxStatus string
+
+const (
+	OutboxPending OutboxStatus = "pending"
+	OutboxSent    OutboxStatus = "sent"
+	// OutboxDead events ran out of attempts and wait for an admin replay.
+	OutboxDead OutboxStatus = "dead"
+)
+
+// Kinds of OutboxEvent. All carry an AppointmentEvent payload.
+const (
+	EventAppointmentBooked      = "appointment.booked"
+	EventAppointmentRescheduled = "appointment.rescheduled"
+	EventAppointmentReminder    = "appointment.reminder"
+)
+
+// OutboxEvent is a notification stored alongside the change it announces,
+// waiting to be delivered.
+type OutboxEvent struct {
+	ID            int             `json:"id"`
+	Kind          string          `json:"kind"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        OutboxStatus    `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error,omitempty"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+	SentAt        *time.Time      `json:"sent_at,omitempty"`
+}
+
+// AppointmentEvent records the appointment times as of the change, so a
+// delayed delivery still describes what happened. RequestID is the request
+// that made the change, for tracing its delivery in the logs.
+type AppointmentEvent struct {
+	AppointmentID int        `json:"appointment_id"`
+	Time          time.Time  `json:"time"`
+	PreviousTime  *time.Time `json:"previous_time,omitempty"`
+	RequestID     string     `json:"request_id,omitempty"`
+}
+
+// Reminder is a reminder queued OffsetMinutes before an appointment that was
+// due at AppointmentTime. SentAt is set once it has been delivered.
+type Reminder struct {
+	AppointmentID   int        `json:"appointment_id"`
+	OffsetMinutes   int        `json:"offset_minutes"`
+	AppointmentTime time.Time  `json:"appointment_time"`
+	QueuedAt        time.Time  `json:"queued_at"`
+	SentAt          *time.Time `json:"sent_at,omitempty"`
+}
+
+// Email is an outgoing message handed to the background worker.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Purposes of a UserToken.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+// UserToken is a single-use secret e-mailed to a user. Only its SHA-256 hash
+// is stored.
+type UserToken struct {
+	Hash      string
+	UserID    int
+	Purpose   string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
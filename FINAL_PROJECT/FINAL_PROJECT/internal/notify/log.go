@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+
+	"clinic-cli/internal/model"
+)
+
+// LogNotifier logs messages instead of sending them. It is meant for
+// development, where the tokens in the messages can be copied from the
+// output.
+type LogNotifier struct {
+	logger *slog.Logger
+}
+
+func NewLogNotifier(logger *slog.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) Send(ctx context.Context, msg model.Email) error {
+	if err := checkHeaders(msg); err != nil {
+		return err
+	}
+	n.logger.InfoContext(ctx, "notification", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,64 @@
+// Package notify delivers e-mail messages produced by the services through a
+// configurable transport.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"clinic-cli/internal/model"
+)
+
+// Notifier delivers a single message. Implementations must be safe for
+// concurrent use.
+type Notifier interface {
+	Send(ctx context.Context, msg model.Email) error
+}
+
+// Transports accepted by Config.Transport.
+const (
+	TransportLog     = "log"
+	TransportSMTP    = "smtp"
+	TransportWebhook = "webhook"
+)
+
+type Config struct {
+	Transport  string
+	SMTP       SMTPConfig
+	WebhookURL string
+}
+
+// New returns the Notifier for cfg.Transport. An empty transport logs
+// messages with the default logger.
+func New(cfg Config) (Notifier, error) {
+	switch cfg.Transport {
+	case "", TransportLog:
+		return NewLogNotifier(slog.Default()), nil
+	case TransportSMTP:
+		if cfg.SMTP.Host == "" || cfg.SMTP.From == "" {
+			return nil, fmt.Errorf("smtp notifier needs a host and a from address")
+		}
+		return NewSMTPNotifier(cfg.SMTP), nil
+	case TransportWebhook:
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("webhook notifier needs a URL")
+		}
+		return NewWebhookNotifier(cfg.WebhookURL, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier transport %q", cfg.Transport)
+	}
+}
+
+// checkHeaders rejects addresses and subjects that would let a value break
+// out of its header line.
+func checkHeaders(msg model.Email) error {
+	if msg.To == "" {
+		return fmt.Errorf("message has no recipient")
+	}
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("message headers must not contain line breaks")
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"clinic-cli/internal/logging"
+	"clinic-cli/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpServer is a minimal in-process SMTP server that accepts one message
+// per connection and hands its envelope and data to received.
+type smtpServer struct {
+	addr     string
+	received chan smtpMessage
+}
+
+type smtpMessage struct {
+	from, to, data string
+}
+
+func startSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	s := &smtpServer{addr: ln.Addr().String(), received: make(chan smtpMessage, 1)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var msg smtpMessage
+	reply("220 localhost ESMTP test")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		switch upper := strings.ToUpper(cmd); {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			msg.from = strings.Trim(cmd[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			msg.to = strings.Trim(cmd[len("RCPT TO:"):], "<> ")
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			msg.data = data.String()
+			s.received <- msg
+			reply("250 OK")
+		case upper == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+var confirmation = model.Email{To: "ann@example.com", Subject: "Appointment confirmed", Body: "See you on Monday.\n.\nBring your card."}
+
+func TestSMTPNotifier(t *testing.T) {
+	server := startSMTPServer(t)
+	host, port, err := net.SplitHostPort(server.addr)
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	n := NewSMTPNotifier(SMTPConfig{Host: host, Port: portNum, From: "clinic@example.com"})
+	require.NoError(t, n.Send(context.Background(), confirmation))
+
+	got := <-server.received
+	assert.Equal(t, "clinic@example.com", got.from)
+	assert.Equal(t, "ann@example.com", got.to)
+	assert.Contains(t, got.data, "Subject: Appointment confirmed\r\n")
+	// A lone dot is escaped on the wire so it does not end the message.
+	assert.Contains(t, got.data, "See you on Monday.\r\n..\r\nBring your card.\r\n")
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		if got.To == "broken@example.com" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(server.URL, server.Client())
+	require.NoError(t, n.Send(context.Background(), confirmation))
+	assert.Equal(t, webhookPayload{To: confirmation.To, Subject: confirmation.Subject, Body: confirmation.Body}, got)
+
+	assert.Error(t, n.Send(context.Background(), model.Email{To: "broken@example.com"}))
+}
+
+func TestLogNotifier(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := logging.New(&out, logging.Config{})
+	require.NoError(t, err)
+	n := NewLogNotifier(logger)
+	require.NoError(t, n.Send(logging.WithRequestID(context.Background(), "req-1"), confirmation))
+	assert.Contains(t, out.String(), "to=ann@example.com")
+	assert.Contains(t, out.String(), "request_id=req-1")
+
+	err = n.Send(context.Background(), model.Email{To: "ann@example.com", Subject: "Hi\r\nBcc: everyone@example.com"})
+	assert.Error(t, err, "header injection is rejected")
+}
+
+func TestNew(t *testing.T) {
+	n, err := New(Config{})
+	require.NoError(t, err)
+	assert.IsType(t, &LogNotifier{}, n)
+
+	_, err = New(Config{Transport: TransportSMTP})
+	assert.Error(t, err)
+	_, err = New(Config{Transport: "carrier-pigeon"})
+	assert.Error(t, err)
+
+	n, err = New(Config{Transport: TransportWebhook, WebhookURL: "http://localhost/hook"})
+	require.NoError(t, err)
+	assert.IsType(t, &WebhookNotifier{}, n)
+}
@@ -0,0 +1,350 @@
+// Package openapi holds the published OpenAPI 3 description of the REST API
+// and checks requests and responses against it.
+//
+// Only the parts of OpenAPI the document uses are understood: path, query and
+// header parameters, JSON bodies, local $refs and the schema keywords listed
+// on Schema.
+package openapi
+
+import (
+	"bytes"
+	"clinic-cli/internal/validation"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed openapi.json
+var document []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+// Document returns the raw specification as served at /openapi.json.
+func Document() []byte {
+	return document
+}
+
+// DocsPage returns an HTML page that renders the specification from
+// /openapi.json.
+func DocsPage() []byte {
+	return docsPage
+}
+
+type Spec struct {
+	OpenAPI    string                           `json:"openapi"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Parameters map[string]*Parameter `json:"parameters"`
+		Responses  map[string]*Response  `json:"responses"`
+	} `json:"components"`
+
+	routes []*Route
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref     string                `json:"$ref"`
+	Content map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Route is one operation of the specification.
+type Route struct {
+	Method    string
+	Path      string
+	Operation *Operation
+
+	pattern *regexp.Regexp
+	names   []string
+	// literal counts the characters outside {parameters}; routes with more
+	// of them are tried first, so fixed segments win over parameters.
+	literal int
+}
+
+var (
+	templateParam = regexp.MustCompile(`\{([^}/]+)\}`)
+	// quotedParam is templateParam after regexp.QuoteMeta.
+	quotedParam = regexp.MustCompile(`\\\{([^}/]+)\\\}`)
+)
+
+// Load parses the embedded specification and resolves its references.
+func Load() (*Spec, error) {
+	var s Spec
+	if err := json.Unmarshal(document, &s); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	if err := s.resolve(); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	return &s, nil
+}
+
+// MustLoad is Load for callers that cannot continue without the spec.
+func MustLoad() *Spec {
+	s, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *Spec) resolve() error {
+	for name, schema := range s.Components.Schemas {
+		if err := s.resolveSchema(schema); err != nil {
+			return fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	for path, ops := range s.Paths {
+		for method, op := range ops {
+			where := strings.ToUpper(method) + " " + path
+			for i, p := range op.Parameters {
+				if p.Ref != "" {
+					name, ok := strings.CutPrefix(p.Ref, "#/components/parameters/")
+					if !ok || s.Components.Parameters[name] == nil {
+						return fmt.Errorf("%s: unknown parameter %s", where, p.Ref)
+					}
+					op.Parameters[i] = s.Components.Parameters[name]
+				}
+				if err := s.resolveSchema(op.Parameters[i].Schema); err != nil {
+					return fmt.Errorf("%s: %w", where, err)
+				}
+			}
+			if op.RequestBody != nil {
+				for _, mt := range op.RequestBody.Content {
+					if err := s.resolveSchema(mt.Schema); err != nil {
+						return fmt.Errorf("%s: %w", where, err)
+					}
+				}
+			}
+			for status, resp := range op.Responses {
+				if resp.Ref != "" {
+					name, ok := strings.CutPrefix(resp.Ref, "#/components/responses/")
+					if !ok || s.Components.Responses[name] == nil {
+						return fmt.Errorf("%s: unknown response %s", where, resp.Ref)
+					}
+					resp = s.Components.Responses[name]
+					op.Responses[status] = resp
+				}
+				for _, mt := range resp.Content {
+					if err := s.resolveSchema(mt.Schema); err != nil {
+						return fmt.Errorf("%s: %w", where, err)
+					}
+				}
+			}
+
+			route := &Route{Method: strings.ToUpper(method), Path: path, Operation: op}
+			expr := "^" + quotedParam.ReplaceAllStringFunc(regexp.QuoteMeta(path), func(m string) string {
+				route.names = append(route.names, quotedParam.FindStringSubmatch(m)[1])
+				return "([^/]+?)"
+			}) + "$"
+			route.pattern = regexp.MustCompile(expr)
+			route.literal = len(templateParam.ReplaceAllString(path, ""))
+			s.routes = append(s.routes, route)
+		}
+	}
+	sort.Slice(s.routes, func(i, j int) bool {
+		if s.routes[i].literal != s.routes[j].literal {
+			return s.routes[i].literal > s.routes[j].literal
+		}
+		return s.routes[i].Path < s.routes[j].Path
+	})
+	return nil
+}
+
+// Routes lists every operation of the specification.
+func (s *Spec) Routes() []*Route {
+	return s.routes
+}
+
+// Find returns the operation serving method and path, with the values of its
+// path parameters. ok is false when the path is not described; route is nil
+// but ok true when the path is described for other methods only.
+func (s *Spec) Find(method, path string) (route *Route, params map[string]string, ok bool) {
+	for _, rt := range s.routes {
+		m := rt.pattern.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		ok = true
+		if rt.Method != method {
+			continue
+		}
+		params = make(map[string]string, len(rt.names))
+		for i, name := range rt.names {
+			params[name] = m[i+1]
+		}
+		return rt, params, true
+	}
+	return nil, nil, ok
+}
+
+// UnsupportedMediaTypeError is returned for bodies in a content type the
+// operation does not accept.
+type UnsupportedMediaTypeError struct {
+	ContentType string
+}
+
+func (e *UnsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("unsupported content type %q", e.ContentType)
+}
+
+// ValidateRequest checks the parameters and body of a request for route. A
+// nil body skips the body checks, for bodies too large to buffer.
+func (rt *Route) ValidateRequest(r *http.Request, params map[string]string, body []byte) error {
+	verr := &validation.Error{}
+	query := r.URL.Query()
+	for _, p := range rt.Operation.Parameters {
+		var raw string
+		var present bool
+		switch p.In {
+		case "path":
+			raw, present = params[p.Name]
+		case "query":
+			present = query.Has(p.Name)
+			raw = query.Get(p.Name)
+		case "header":
+			raw = r.Header.Get(p.Name)
+			present = raw != ""
+		}
+		if !present {
+			if p.Required {
+				verr.Addf(p.In, p.Name, "is required")
+			}
+			continue
+		}
+		value, err := p.Schema.parseParam(raw)
+		if err != nil {
+			verr.Addf(p.In, p.Name, "%v", err)
+			continue
+		}
+		p.Schema.validate(value, p.In, p.Name, verr)
+	}
+
+	if rt.Operation.RequestBody != nil && body != nil {
+		if err := rt.validateBody(r.Header.Get("Content-Type"), body, verr); err != nil {
+			return err
+		}
+	}
+	return verr.Err()
+}
+
+func (rt *Route) validateBody(contentType string, body []byte, verr *validation.Error) error {
+	rb := rt.Operation.RequestBody
+	if len(bytes.TrimSpace(body)) == 0 {
+		if rb.Required {
+			verr.Addf("body", "", "is required")
+		}
+		return nil
+	}
+
+	mediaType := "application/json"
+	if contentType != "" {
+		mt, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return &UnsupportedMediaTypeError{ContentType: contentType}
+		}
+		mediaType = mt
+	}
+	content, ok := rb.Content[mediaType]
+	if !ok {
+		return &UnsupportedMediaTypeError{ContentType: mediaType}
+	}
+	if !isJSON(mediaType) || content.Schema == nil {
+		return nil
+	}
+
+	value, err := decodeJSON(body)
+	if err != nil {
+		verr.Addf("body", "", "is not valid JSON")
+		return nil
+	}
+	content.Schema.validate(value, "body", "", verr)
+	return nil
+}
+
+// ValidateResponse checks that status is documented for route and that the
+// body matches the schema of its content type.
+func (rt *Route) ValidateResponse(status int, header http.Header, body []byte) error {
+	resp, ok := rt.Operation.Responses[strconv.Itoa(status)]
+	if !ok {
+		resp, ok = rt.Operation.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("%s %s: status %d is not documented", rt.Method, rt.Path, status)
+	}
+	if len(resp.Content) == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("%s %s: %d response has no valid content type", rt.Method, rt.Path, status)
+	}
+	content, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%s %s: %d response content type %s is not documented", rt.Method, rt.Path, status, mediaType)
+	}
+	if !isJSON(mediaType) || content.Schema == nil {
+		return nil
+	}
+
+	value, err := decodeJSON(body)
+	if err != nil {
+		return fmt.Errorf("%s %s: %d response is not valid JSON", rt.Method, rt.Path, status)
+	}
+	verr := &validation.Error{}
+	content.Schema.validate(value, "body", "", verr)
+	if err := verr.Err(); err != nil {
+		return fmt.Errorf("%s %s: %d response: %w", rt.Method, rt.Path, status, err)
+	}
+	return nil
+}
+
+// isJSON accepts application/json and structured types such as
+// application/problem+json.
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func decodeJSON(body []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("trailing data after JSON value")
+	}
+	return value, nil
+}
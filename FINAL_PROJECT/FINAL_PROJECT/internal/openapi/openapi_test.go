@@ -0,0 +1,104 @@
+package openapi
+
+import (
+	"clinic-cli/internal/validation"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpec_Find(t *testing.T) {
+	spec, err := Load()
+	require.NoError(t, err)
+
+	route, params, ok := spec.Find(http.MethodGet, "/api/v1/doctors/me/agenda")
+	require.True(t, ok)
+	assert.Equal(t, "/api/v1/doctors/me/agenda", route.Path)
+	assert.Empty(t, params)
+
+	route, params, ok = spec.Find(http.MethodGet, "/calendar/doctor/abc.ics")
+	require.True(t, ok)
+	assert.Equal(t, "/calendar/doctor/{token}.ics", route.Path)
+	assert.Equal(t, map[string]string{"token": "abc"}, params)
+
+	route, _, ok = spec.Find(http.MethodPut, "/api/v1/doctors")
+	assert.True(t, ok, "the path is described")
+	assert.Nil(t, route, "but not for PUT")
+
+	_, _, ok = spec.Find(http.MethodGet, "/api/v1/nope")
+	assert.False(t, ok)
+}
+
+func TestRoute_ValidateRequest(t *testing.T) {
+	spec, err := Load()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		want        []validation.FieldError
+	}{
+		{"valid body", http.MethodPost, "/api/v1/appointments", "", `{"doctor_id": 1, "time": "2030-01-07 09:00"}`, nil},
+		{"missing and mistyped fields", http.MethodPost, "/api/v1/appointments", "application/json", `{"doctor_id": 1.5}`, []validation.FieldError{
+			{In: "body", Field: "time", Message: "is required"},
+			{In: "body", Field: "doctor_id", Message: "must be an integer"},
+		}},
+		{"empty body", http.MethodPost, "/api/v1/auth/login", "", "", []validation.FieldError{{In: "body", Message: "is required"}}},
+		{"broken JSON", http.MethodPost, "/api/v1/auth/login", "", `{"email":`, []validation.FieldError{{In: "body", Message: "is not valid JSON"}}},
+		{"nested array items", http.MethodPut, "/api/v1/admin/doctors/1/hours", "", `[{"weekday": 1, "start": "09:00", "end": "17:00"}, {"weekday": 7, "start": "9", "end": "17:00"}]`, []validation.FieldError{
+			{In: "body", Field: "[1].start", Message: "must match ^[0-9]{2}:[0-9]{2}$"},
+			{In: "body", Field: "[1].weekday", Message: "must be at most 6"},
+		}},
+		{"email format", http.MethodPost, "/api/v1/auth/register", "", `{"email": "Ann <ann@example.com>", "password": "password123"}`, []validation.FieldError{
+			{In: "body", Field: "email", Message: "must be a valid email"},
+		}},
+		{"unknown field", http.MethodPost, "/api/v1/auth/login", "", `{"email": "ann@example.com", "password": "x", "remember": true}`, []validation.FieldError{
+			{In: "body", Field: "remember", Message: "is not a known field"},
+		}},
+		{"path parameter", http.MethodGet, "/api/v1/doctors/abc/hours", "", "", []validation.FieldError{{In: "path", Field: "id", Message: "must be an integer"}}},
+		{"query parameters", http.MethodGet, "/api/v1/doctors?sort=rating&limit=0", "", "", []validation.FieldError{
+			{In: "query", Field: "sort", Message: "must be one of name, -name, specialization, -specialization, created, -created"},
+			{In: "query", Field: "limit", Message: "must be at least 1"},
+		}},
+		{"required query parameter", http.MethodGet, "/api/v1/auth/verify", "", "", []validation.FieldError{{In: "query", Field: "token", Message: "is required"}}},
+		{"csv is not checked", http.MethodPost, "/api/v1/admin/doctors/import", "text/csv; charset=utf-8", "anything", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			route, params, _ := spec.Find(tt.method, r.URL.Path)
+			require.NotNil(t, route)
+
+			err := route.ValidateRequest(r, params, []byte(tt.body))
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			verr, ok := validation.As(err)
+			require.True(t, ok, "got %v", err)
+			assert.Equal(t, tt.want, verr.Fields)
+		})
+	}
+}
+
+func TestRoute_ValidateRequestMediaType(t *testing.T) {
+	spec, err := Load()
+	require.NoError(t, err)
+	route, params, _ := spec.Find(http.MethodPost, "/api/v1/admin/doctors/import")
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/doctors/import", strings.NewReader("<doctors/>"))
+	r.Header.Set("Content-Type", "application/xml")
+	var unsupported *UnsupportedMediaTypeError
+	assert.ErrorAs(t, route.ValidateRequest(r, params, []byte("<doctors/>")), &unsupported)
+}
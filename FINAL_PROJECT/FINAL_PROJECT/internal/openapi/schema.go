@@ -0,0 +1,277 @@
+package openapi
+
+import (
+	"clinic-cli/internal/validation"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is the subset of the OpenAPI schema object the specification uses.
+// AdditionalProperties is either false or a schema; when absent, extra
+// properties are allowed.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Nullable             bool               `json:"nullable"`
+	Enum                 []any              `json:"enum"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+
+	target  *Schema
+	pattern *regexp.Regexp
+	closed  bool
+	extra   *Schema
+}
+
+func (s *Spec) resolveSchema(schema *Schema) error {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/")
+		if !ok || s.Components.Schemas[name] == nil {
+			return fmt.Errorf("unknown schema %s", schema.Ref)
+		}
+		schema.target = s.Components.Schemas[name]
+		return nil
+	}
+	if schema.Pattern != "" {
+		re, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern %q: %w", schema.Pattern, err)
+		}
+		schema.pattern = re
+	}
+	switch raw := strings.TrimSpace(string(schema.AdditionalProperties)); raw {
+	case "", "true":
+	case "false":
+		schema.closed = true
+	default:
+		schema.extra = &Schema{}
+		if err := json.Unmarshal(schema.AdditionalProperties, schema.extra); err != nil {
+			return fmt.Errorf("additionalProperties: %w", err)
+		}
+		if err := s.resolveSchema(schema.extra); err != nil {
+			return err
+		}
+	}
+	for _, prop := range schema.Properties {
+		if err := s.resolveSchema(prop); err != nil {
+			return err
+		}
+	}
+	return s.resolveSchema(schema.Items)
+}
+
+// parseParam converts a path, query or header value to the JSON type its
+// schema expects.
+func (s *Schema) parseParam(raw string) (any, error) {
+	if s == nil {
+		return raw, nil
+	}
+	if s.target != nil {
+		return s.target.parseParam(raw)
+	}
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, fmt.Errorf("must be %s", article(s.Type))
+		}
+		return json.Number(raw), nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return b, nil
+	}
+	return raw, nil
+}
+
+// validate records in verr every way value, decoded with UseNumber, breaks
+// the schema. field is the JSON path of value, as in "hours[2].start".
+func (s *Schema) validate(value any, in, field string, verr *validation.Error) {
+	if s == nil {
+		return
+	}
+	if s.target != nil {
+		s.target.validate(value, in, field, verr)
+		return
+	}
+	if value == nil {
+		if !s.Nullable && s.Type != "" {
+			verr.Addf(in, field, "must not be null")
+		}
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			verr.Addf(in, field, "must be an object")
+			return
+		}
+		s.validateObject(obj, in, field, verr)
+		return
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			verr.Addf(in, field, "must be an array")
+			return
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			verr.Addf(in, field, "must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			verr.Addf(in, field, "must have at most %d items", *s.MaxItems)
+		}
+		for i, item := range arr {
+			s.Items.validate(item, in, fmt.Sprintf("%s[%d]", field, i), verr)
+		}
+		return
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			verr.Addf(in, field, "must be a string")
+			return
+		}
+		s.validateString(str, in, field, verr)
+	case "integer", "number":
+		num, ok := value.(json.Number)
+		if !ok {
+			verr.Addf(in, field, "must be %s", article(s.Type))
+			return
+		}
+		s.validateNumber(num, in, field, verr)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			verr.Addf(in, field, "must be a boolean")
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 && !s.allows(value) {
+		options := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			options[i] = fmt.Sprint(e)
+		}
+		verr.Addf(in, field, "must be one of %s", strings.Join(options, ", "))
+	}
+}
+
+func (s *Schema) validateObject(obj map[string]any, in, field string, verr *validation.Error) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			verr.Addf(in, join(field, name), "is required")
+		}
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := obj[name]
+		if prop, ok := s.Properties[name]; ok {
+			prop.validate(v, in, join(field, name), verr)
+			continue
+		}
+		switch {
+		case s.closed:
+			verr.Addf(in, join(field, name), "is not a known field")
+		case s.extra != nil:
+			s.extra.validate(v, in, join(field, name), verr)
+		}
+	}
+}
+
+func (s *Schema) validateString(str, in, field string, verr *validation.Error) {
+	n := utf8.RuneCountInString(str)
+	if s.MinLength != nil && n < *s.MinLength {
+		if *s.MinLength == 1 {
+			verr.Addf(in, field, "must not be empty")
+		} else {
+			verr.Addf(in, field, "must be at least %d characters", *s.MinLength)
+		}
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		verr.Addf(in, field, "must be at most %d characters", *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		verr.Addf(in, field, "must match %s", s.Pattern)
+	}
+
+	var err error
+	switch s.Format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, str)
+	case "date":
+		_, err = time.Parse("2006-01-02", str)
+	case "email":
+		err = validation.Email(str)
+	}
+	if err != nil {
+		verr.Addf(in, field, "must be a valid %s", s.Format)
+	}
+}
+
+func (s *Schema) validateNumber(num json.Number, in, field string, verr *validation.Error) {
+	f, err := num.Float64()
+	if err != nil {
+		verr.Addf(in, field, "must be %s", article(s.Type))
+		return
+	}
+	if s.Type == "integer" {
+		if _, err := num.Int64(); err != nil {
+			verr.Addf(in, field, "must be an integer")
+			return
+		}
+	}
+	if s.Minimum != nil && f < *s.Minimum {
+		verr.Addf(in, field, "must be at least %v", *s.Minimum)
+	}
+	if s.Maximum != nil && f > *s.Maximum {
+		verr.Addf(in, field, "must be at most %v", *s.Maximum)
+	}
+}
+
+func (s *Schema) allows(value any) bool {
+	for _, e := range s.Enum {
+		if fmt.Sprint(e) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// article prefixes a JSON type name for messages such as "must be an integer".
+func article(typ string) string {
+	if typ == "integer" || typ == "object" || typ == "array" {
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
@@ -0,0 +1,43 @@
+// Package problem writes error responses as RFC 7807 problem details, so that
+// every failure of the API has the same shape whichever layer produced it.
+package problem
+
+import (
+	"clinic-cli/internal/validation"
+	"encoding/json"
+	"net/http"
+)
+
+const ContentType = "application/problem+json"
+
+// Details is an RFC 7807 problem. Fields is an extension listing each
+// offending parameter or body field of a 400.
+type Details struct {
+	Type     string                  `json:"type"`
+	Title    string                  `json:"title"`
+	Status   int                     `json:"status"`
+	Detail   string                  `json:"detail,omitempty"`
+	Instance string                  `json:"instance,omitempty"`
+	Fields   []validation.FieldError `json:"fields,omitempty"`
+}
+
+// New describes a problem that needs no type of its own beyond its status.
+func New(status int, detail string) *Details {
+	return &Details{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// Invalid is the 400 for input that failed validation.
+func Invalid(err *validation.Error) *Details {
+	p := New(http.StatusBadRequest, err.Message)
+	p.Fields = err.Fields
+	return p
+}
+
+// Write sends p as the response, naming the request path as its instance.
+func Write(w http.ResponseWriter, r *http.Request, p *Details) {
+	p.Instance = r.URL.Path
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,827 @@
+package repository
+
+import (
+	"clinic-cli/internal/importer"
+	"clinic-cli/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore holds the tables shared by the in-memory repositories so that
+// appointments can resolve doctor details the same way the SQL joins do.
+type memoryStore struct {
+	mu           sync.RWMutex
+	users        map[int]model.User
+	doctors      map[int]model.Doctor
+	appointments map[int]model.Appointment
+	workingHours map[int][]model.WorkingHours
+	sessions     map[string]model.Session
+	userTokens   map[string]model.UserToken
+	throttles    map[string]model.LoginThrottle
+	outbox       map[int]model.OutboxEvent
+	reminders    map[reminderKey]memoryReminder
+	// calendarTokens maps feed token hashes to user IDs.
+	calendarTokens map[string]int
+	lastID         map[string]int
+}
+
+func (s *memoryStore) nextID(table string) int {
+	s.lastID[table]++
+	return s.lastID[table]
+}
+
+// reminderKey mirrors the primary key of appointment_reminders.
+type reminderKey struct {
+	appointmentID int
+	offsetMinutes int
+	at            int64
+}
+
+type memoryReminder struct {
+	model.Reminder
+	outboxID int
+}
+
+// enqueue adds a pending outbox event and returns its ID. The caller must hold
+// s.mu, which makes the event part of the same change as in the SQL backends.
+func (s *memoryStore) enqueue(ctx context.Context, kind, payload string) int {
+	now := time.Now().UTC()
+	id := s.nextID("outbox")
+	s.outbox[id] = model.OutboxEvent{
+		ID:            id,
+		Kind:          kind,
+		Payload:       json.RawMessage(payload),
+		Status:        model.OutboxPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	slog.DebugContext(ctx, "outbox event queued", "event_id", id, "kind", kind)
+	return id
+}
+
+// NewMemoryRegistry returns repositories backed by process memory. They are
+// safe for concurrent use and intended for tests and throwaway demos.
+func NewMemoryRegistry() *Registry {
+	store := &memoryStore{
+		users:          make(map[int]model.User),
+		doctors:        make(map[int]model.Doctor),
+		appointments:   make(map[int]model.Appointment),
+		workingHours:   make(map[int][]model.WorkingHours),
+		sessions:       make(map[string]model.Session),
+		userTokens:     make(map[string]model.UserToken),
+		throttles:      make(map[string]model.LoginThrottle),
+		outbox:         make(map[int]model.OutboxEvent),
+		reminders:      make(map[reminderKey]memoryReminder),
+		calendarTokens: make(map[string]int),
+		lastID:         make(map[string]int),
+	}
+	return &Registry{
+		User:          &MemoryUserRepository{store: store},
+		Doctor:        &MemoryDoctorRepository{store: store},
+		Appointment:   &MemoryAppointmentRepository{store: store},
+		Session:       &MemorySessionRepository{store: store},
+		UserToken:     &MemoryUserTokenRepository{store: store},
+		LoginThrottle: &MemoryLoginThrottleRepository{store: store},
+		Outbox:        &MemoryOutboxRepository{store: store},
+		Reminder:      &MemoryReminderRepository{store: store},
+	}
+}
+
+type MemoryUserRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, email, passwordHash string, role model.Role) (*model.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, u := range r.store.users {
+		if u.Email == email {
+			return nil, ErrEmailTaken
+		}
+	}
+
+	user := model.User{
+		ID:           r.store.nextID("users"),
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         role,
+		CreatedAt:    time.Now().UTC(),
+	}
+	r.store.users[user.ID] = user
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, u := range r.store.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id int) (*model.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	u, ok := r.store.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &u, nil
+}
+
+func (r *MemoryUserRepository) CreateDoctorAccount(ctx context.Context, email, passwordHash string, doctorID int) (*model.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.doctors[doctorID]; !ok {
+		return nil, ErrNotFound
+	}
+	for _, u := range r.store.users {
+		if u.Email == email {
+			return nil, ErrEmailTaken
+		}
+		if u.DoctorID != nil && *u.DoctorID == doctorID {
+			return nil, ErrDoctorAlreadyLinked
+		}
+	}
+
+	user := model.User{
+		ID:           r.store.nextID("users"),
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         model.RoleDoctor,
+		DoctorID:     &doctorID,
+		CreatedAt:    time.Now().UTC(),
+	}
+	r.store.users[user.ID] = user
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) MarkEmailVerified(ctx context.Context, userID int, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userID]
+	if !ok || user.EmailVerifiedAt != nil {
+		return nil
+	}
+	user.EmailVerifiedAt = &at
+	r.store.users[userID] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) SetCalendarToken(ctx context.Context, userID int, tokenHash string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[userID]; !ok {
+		return fmt.Errorf("failed to set calendar token: user %d does not exist", userID)
+	}
+	for hash, id := range r.store.calendarTokens {
+		if id == userID {
+			delete(r.store.calendarTokens, hash)
+		}
+	}
+	r.store.calendarTokens[tokenHash] = userID
+	return nil
+}
+
+func (r *MemoryUserRepository) GetByCalendarToken(ctx context.Context, tokenHash string) (*model.User, error) {
+	r.store.mu.RLock()
+	id, ok := r.store.calendarTokens[tokenHash]
+	r.store.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.GetByID(ctx, id)
+}
+
+func (r *MemoryUserRepository) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userID]
+	if !ok {
+		return fmt.Errorf("failed to update password: user %d does not exist", userID)
+	}
+	user.PasswordHash = passwordHash
+	r.store.users[userID] = user
+	return nil
+}
+
+type MemoryDoctorRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryDoctorRepository) Create(ctx context.Context, name, specialization string) (*model.Doctor, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	doc := model.Doctor{
+		ID:             r.store.nextID("doctors"),
+		Name:           name,
+		Specialization: specialization,
+		CreatedAt:      time.Now().UTC(),
+	}
+	r.store.doctors[doc.ID] = doc
+	return &doc, nil
+}
+
+func (r *MemoryDoctorRepository) Import(ctx context.Context, rows []importer.Row) ([]importer.Result, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	byExternalID := make(map[string]int)
+	for _, d := range r.store.doctors {
+		if d.ExternalID != "" {
+			byExternalID[d.ExternalID] = d.ID
+		}
+	}
+
+	results := make([]importer.Result, 0, len(rows))
+	for _, row := range rows {
+		res := importer.Result{Line: row.Line, ExternalID: row.ExternalID}
+		doc, ok := r.store.doctors[byExternalID[row.ExternalID]]
+		if !ok {
+			doc = model.Doctor{ID: r.store.nextID("doctors"), ExternalID: row.ExternalID, CreatedAt: time.Now().UTC()}
+			byExternalID[row.ExternalID] = doc.ID
+			res.Created = true
+		}
+		doc.Name = row.Name
+		doc.Specialization = row.Specialization
+		r.store.doctors[doc.ID] = doc
+		res.DoctorID = doc.ID
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func (r *MemoryDoctorRepository) Search(ctx context.Context, q model.DoctorQuery) ([]model.Doctor, int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	search := FoldCase(q.Search)
+	var doctors []model.Doctor
+	for _, d := range r.store.doctors {
+		if q.Specialization != "" && FoldCase(d.Specialization) != FoldCase(q.Specialization) {
+			continue
+		}
+		if !strings.Contains(FoldCase(d.Name), search) {
+			continue
+		}
+		doctors = append(doctors, d)
+	}
+	total := len(doctors)
+
+	desc := strings.HasPrefix(string(q.Sort), "-")
+	// before reports whether a sorts ahead of b.
+	before := func(aKey string, aID int, bKey string, bID int) bool {
+		if aKey != bKey {
+			return (aKey < bKey) != desc
+		}
+		if aID == bID {
+			return false
+		}
+		return (aID < bID) != desc
+	}
+	sort.Slice(doctors, func(i, j int) bool {
+		return before(DoctorSortKey(doctors[i], q.Sort), doctors[i].ID, DoctorSortKey(doctors[j], q.Sort), doctors[j].ID)
+	})
+	if q.After != nil {
+		doctors = slices.DeleteFunc(doctors, func(d model.Doctor) bool {
+			return !before(q.After.Key, q.After.ID, DoctorSortKey(d, q.Sort), d.ID)
+		})
+	}
+	if q.Limit > 0 && len(doctors) > q.Limit {
+		doctors = doctors[:q.Limit]
+	}
+	return doctors, total, nil
+}
+
+func (r *MemoryDoctorRepository) GetByID(ctx context.Context, id int) (*model.Doctor, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	d, ok := r.store.doctors[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &d, nil
+}
+
+func (r *MemoryDoctorRepository) GetWorkingHours(ctx context.Context, doctorID int) ([]model.WorkingHours, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return append([]model.WorkingHours(nil), r.store.workingHours[doctorID]...), nil
+}
+
+func (r *MemoryDoctorRepository) SetWorkingHours(ctx context.Context, doctorID int, hours []model.WorkingHours) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.doctors[doctorID]; !ok {
+		return fmt.Errorf("failed to save working hours: doctor %d does not exist", doctorID)
+	}
+	sorted := append([]model.WorkingHours(nil), hours...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Weekday != sorted[j].Weekday {
+			return sorted[i].Weekday < sorted[j].Weekday
+		}
+		return sorted[i].Start < sorted[j].Start
+	})
+	r.store.workingHours[doctorID] = sorted
+	return nil
+}
+
+type MemoryAppointmentRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryAppointmentRepository) Create(ctx context.Context, patientID, doctorID int, at time.Time) (*model.Appointment, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[patientID]; !ok {
+		return nil, fmt.Errorf("patient %d does not exist", patientID)
+	}
+	if _, ok := r.store.doctors[doctorID]; !ok {
+		return nil, fmt.Errorf("doctor %d does not exist", doctorID)
+	}
+	for _, a := range r.store.appointments {
+		if a.DoctorID == doctorID && a.Time.Equal(at) && a.Status != model.StatusCancelled {
+			return nil, ErrSlotTaken
+		}
+	}
+
+	app := model.Appointment{
+		ID:        r.store.nextID("appointments"),
+		PatientID: patientID,
+		DoctorID:  doctorID,
+		Time:      at,
+		Status:    model.StatusScheduled,
+		CreatedAt: time.Now().UTC(),
+	}
+	r.store.appointments[app.ID] = app
+	r.store.enqueue(ctx, model.EventAppointmentBooked, appointmentEventPayload(ctx, app.ID, at, nil))
+	return &app, nil
+}
+
+func (r *MemoryAppointmentRepository) GetByID(ctx context.Context, id int) (*model.Appointment, error) {
+	apps := r.filter(func(a model.Appointment) bool { return a.ID == id })
+	if len(apps) == 0 {
+		return nil, ErrNotFound
+	}
+	return &apps[0], nil
+}
+
+func (r *MemoryAppointmentRepository) GetByPatientID(ctx context.Context, patientID int) ([]model.Appointment, error) {
+	return r.filter(func(a model.Appointment) bool { return a.PatientID == patientID }), nil
+}
+
+func (r *MemoryAppointmentRepository) GetByDoctorID(ctx context.Context, doctorID int, from, to time.Time) ([]model.Appointment, error) {
+	from, to = rangeBounds(from, to)
+	return r.filter(func(a model.Appointment) bool {
+		return a.DoctorID == doctorID && !a.Time.Before(from) && a.Time.Before(to)
+	}), nil
+}
+
+func (r *MemoryAppointmentRepository) Reschedule(ctx context.Context, id, doctorID int, at time.Time) (*model.Appointment, error) {
+	r.store.mu.Lock()
+	app, ok := r.store.appointments[id]
+	if !ok || app.Status != model.StatusScheduled {
+		r.store.mu.Unlock()
+		return nil, ErrNotScheduled
+	}
+	if _, ok := r.store.doctors[doctorID]; !ok {
+		r.store.mu.Unlock()
+		return nil, fmt.Errorf("doctor %d does not exist", doctorID)
+	}
+	for _, a := range r.store.appointments {
+		if a.ID != id && a.DoctorID == doctorID && a.Time.Equal(at) && a.Status != model.StatusCancelled {
+			r.store.mu.Unlock()
+			return nil, ErrSlotTaken
+		}
+	}
+	previous := app.Time
+	app.PreviousTime = &previous
+	app.DoctorID = doctorID
+	app.Time = at
+	app.Revision++
+	r.store.appointments[id] = app
+	r.store.enqueue(ctx, model.EventAppointmentRescheduled, appointmentEventPayload(ctx, id, at, &previous))
+	r.store.mu.Unlock()
+
+	return r.GetByID(ctx, id)
+}
+
+func (r *MemoryAppointmentRepository) UpdateStatus(ctx context.Context, id int, from, to model.AppointmentStatus, at time.Time) error {
+	if _, err := statusColumn(to); err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	app, ok := r.store.appointments[id]
+	if !ok || app.Status != from {
+		return ErrStatusChanged
+	}
+	app.Status = to
+	app.Revision++
+	switch to {
+	case model.StatusCheckedIn:
+		app.CheckedInAt = &at
+	case model.StatusCompleted:
+		app.CompletedAt = &at
+	case model.StatusCancelled:
+		app.CancelledAt = &at
+	case model.StatusNoShow:
+		app.NoShowAt = &at
+	}
+	r.store.appointments[id] = app
+	return nil
+}
+
+func (r *MemoryAppointmentRepository) Cancel(ctx context.Context, id int) (bool, error) {
+	err := r.UpdateStatus(ctx, id, model.StatusScheduled, model.StatusCancelled, time.Now().UTC())
+	if errors.Is(err, ErrStatusChanged) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// filter returns matching appointments joined with their doctor, ordered by time.
+func (r *MemoryAppointmentRepository) filter(match func(model.Appointment) bool) []model.Appointment {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var apps []model.Appointment
+	for _, a := range r.store.appointments {
+		if !match(a) {
+			continue
+		}
+		if d, ok := r.store.doctors[a.DoctorID]; ok {
+			a.DoctorName = d.Name
+			a.Specialization = d.Specialization
+		}
+		if u, ok := r.store.users[a.PatientID]; ok {
+			a.PatientEmail = u.Email
+		}
+		apps = append(apps, a)
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if apps[i].Time.Equal(apps[j].Time) {
+			return apps[i].ID < apps[j].ID
+		}
+		return apps[i].Time.Before(apps[j].Time)
+	})
+	return apps
+}
+
+type MemorySessionRepository struct {
+	store *memoryStore
+}
+
+func (r *MemorySessionRepository) Create(ctx context.Context, session *model.Session) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[session.UserID]; !ok {
+		return fmt.Errorf("failed to create session: user %d does not exist", session.UserID)
+	}
+	if _, ok := r.store.sessions[session.ID]; ok {
+		return fmt.Errorf("failed to create session: duplicate id %q", session.ID)
+	}
+	r.store.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *MemorySessionRepository) GetByID(ctx context.Context, id string) (*model.Session, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	s, ok := r.store.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (r *MemorySessionRepository) ListByUser(ctx context.Context, userID int) ([]model.Session, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var sessions []model.Session
+	for _, s := range r.store.sessions {
+		if s.UserID == userID && s.RevokedAt == nil {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+func (r *MemorySessionRepository) Rotate(ctx context.Context, id, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	s, ok := r.store.sessions[id]
+	if !ok || s.RevokedAt != nil || s.RefreshHash != oldHash {
+		return false, nil
+	}
+	s.RefreshHash = newHash
+	s.LastUsedAt = usedAt
+	s.ExpiresAt = expiresAt
+	r.store.sessions[id] = s
+	return true, nil
+}
+
+func (r *MemorySessionRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if s, ok := r.store.sessions[id]; ok && s.RevokedAt == nil {
+		s.RevokedAt = &at
+		r.store.sessions[id] = s
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) RevokeAllForUser(ctx context.Context, userID int, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, s := range r.store.sessions {
+		if s.UserID == userID && s.RevokedAt == nil {
+			s.RevokedAt = &at
+			r.store.sessions[id] = s
+		}
+	}
+	return nil
+}
+
+type MemoryUserTokenRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryUserTokenRepository) Create(ctx context.Context, token *model.UserToken) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[token.UserID]; !ok {
+		return fmt.Errorf("failed to create token: user %d does not exist", token.UserID)
+	}
+	if _, ok := r.store.userTokens[token.Hash]; ok {
+		return fmt.Errorf("failed to create token: duplicate hash")
+	}
+	r.store.userTokens[token.Hash] = *token
+	return nil
+}
+
+func (r *MemoryUserTokenRepository) Consume(ctx context.Context, hash, purpose string, at time.Time) (*model.UserToken, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	t, ok := r.store.userTokens[hash]
+	if !ok || t.Purpose != purpose || t.UsedAt != nil {
+		return nil, nil
+	}
+	t.UsedAt = &at
+	r.store.userTokens[hash] = t
+	return &t, nil
+}
+
+func (r *MemoryUserTokenRepository) InvalidateForUser(ctx context.Context, userID int, purpose string, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for hash, t := range r.store.userTokens {
+		if t.UserID == userID && t.Purpose == purpose && t.UsedAt == nil {
+			t.UsedAt = &at
+			r.store.userTokens[hash] = t
+		}
+	}
+	return nil
+}
+
+type MemoryLoginThrottleRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryLoginThrottleRepository) Get(ctx context.Context, key string) (*model.LoginThrottle, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	t, ok := r.store.throttles[key]
+	if !ok {
+		return nil, nil
+	}
+	return &t, nil
+}
+
+func (r *MemoryLoginThrottleRepository) RecordFailure(ctx context.Context, key string, at, forgetBefore time.Time) (*model.LoginThrottle, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	t := r.store.throttles[key]
+	if t.LastFailureAt.Before(forgetBefore) {
+		t.Failures = 0
+	}
+	t.Key = key
+	t.Failures++
+	t.LastFailureAt = at
+	r.store.throttles[key] = t
+	return &t, nil
+}
+
+func (r *MemoryLoginThrottleRepository) Reset(ctx context.Context, key string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.throttles, key)
+	return nil
+}
+
+type MemoryOutboxRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryOutboxRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	events := []model.OutboxEvent{}
+	for _, e := range r.store.outbox {
+		if e.Status == model.OutboxPending && !e.NextAttemptAt.After(now) {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	for i := range events {
+		events[i].NextAttemptAt = leaseUntil
+		r.store.outbox[events[i].ID] = events[i]
+	}
+	return events, nil
+}
+
+func (r *MemoryOutboxRepository) MarkSent(ctx context.Context, id int, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if e, ok := r.store.outbox[id]; ok {
+		e.Status = model.OutboxSent
+		e.SentAt = &at
+		r.store.outbox[id] = e
+	}
+	return nil
+}
+
+func (r *MemoryOutboxRepository) Fail(ctx context.Context, id int, lastErr string, retryAt time.Time, dead bool) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	e, ok := r.store.outbox[id]
+	if !ok {
+		return nil
+	}
+	e.Attempts++
+	e.LastError = lastErr
+	e.NextAttemptAt = retryAt
+	if dead {
+		e.Status = model.OutboxDead
+	}
+	r.store.outbox[id] = e
+	return nil
+}
+
+func (r *MemoryOutboxRepository) Get(ctx context.Context, id int) (*model.OutboxEvent, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	e, ok := r.store.outbox[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &e, nil
+}
+
+func (r *MemoryOutboxRepository) List(ctx context.Context, status model.OutboxStatus, limit int) ([]model.OutboxEvent, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	events := []model.OutboxEvent{}
+	for _, e := range r.store.outbox {
+		if status == "" || e.Status == status {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID > events[j].ID })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (r *MemoryOutboxRepository) Replay(ctx context.Context, id int, at time.Time) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	e, ok := r.store.outbox[id]
+	if !ok || e.Status != model.OutboxDead {
+		return false, nil
+	}
+	e.Status = model.OutboxPending
+	e.Attempts = 0
+	e.NextAttemptAt = at
+	r.store.outbox[id] = e
+	return true, nil
+}
+
+type MemoryReminderRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryReminderRepository) Due(ctx context.Context, offset time.Duration, from, to time.Time, limit int) ([]model.Appointment, error) {
+	minutes := int(offset / time.Minute)
+	apps := (&MemoryAppointmentRepository{store: r.store}).filter(func(a model.Appointment) bool {
+		if a.Status != model.StatusScheduled || !a.Time.After(from) || a.Time.After(to) {
+			return false
+		}
+		_, queued := r.store.reminders[reminderKey{a.ID, minutes, a.Time.UnixNano()}]
+		return !queued
+	})
+	if len(apps) > limit {
+		apps = apps[:limit]
+	}
+	return apps, nil
+}
+
+func (r *MemoryReminderRepository) Queue(ctx context.Context, app model.Appointment, offset time.Duration, at time.Time) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	key := reminderKey{app.ID, int(offset / time.Minute), app.Time.UnixNano()}
+	if _, ok := r.store.reminders[key]; ok {
+		return false, nil
+	}
+	if _, ok := r.store.appointments[app.ID]; !ok {
+		return false, fmt.Errorf("appointment %d does not exist", app.ID)
+	}
+	outboxID := r.store.enqueue(ctx, model.EventAppointmentReminder, appointmentEventPayload(ctx, app.ID, app.Time, nil))
+	r.store.reminders[key] = memoryReminder{
+		Reminder: model.Reminder{
+			AppointmentID:   app.ID,
+			OffsetMinutes:   key.offsetMinutes,
+			AppointmentTime: app.Time.UTC(),
+			QueuedAt:        at,
+		},
+		outboxID: outboxID,
+	}
+	return true, nil
+}
+
+func (r *MemoryReminderRepository) ListByAppointment(ctx context.Context, appointmentID int) ([]model.Reminder, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	reminders := []model.Reminder{}
+	for _, rem := range r.store.reminders {
+		if rem.AppointmentID != appointmentID {
+			continue
+		}
+		rem.SentAt = r.store.outbox[rem.outboxID].SentAt
+		reminders = append(reminders, rem.Reminder)
+	}
+	sortReminders(reminders)
+	return reminders, nil
+}
+
+// sortReminders orders reminders the way the SQL backends list them: by
+// appointment time, earliest reminder first.
+func sortReminders(reminders []model.Reminder) {
+	sort.Slice(reminders, func(i, j int) bool {
+		a, b := reminders[i], reminders[j]
+		if !a.AppointmentTime.Equal(b.AppointmentTime) {
+			return a.AppointmentTime.Before(b.AppointmentTime)
+		}
+		return a.OffsetMinutes > b.OffsetMinutes
+	})
+}
@@ -0,0 +1,14 @@
+package repository_test
+
+import (
+	"testing"
+
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/repository/repositorytest"
+)
+
+func TestMemoryRepositories(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) *repository.Registry {
+		return repository.NewMemoryRegistry()
+	})
+}
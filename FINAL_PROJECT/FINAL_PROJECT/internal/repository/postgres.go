@@ -1,173 +1,752 @@
-package repository
-
-import (
-	"clinic-cli/internal/model"
-	"context"
-	"errors"
-	"fmt"
-	"time"
-
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
-)
-
-type PostgresUserRepository struct {
-	pool *pgxpool.Pool
-}
-
-func NewPostgresUserRepository(pool *pgxpool.Pool) *PostgresUserRepository {
-	return &PostgresUserRepository{pool: pool}
-}
-
-func (r *PostgresUserRepository) Create(ctx context.Context, email, passwordHash string, role model.Role) (*model.User, error) {
-	query := `INSERT INTO users (email, password_hash, role) VALUES ($1, $2, $3) RETURNING id, created_at`
-	user := &model.User{
-		Email:        email,
-		PasswordHash: passwordHash,
-		Role:         role,
-	}
-	err := r.pool.QueryRow(ctx, query, email, passwordHash, role).Scan(&user.ID, &user.CreatedAt)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
-	}
-	return user, nil
-}
-
-func (r *PostgresUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
-	query := `SELECT id, email, password_hash, role, created_at FROM users WHERE email = $1`
-	user := &model.User{}
-	err := r.pool.QueryRow(ctx, query, email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
-	}
-	return user, nil
-}
-
-func (r *PostgresUserRepository) GetByID(ctx context.Context, id int) (*model.User, error) {
-	query := `SELECT id, email, password_hash, role, created_at FROM users WHERE id = $1`
-	user := &model.User{}
-	err := r.pool.QueryRow(ctx, query, id).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
-	}
-	return user, nil
-}
-
-type PostgresDoctorRepository struct {
-	pool *pgxpool.Pool
-}
-
-func NewPostgresDoctorRepository(pool *pgxpool.Pool) *PostgresDoctorRepository {
-	return &PostgresDoctorRepository{pool: pool}
-}
-
-func (r *PostgresDoctorRepository) Create(ctx context.Context, name, specialization string) (*model.Doctor, error) {
-	query := `INSERT INTO doctors (name, specialization) VALUES ($1, $2) RETURNING id, created_at`
-	doc := &model.Doctor{Name: name, Specialization: specialization}
-	err := r.pool.QueryRow(ctx, query, name, specialization).Scan(&doc.ID, &doc.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return doc, nil
-}
-
-func (r *PostgresDoctorRepository) GetAll(ctx context.Context) ([]model.Doctor, error) {
-	query := `SELECT id, name, specialization, created_at FROM doctors`
-	rows, err := r.pool.Query(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var doctors []model.Doctor
-	for rows.Next() {
-		var d model.Doctor
-		if err := rows.Scan(&d.ID, &d.Name, &d.Specialization, &d.CreatedAt); err != nil {
-			return nil, err
-		}
-		doctors = append(doctors, d)
-	}
-	return doctors, nil
-}
-
-func (r *PostgresDoctorRepository) GetByID(ctx context.Context, id int) (*model.Doctor, error) {
-	query := `SELECT id, name, specialization, created_at FROM doctors WHERE id = $1`
-	doc := &model.Doctor{}
-	err := r.pool.QueryRow(ctx, query, id).Scan(&doc.ID, &doc.Name, &doc.Specialization, &doc.CreatedAt)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-	return doc, nil
-}
-
-type PostgresAppointmentRepository struct {
-	pool *pgxpool.Pool
-}
-
-func NewPostgresAppointmentRepository(pool *pgxpool.Pool) *PostgresAppointmentRepository {
-	return &PostgresAppointmentRepository{pool: pool}
-}
-
-func (r *PostgresAppointmentRepository) Create(ctx context.Context, patientID, doctorID int, timeStr string) (*model.Appointment, error) {
-	parsedTime, err := time.Parse("2006-01-02 15:04", timeStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid time format: %w", err)
-	}
-
-	query := `INSERT INTO appointments (patient_id, doctor_id, time, status) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
-	app := &model.Appointment{
-		PatientID: patientID,
-		DoctorID:  doctorID,
-		Time:      parsedTime,
-		Status:    model.StatusScheduled,
-	}
-	err = r.pool.QueryRow(ctx, query, patientID, doctorID, parsedTime, model.StatusScheduled).Scan(&app.ID, &app.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return app, nil
-}
-
-func (r *PostgresAppointmentRepository) GetByPatientID(ctx context.Context, patientID int) ([]model.Appointment, error) {
-	query := `
-		SELECT a.id, a.patient_id, a.doctor_id, a.time, a.status, a.created_at, d.name, d.specialization
-		FROM appointments a
-		JOIN doctors d ON a.doctor_id = d.id
-		WHERE a.patient_id = $1
-		ORDER BY a.time ASC
-	`
-	rows, err := r.pool.Query(ctx, query, patientID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var apps []model.Appointment
-	for rows.Next() {
-		var a model.Appointment
-		if err := rows.Scan(&a.ID, &a.PatientID, &a.DoctorID, &a.Time, &a.Status, &a.CreatedAt, &a.DoctorName, &a.Specialization); err != nil {
-			return nil, err
-		}
-		apps = append(apps, a)
-	}
-	return apps, nil
-}
-
-func (r *PostgresAppointmentRepository) GetByDoctorID(ctx context.Context, doctorID int) ([]model.Appointment, error) {
-	return nil, nil
-}
-
-func (r *PostgresAppointmentRepository) Cancel(ctx context.Context, id int) error {
-	query := `UPDATE appointments SET status = $1 WHERE id = $2`
-	_, err := r.pool.Exec(ctx, query, model.StatusCancelled, id)
-	return err
-}
+package repository
+
+import (
+	"clinic-cli/internal/importer"
+	"clinic-cli/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NewPostgresRegistry returns every repository backed by the given pool.
+func NewPostgresRegistry(pool *pgxpool.Pool) *Registry {
+	return &Registry{
+		User:          NewPostgresUserRepository(pool),
+		Doctor:        NewPostgresDoctorRepository(pool),
+		Appointment:   NewPostgresAppointmentRepository(pool),
+		Session:       NewPostgresSessionRepository(pool),
+		UserToken:     NewPostgresUserTokenRepository(pool),
+		LoginThrottle: NewPostgresLoginThrottleRepository(pool),
+		Outbox:        NewPostgresOutboxRepository(pool),
+		Reminder:      NewPostgresReminderRepository(pool),
+	}
+}
+
+type PostgresUserRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresUserRepository(pool *pgxpool.Pool) *PostgresUserRepository {
+	return &PostgresUserRepository{pool: pool}
+}
+
+func (r *PostgresUserRepository) Create(ctx context.Context, email, passwordHash string, role model.Role) (*model.User, error) {
+	query := `INSERT INTO users (email, password_hash, role) VALUES ($1, $2, $3) RETURNING id, created_at`
+	user := &model.User{
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         role,
+	}
+	err := r.pool.QueryRow(ctx, query, email, passwordHash, role).Scan(&user.ID, &user.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+func (r *PostgresUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	user, err := scanUser(r.pool.QueryRow(ctx, userSelect+` WHERE email = $1`, email))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+func (r *PostgresUserRepository) GetByID(ctx context.Context, id int) (*model.User, error) {
+	user, err := scanUser(r.pool.QueryRow(ctx, userSelect+` WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+func (r *PostgresUserRepository) CreateDoctorAccount(ctx context.Context, email, passwordHash string, doctorID int) (*model.User, error) {
+	query := `INSERT INTO users (email, password_hash, role, doctor_id) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	user := &model.User{
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         model.RoleDoctor,
+		DoctorID:     &doctorID,
+	}
+	err := r.pool.QueryRow(ctx, query, email, passwordHash, model.RoleDoctor, doctorID).Scan(&user.ID, &user.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "23505" && pgErr.ConstraintName == "uq_users_doctor":
+			return nil, ErrDoctorAlreadyLinked
+		case pgErr.Code == "23505":
+			return nil, ErrEmailTaken
+		case pgErr.Code == "23503":
+			return nil, ErrNotFound
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create doctor account: %w", err)
+	}
+	return user, nil
+}
+
+func (r *PostgresUserRepository) MarkEmailVerified(ctx context.Context, userID int, at time.Time) error {
+	query := `UPDATE users SET email_verified_at = $1 WHERE id = $2 AND email_verified_at IS NULL`
+	if _, err := r.pool.Exec(ctx, query, at, userID); err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update password: user %d does not exist", userID)
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) SetCalendarToken(ctx context.Context, userID int, tokenHash string) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE users SET calendar_token_hash = $1 WHERE id = $2`, tokenHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set calendar token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set calendar token: user %d does not exist", userID)
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) GetByCalendarToken(ctx context.Context, tokenHash string) (*model.User, error) {
+	user, err := scanUser(r.pool.QueryRow(ctx, userSelect+` WHERE calendar_token_hash = $1`, tokenHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+type PostgresDoctorRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresDoctorRepository(pool *pgxpool.Pool) *PostgresDoctorRepository {
+	return &PostgresDoctorRepository{pool: pool}
+}
+
+func (r *PostgresDoctorRepository) Create(ctx context.Context, name, specialization string) (*model.Doctor, error) {
+	query := `INSERT INTO doctors (name, specialization) VALUES ($1, $2) RETURNING id, created_at`
+	doc := &model.Doctor{Name: name, Specialization: specialization}
+	err := r.pool.QueryRow(ctx, query, name, specialization).Scan(&doc.ID, &doc.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (r *PostgresDoctorRepository) Search(ctx context.Context, q model.DoctorQuery) ([]model.Doctor, int, error) {
+	filter, page, order, filterArgs, args := doctorSearch(q, func(n int) string { return fmt.Sprintf("$%d", n) }, ` COLLATE "C"`)
+
+	var total int
+	if err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM doctors WHERE `+filter, filterArgs...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := doctorSelect + ` WHERE ` + page + ` ORDER BY ` + order
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var doctors []model.Doctor
+	for rows.Next() {
+		d, err := scanDoctor(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		doctors = append(doctors, d)
+	}
+	return doctors, total, rows.Err()
+}
+
+func (r *PostgresDoctorRepository) GetByID(ctx context.Context, id int) (*model.Doctor, error) {
+	query := `SELECT id, name, specialization, COALESCE(external_id, ''), created_at FROM doctors WHERE id = $1`
+	doc := &model.Doctor{}
+	err := r.pool.QueryRow(ctx, query, id).Scan(&doc.ID, &doc.Name, &doc.Specialization, &doc.ExternalID, &doc.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (r *PostgresDoctorRepository) Import(ctx context.Context, rows []importer.Row) ([]importer.Result, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// xmax is zero for a freshly inserted row and set when the conflict
+	// branch updated an existing one.
+	query := `
+		INSERT INTO doctors (name, specialization, external_id) VALUES ($1, $2, $3)
+		ON CONFLICT (external_id) DO UPDATE SET name = excluded.name, specialization = excluded.specialization
+		RETURNING id, xmax = 0
+	`
+	results := make([]importer.Result, 0, len(rows))
+	for _, row := range rows {
+		res := importer.Result{Line: row.Line, ExternalID: row.ExternalID}
+		err := tx.QueryRow(ctx, query, row.Name, row.Specialization, row.ExternalID).Scan(&res.DoctorID, &res.Created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import row %d: %w", row.Line, err)
+		}
+		results = append(results, res)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *PostgresDoctorRepository) GetWorkingHours(ctx context.Context, doctorID int) ([]model.WorkingHours, error) {
+	query := `SELECT weekday, start_time, end_time FROM doctor_working_hours WHERE doctor_id = $1 ORDER BY weekday, start_time`
+	rows, err := r.pool.Query(ctx, query, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hours []model.WorkingHours
+	for rows.Next() {
+		var h model.WorkingHours
+		if err := rows.Scan(&h.Weekday, &h.Start, &h.End); err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+	return hours, rows.Err()
+}
+
+func (r *PostgresDoctorRepository) SetWorkingHours(ctx context.Context, doctorID int, hours []model.WorkingHours) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM doctor_working_hours WHERE doctor_id = $1`, doctorID); err != nil {
+		return err
+	}
+	for _, h := range hours {
+		_, err := tx.Exec(ctx, `INSERT INTO doctor_working_hours (doctor_id, weekday, start_time, end_time) VALUES ($1, $2, $3, $4)`,
+			doctorID, int(h.Weekday), h.Start, h.End)
+		if err != nil {
+			return fmt.Errorf("failed to save working hours: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+type PostgresAppointmentRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresAppointmentRepository(pool *pgxpool.Pool) *PostgresAppointmentRepository {
+	return &PostgresAppointmentRepository{pool: pool}
+}
+
+func (r *PostgresAppointmentRepository) Create(ctx context.Context, patientID, doctorID int, at time.Time) (*model.Appointment, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The partial unique index on (doctor_id, time) arbitrates concurrent
+	// bookings: the loser inserts nothing and gets no row back.
+	query := `
+		INSERT INTO appointments (patient_id, doctor_id, time, status) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (doctor_id, time) WHERE status <> 'cancelled' DO NOTHING
+		RETURNING id, created_at
+	`
+	app := &model.Appointment{
+		PatientID: patientID,
+		DoctorID:  doctorID,
+		Time:      at,
+		Status:    model.StatusScheduled,
+	}
+	err = tx.QueryRow(ctx, query, patientID, doctorID, at, model.StatusScheduled).Scan(&app.ID, &app.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSlotTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = postgresEnqueue(ctx, tx, model.EventAppointmentBooked, appointmentEventPayload(ctx, app.ID, at, nil))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func (r *PostgresAppointmentRepository) GetByID(ctx context.Context, id int) (*model.Appointment, error) {
+	a, err := scanAppointment(r.pool.QueryRow(ctx, appointmentSelect+`WHERE a.id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *PostgresAppointmentRepository) GetByPatientID(ctx context.Context, patientID int) ([]model.Appointment, error) {
+	return r.list(ctx, appointmentSelect+`WHERE a.patient_id = $1 ORDER BY a.time ASC`, patientID)
+}
+
+func (r *PostgresAppointmentRepository) GetByDoctorID(ctx context.Context, doctorID int, from, to time.Time) ([]model.Appointment, error) {
+	from, to = rangeBounds(from, to)
+	return r.list(ctx, appointmentSelect+`WHERE a.doctor_id = $1 AND a.time >= $2 AND a.time < $3 ORDER BY a.time ASC`, doctorID, from, to)
+}
+
+func (r *PostgresAppointmentRepository) list(ctx context.Context, query string, args ...any) ([]model.Appointment, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var apps []model.Appointment
+	for rows.Next() {
+		a, err := scanAppointment(rows)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, a)
+	}
+	return apps, rows.Err()
+}
+
+func (r *PostgresAppointmentRepository) Reschedule(ctx context.Context, id, doctorID int, at time.Time) (*model.Appointment, error) {
+	// previous_time = time reads the row's value from before the update. The
+	// partial unique index rejects the move if the target slot is booked.
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE appointments SET previous_time = time, doctor_id = $1, time = $2, revision = revision + 1
+		WHERE id = $3 AND status = $4
+		RETURNING previous_time
+	`
+	var previous time.Time
+	err = tx.QueryRow(ctx, query, doctorID, at, id, model.StatusScheduled).Scan(&previous)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrSlotTaken
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotScheduled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reschedule appointment: %w", err)
+	}
+	_, err = postgresEnqueue(ctx, tx, model.EventAppointmentRescheduled, appointmentEventPayload(ctx, id, at, &previous))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return r.GetByID(ctx, id)
+}
+
+func (r *PostgresAppointmentRepository) UpdateStatus(ctx context.Context, id int, from, to model.AppointmentStatus, at time.Time) error {
+	column, err := statusColumn(to)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`UPDATE appointments SET status = $1, %s = $2, revision = revision + 1 WHERE id = $3 AND status = $4`, column)
+	tag, err := r.pool.Exec(ctx, query, to, at, id, from)
+	if err != nil {
+		return fmt.Errorf("failed to update appointment status: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrStatusChanged
+	}
+	return nil
+}
+
+func (r *PostgresAppointmentRepository) Cancel(ctx context.Context, id int) (bool, error) {
+	err := r.UpdateStatus(ctx, id, model.StatusScheduled, model.StatusCancelled, time.Now().UTC())
+	if errors.Is(err, ErrStatusChanged) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type PostgresSessionRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresSessionRepository(pool *pgxpool.Pool) *PostgresSessionRepository {
+	return &PostgresSessionRepository{pool: pool}
+}
+
+func (r *PostgresSessionRepository) Create(ctx context.Context, session *model.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, device, refresh_hash, created_at, last_used_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.pool.Exec(ctx, query, session.ID, session.UserID, session.Device, session.RefreshHash,
+		session.CreatedAt, session.LastUsedAt, session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresSessionRepository) GetByID(ctx context.Context, id string) (*model.Session, error) {
+	query := `
+		SELECT id, user_id, device, refresh_hash, created_at, last_used_at, expires_at, revoked_at
+		FROM sessions WHERE id = $1
+	`
+	var s model.Session
+	err := r.pool.QueryRow(ctx, query, id).Scan(&s.ID, &s.UserID, &s.Device, &s.RefreshHash,
+		&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *PostgresSessionRepository) ListByUser(ctx context.Context, userID int) ([]model.Session, error) {
+	query := `
+		SELECT id, user_id, device, refresh_hash, created_at, last_used_at, expires_at, revoked_at
+		FROM sessions WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY last_used_at DESC
+	`
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []model.Session
+	for rows.Next() {
+		var s model.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Device, &s.RefreshHash,
+			&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *PostgresSessionRepository) Rotate(ctx context.Context, id, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error) {
+	query := `
+		UPDATE sessions SET refresh_hash = $1, last_used_at = $2, expires_at = $3
+		WHERE id = $4 AND refresh_hash = $5 AND revoked_at IS NULL
+	`
+	tag, err := r.pool.Exec(ctx, query, newHash, usedAt, expiresAt, id, oldHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate session: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PostgresSessionRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	_, err := r.pool.Exec(ctx, query, at, id)
+	return err
+}
+
+func (r *PostgresSessionRepository) RevokeAllForUser(ctx context.Context, userID int, at time.Time) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+	_, err := r.pool.Exec(ctx, query, at, userID)
+	return err
+}
+
+type PostgresUserTokenRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresUserTokenRepository(pool *pgxpool.Pool) *PostgresUserTokenRepository {
+	return &PostgresUserTokenRepository{pool: pool}
+}
+
+func (r *PostgresUserTokenRepository) Create(ctx context.Context, token *model.UserToken) error {
+	query := `INSERT INTO user_tokens (token_hash, user_id, purpose, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.pool.Exec(ctx, query, token.Hash, token.UserID, token.Purpose, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresUserTokenRepository) Consume(ctx context.Context, hash, purpose string, at time.Time) (*model.UserToken, error) {
+	query := `
+		UPDATE user_tokens SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL
+		RETURNING token_hash, user_id, purpose, created_at, expires_at, used_at
+	`
+	var t model.UserToken
+	err := r.pool.QueryRow(ctx, query, at, hash, purpose).
+		Scan(&t.Hash, &t.UserID, &t.Purpose, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *PostgresUserTokenRepository) InvalidateForUser(ctx context.Context, userID int, purpose string, at time.Time) error {
+	query := `UPDATE user_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL`
+	_, err := r.pool.Exec(ctx, query, at, userID, purpose)
+	return err
+}
+
+type PostgresLoginThrottleRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresLoginThrottleRepository(pool *pgxpool.Pool) *PostgresLoginThrottleRepository {
+	return &PostgresLoginThrottleRepository{pool: pool}
+}
+
+func (r *PostgresLoginThrottleRepository) Get(ctx context.Context, key string) (*model.LoginThrottle, error) {
+	query := `SELECT throttle_key, failures, last_failure_at FROM login_throttles WHERE throttle_key = $1`
+	var t model.LoginThrottle
+	err := r.pool.QueryRow(ctx, query, key).Scan(&t.Key, &t.Failures, &t.LastFailureAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login throttle: %w", err)
+	}
+	return &t, nil
+}
+
+func (r *PostgresLoginThrottleRepository) RecordFailure(ctx context.Context, key string, at, forgetBefore time.Time) (*model.LoginThrottle, error) {
+	query := `
+		INSERT INTO login_throttles (throttle_key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (throttle_key) DO UPDATE
+		SET failures = CASE WHEN login_throttles.last_failure_at < $3 THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING throttle_key, failures, last_failure_at
+	`
+	var t model.LoginThrottle
+	err := r.pool.QueryRow(ctx, query, key, at, forgetBefore).Scan(&t.Key, &t.Failures, &t.LastFailureAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+	return &t, nil
+}
+
+func (r *PostgresLoginThrottleRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM login_throttles WHERE throttle_key = $1`, key)
+	return err
+}
+
+// postgresEnqueue writes an outbox event inside tx, so it is only delivered
+// if the change it announces commits. It returns the event's ID.
+func postgresEnqueue(ctx context.Context, tx pgx.Tx, kind, payload string) (int, error) {
+	var id int
+	err := tx.QueryRow(ctx, `INSERT INTO outbox (kind, payload) VALUES ($1, $2) RETURNING id`, kind, payload).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue %s event: %w", kind, err)
+	}
+	slog.DebugContext(ctx, "outbox event queued", "event_id", id, "kind", kind)
+	return id, nil
+}
+
+type PostgresOutboxRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresOutboxRepository(pool *pgxpool.Pool) *PostgresOutboxRepository {
+	return &PostgresOutboxRepository{pool: pool}
+}
+
+func (r *PostgresOutboxRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error) {
+	// SKIP LOCKED lets several dispatchers claim disjoint batches.
+	query := `
+		UPDATE outbox SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE status = $2 AND next_attempt_at <= $3
+			ORDER BY id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, status, attempts, last_error, next_attempt_at, created_at, sent_at
+	`
+	events, err := r.list(ctx, query, leaseUntil, model.OutboxPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (r *PostgresOutboxRepository) MarkSent(ctx context.Context, id int, at time.Time) error {
+	_, err := r.pool.Exec(ctx, `UPDATE outbox SET status = $1, sent_at = $2 WHERE id = $3`, model.OutboxSent, at, id)
+	return err
+}
+
+func (r *PostgresOutboxRepository) Fail(ctx context.Context, id int, lastErr string, retryAt time.Time, dead bool) error {
+	status := model.OutboxPending
+	if dead {
+		status = model.OutboxDead
+	}
+	query := `UPDATE outbox SET status = $1, attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $4`
+	_, err := r.pool.Exec(ctx, query, status, lastErr, retryAt, id)
+	return err
+}
+
+func (r *PostgresOutboxRepository) Get(ctx context.Context, id int) (*model.OutboxEvent, error) {
+	e, err := scanOutboxEvent(r.pool.QueryRow(ctx, outboxSelect+` WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *PostgresOutboxRepository) List(ctx context.Context, status model.OutboxStatus, limit int) ([]model.OutboxEvent, error) {
+	return r.list(ctx, outboxSelect+` WHERE $1 = '' OR status = $1 ORDER BY id DESC LIMIT $2`, status, limit)
+}
+
+func (r *PostgresOutboxRepository) Replay(ctx context.Context, id int, at time.Time) (bool, error) {
+	query := `UPDATE outbox SET status = $1, attempts = 0, next_attempt_at = $2 WHERE id = $3 AND status = $4`
+	tag, err := r.pool.Exec(ctx, query, model.OutboxPending, at, id, model.OutboxDead)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PostgresOutboxRepository) list(ctx context.Context, query string, args ...any) ([]model.OutboxEvent, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.OutboxEvent{}
+	for rows.Next() {
+		e, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+type PostgresReminderRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresReminderRepository(pool *pgxpool.Pool) *PostgresReminderRepository {
+	return &PostgresReminderRepository{pool: pool}
+}
+
+func (r *PostgresReminderRepository) Due(ctx context.Context, offset time.Duration, from, to time.Time, limit int) ([]model.Appointment, error) {
+	query := appointmentSelect + `
+		WHERE a.status = $1 AND a.time > $2 AND a.time <= $3
+		AND NOT EXISTS (
+			SELECT 1 FROM appointment_reminders r
+			WHERE r.appointment_id = a.id AND r.offset_minutes = $4 AND r.appointment_time = a.time
+		)
+		ORDER BY a.time ASC, a.id ASC
+		LIMIT $5
+	`
+	apps := &PostgresAppointmentRepository{pool: r.pool}
+	return apps.list(ctx, query, model.StatusScheduled, from, to, int(offset/time.Minute), limit)
+}
+
+func (r *PostgresReminderRepository) Queue(ctx context.Context, app model.Appointment, offset time.Duration, at time.Time) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	outboxID, err := postgresEnqueue(ctx, tx, model.EventAppointmentReminder, appointmentEventPayload(ctx, app.ID, app.Time, nil))
+	if err != nil {
+		return false, err
+	}
+	query := `
+		INSERT INTO appointment_reminders (appointment_id, offset_minutes, appointment_time, outbox_id, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+	`
+	tag, err := tx.Exec(ctx, query, app.ID, int(offset/time.Minute), app.Time, outboxID, at)
+	if err != nil {
+		return false, fmt.Errorf("failed to record reminder: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		// Already queued: the rollback discards the duplicate event.
+		return false, nil
+	}
+	return true, tx.Commit(ctx)
+}
+
+func (r *PostgresReminderRepository) ListByAppointment(ctx context.Context, appointmentID int) ([]model.Reminder, error) {
+	query := reminderSelect + `WHERE r.appointment_id = $1 ORDER BY r.appointment_time ASC, r.offset_minutes DESC`
+	rows, err := r.pool.Query(ctx, query, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []model.Reminder{}
+	for rows.Next() {
+		rem, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, rem)
+	}
+	return reminders, rows.Err()
+}
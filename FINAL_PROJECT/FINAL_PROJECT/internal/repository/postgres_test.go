@@ -0,0 +1,47 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"clinic-cli/internal/db"
+	"clinic-cli/internal/migrate"
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/repository/repositorytest"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// TestPostgresRepositories runs against a real server when TEST_DATABASE_URL
+// is set; the schema is migrated once and the tables are truncated before
+// every case.
+func TestPostgresRepositories(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	database, err := db.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(database.Close)
+
+	m, err := migrate.New(stdlib.OpenDBFromPool(database.Pool), migrate.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	repositorytest.Run(t, func(t *testing.T) *repository.Registry {
+		_, err := database.Pool.Exec(context.Background(),
+			`TRUNCATE appointment_reminders, outbox, login_throttles, user_tokens, sessions, appointments, doctors, users RESTART IDENTITY CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repository.NewPostgresRegistry(database.Pool)
+	})
+}
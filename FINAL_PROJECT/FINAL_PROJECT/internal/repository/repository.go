@@ -1,31 +1,364 @@
-package repository
-
-import (
-	"clinic-cli/internal/model"
-	"context"
-)
-
-type UserRepository interface {
-	Create(ctx context.Context, email, passwordHash string, role model.Role) (*model.User, error)
-	GetByEmail(ctx context.Context, email string) (*model.User, error)
-	GetByID(ctx context.Context, id int) (*model.User, error)
-}
-
-type DoctorRepository interface {
-	Create(ctx context.Context, name, specialization string) (*model.Doctor, error)
-	GetAll(ctx context.Context) ([]model.Doctor, error)
-	GetByID(ctx context.Context, id int) (*model.Doctor, error)
-}
-
-type AppointmentRepository interface {
-	Create(ctx context.Context, patientID, doctorID int, timeStr string) (*model.Appointment, error)
-	GetByPatientID(ctx context.Context, patientID int) ([]model.Appointment, error)
-	GetByDoctorID(ctx context.Context, doctorID int) ([]model.Appointment, error)
-	Cancel(ctx context.Context, id int) error
-}
-
-type Registry struct {
-	User        UserRepository
-	Doctor      DoctorRepository
-	Appointment AppointmentRepository
-}
+package repository
+
+import (
+	"clinic-cli/internal/apperr"
+	"clinic-cli/internal/importer"
+	"clinic-cli/internal/logging"
+	"clinic-cli/internal/model"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by lookups of a single record that does not exist.
+var ErrNotFound = apperr.New(apperr.ErrNotFound, "record not found")
+
+// ErrEmailTaken is returned by UserRepository.Create when another account
+// already uses the address.
+var ErrEmailTaken = apperr.New(apperr.ErrConflict, "email address already registered")
+
+// ErrSlotTaken is returned by AppointmentRepository.Create when the doctor
+// already has a live (non-cancelled) appointment at that time.
+var ErrSlotTaken = apperr.New(apperr.ErrConflict, "slot already taken")
+
+// ErrNotScheduled is returned by AppointmentRepository.Reschedule when the
+// appointment does not exist or is no longer in the scheduled state.
+var ErrNotScheduled = apperr.New(apperr.ErrConflict, "appointment is not scheduled")
+
+// ErrStatusChanged is returned by status updates when the appointment is
+// missing or no longer in the expected status, e.g. after a concurrent update.
+var ErrStatusChanged = apperr.New(apperr.ErrConflict, "appointment status changed")
+
+// ErrDoctorAlreadyLinked is returned by UserRepository.CreateDoctorAccount
+// when the doctor already has an account.
+var ErrDoctorAlreadyLinked = apperr.New(apperr.ErrConflict, "doctor already has an account")
+
+type UserRepository interface {
+	// Create returns ErrEmailTaken if the address is already registered.
+	Create(ctx context.Context, email, passwordHash string, role model.Role) (*model.User, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	GetByID(ctx context.Context, id int) (*model.User, error)
+	// CreateDoctorAccount creates a user with the doctor role linked to
+	// doctorID in a single step. It returns ErrEmailTaken or
+	// ErrDoctorAlreadyLinked on a clash, and ErrNotFound if the doctor does
+	// not exist.
+	CreateDoctorAccount(ctx context.Context, email, passwordHash string, doctorID int) (*model.User, error)
+	UpdatePassword(ctx context.Context, userID int, passwordHash string) error
+	// MarkEmailVerified records when the user confirmed their address. It
+	// keeps the first timestamp if the address is already verified.
+	MarkEmailVerified(ctx context.Context, userID int, at time.Time) error
+	// SetCalendarToken replaces the hash of the user's calendar feed secret,
+	// which invalidates the previous feed URL.
+	SetCalendarToken(ctx context.Context, userID int, tokenHash string) error
+	// GetByCalendarToken returns the user owning the feed secret, or
+	// ErrNotFound.
+	GetByCalendarToken(ctx context.Context, tokenHash string) (*model.User, error)
+}
+
+type DoctorRepository interface {
+	Create(ctx context.Context, name, specialization string) (*model.Doctor, error)
+	// Search returns up to q.Limit doctors matching q in its sort order, and
+	// how many match in total regardless of paging.
+	Search(ctx context.Context, q model.DoctorQuery) ([]model.Doctor, int, error)
+	GetByID(ctx context.Context, id int) (*model.Doctor, error)
+	GetWorkingHours(ctx context.Context, doctorID int) ([]model.WorkingHours, error)
+	// SetWorkingHours replaces the doctor's whole weekly template.
+	SetWorkingHours(ctx context.Context, doctorID int, hours []model.WorkingHours) error
+	// Import creates each row's doctor, or updates the one with the same
+	// external ID, in a single transaction: either every row is applied or
+	// none is. Results are in row order.
+	Import(ctx context.Context, rows []importer.Row) ([]importer.Result, error)
+}
+
+type AppointmentRepository interface {
+	Create(ctx context.Context, patientID, doctorID int, at time.Time) (*model.Appointment, error)
+	GetByID(ctx context.Context, id int) (*model.Appointment, error)
+	GetByPatientID(ctx context.Context, patientID int) ([]model.Appointment, error)
+	// GetByDoctorID returns the doctor's appointments with patient details,
+	// restricted to [from, to); a zero bound leaves that side open.
+	GetByDoctorID(ctx context.Context, doctorID int, from, to time.Time) ([]model.Appointment, error)
+	// Reschedule moves a scheduled appointment to another doctor and/or time
+	// in one statement, remembering the time it was moved from. It returns
+	// ErrSlotTaken if the target slot is booked and ErrNotScheduled if the
+	// appointment cannot be moved.
+	Reschedule(ctx context.Context, id, doctorID int, at time.Time) (*model.Appointment, error)
+	// UpdateStatus moves the appointment from one status to another and stamps
+	// the matching *_at column with at. It returns ErrStatusChanged unless the
+	// appointment is currently in status from.
+	UpdateStatus(ctx context.Context, id int, from, to model.AppointmentStatus, at time.Time) error
+	// Cancel cancels a scheduled appointment and reports whether it did; it
+	// returns false if the appointment is missing or not scheduled.
+	Cancel(ctx context.Context, id int) (bool, error)
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *model.Session) error
+	GetByID(ctx context.Context, id string) (*model.Session, error)
+	// ListByUser returns the user's sessions that have not been revoked,
+	// most recently used first. Expired sessions are included.
+	ListByUser(ctx context.Context, userID int) ([]model.Session, error)
+	// Rotate swaps the refresh hash of a live session, but only if it still
+	// matches oldHash, and reports whether it did. A false result for an
+	// existing session means an old refresh token was replayed.
+	Rotate(ctx context.Context, id, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error)
+	Revoke(ctx context.Context, id string, at time.Time) error
+	RevokeAllForUser(ctx context.Context, userID int, at time.Time) error
+}
+
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *model.UserToken) error
+	// Consume marks the unused token with this hash and purpose as used and
+	// returns it, or nil if there is no such token. Only one of several
+	// concurrent callers gets the token. Expiry is left to the caller.
+	Consume(ctx context.Context, hash, purpose string, at time.Time) (*model.UserToken, error)
+	// InvalidateForUser uses up every outstanding token of the user for purpose.
+	InvalidateForUser(ctx context.Context, userID int, purpose string, at time.Time) error
+}
+
+type LoginThrottleRepository interface {
+	// Get returns the throttle for key, or nil if it has no failures.
+	Get(ctx context.Context, key string) (*model.LoginThrottle, error)
+	// RecordFailure atomically adds one failure at the given time and returns
+	// the updated throttle. Earlier failures are forgotten first if the last
+	// of them was before forgetBefore.
+	RecordFailure(ctx context.Context, key string, at, forgetBefore time.Time) (*model.LoginThrottle, error)
+	// Reset forgets every failure recorded for key.
+	Reset(ctx context.Context, key string) error
+}
+
+type OutboxRepository interface {
+	// ClaimDue leases up to limit pending events that are due at now, oldest
+	// first, by moving their next attempt to leaseUntil. An event whose
+	// dispatcher dies mid-delivery is therefore retried once the lease ends.
+	ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error)
+	MarkSent(ctx context.Context, id int, at time.Time) error
+	// Fail counts a failed attempt. The event is retried at retryAt, or moved
+	// to the dead state when dead is set.
+	Fail(ctx context.Context, id int, lastErr string, retryAt time.Time, dead bool) error
+	Get(ctx context.Context, id int) (*model.OutboxEvent, error)
+	// List returns up to limit events in the given status, or in any status
+	// when status is empty, newest first.
+	List(ctx context.Context, status model.OutboxStatus, limit int) ([]model.OutboxEvent, error)
+	// Replay makes a dead event pending again with a fresh set of attempts,
+	// due at at. It reports false if the event is not dead.
+	Replay(ctx context.Context, id int, at time.Time) (bool, error)
+}
+
+type ReminderRepository interface {
+	// Due lists scheduled appointments starting in (from, to] that have no
+	// reminder at offset yet for their current time, soonest first.
+	Due(ctx context.Context, offset time.Duration, from, to time.Time, limit int) ([]model.Appointment, error)
+	// Queue records the reminder and enqueues its notification in one
+	// transaction. It reports false if the reminder was already queued.
+	Queue(ctx context.Context, app model.Appointment, offset time.Duration, at time.Time) (bool, error)
+	// ListByAppointment returns every reminder queued for the appointment.
+	ListByAppointment(ctx context.Context, appointmentID int) ([]model.Reminder, error)
+}
+
+type Registry struct {
+	User          UserRepository
+	Doctor        DoctorRepository
+	Appointment   AppointmentRepository
+	Session       SessionRepository
+	UserToken     UserTokenRepository
+	LoginThrottle LoginThrottleRepository
+	Outbox        OutboxRepository
+	Reminder      ReminderRepository
+}
+
+var (
+	openRangeStart = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+	openRangeEnd   = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+)
+
+// rangeBounds substitutes far-away instants for zero bounds so queries can
+// always filter with a plain half-open range.
+func rangeBounds(from, to time.Time) (time.Time, time.Time) {
+	if from.IsZero() {
+		from = openRangeStart
+	}
+	if to.IsZero() {
+		to = openRangeEnd
+	}
+	return from.UTC(), to.UTC()
+}
+
+// userSelect is shared by the SQL backends; rows must be read with scanUser.
+const userSelect = `SELECT id, email, password_hash, role, doctor_id, created_at, email_verified_at FROM users`
+
+func scanUser(row rowScanner) (*model.User, error) {
+	user := &model.User{}
+	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.DoctorID, &user.CreatedAt, &user.EmailVerifiedAt)
+	return user, err
+}
+
+// appointmentSelect is shared by the SQL backends; rows must be read with
+// scanAppointment, which expects exactly these columns.
+const appointmentSelect = `
+	SELECT a.id, a.patient_id, a.doctor_id, a.time, a.status, a.created_at, a.previous_time,
+		a.checked_in_at, a.completed_at, a.cancelled_at, a.no_show_at, a.revision,
+		d.name, d.specialization, u.email
+	FROM appointments a
+	JOIN doctors d ON a.doctor_id = d.id
+	JOIN users u ON a.patient_id = u.id
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAppointment(row rowScanner) (model.Appointment, error) {
+	var a model.Appointment
+	err := row.Scan(&a.ID, &a.PatientID, &a.DoctorID, &a.Time, &a.Status, &a.CreatedAt, &a.PreviousTime,
+		&a.CheckedInAt, &a.CompletedAt, &a.CancelledAt, &a.NoShowAt, &a.Revision,
+		&a.DoctorName, &a.Specialization, &a.PatientEmail)
+	return a, err
+}
+
+const outboxSelect = `SELECT id, kind, payload, status, attempts, last_error, next_attempt_at, created_at, sent_at FROM outbox`
+
+func scanOutboxEvent(row rowScanner) (model.OutboxEvent, error) {
+	var e model.OutboxEvent
+	var payload string
+	err := row.Scan(&e.ID, &e.Kind, &payload, &e.Status, &e.Attempts, &e.LastError, &e.NextAttemptAt, &e.CreatedAt, &e.SentAt)
+	e.Payload = json.RawMessage(payload)
+	return e, err
+}
+
+// appointmentEventPayload encodes the payload of the outbox event written
+// with an appointment change, naming the request in ctx that made it.
+func appointmentEventPayload(ctx context.Context, id int, at time.Time, previous *time.Time) string {
+	event := model.AppointmentEvent{AppointmentID: id, Time: at.UTC(), RequestID: logging.RequestID(ctx)}
+	if previous != nil {
+		p := previous.UTC()
+		event.PreviousTime = &p
+	}
+	payload, _ := json.Marshal(event)
+	return string(payload)
+}
+
+const reminderSelect = `
+	SELECT r.appointment_id, r.offset_minutes, r.appointment_time, r.created_at, o.sent_at
+	FROM appointment_reminders r
+	JOIN outbox o ON r.outbox_id = o.id
+`
+
+func scanReminder(row rowScanner) (model.Reminder, error) {
+	var rem model.Reminder
+	err := row.Scan(&rem.AppointmentID, &rem.OffsetMinutes, &rem.AppointmentTime, &rem.QueuedAt, &rem.SentAt)
+	return rem, err
+}
+
+const doctorSelect = `SELECT id, name, specialization, COALESCE(external_id, ''), created_at FROM doctors`
+
+func scanDoctor(row rowScanner) (model.Doctor, error) {
+	var d model.Doctor
+	err := row.Scan(&d.ID, &d.Name, &d.Specialization, &d.ExternalID, &d.CreatedAt)
+	return d, err
+}
+
+// doctorSortKeys maps each sort to the column it orders by; an empty column
+// orders by ID alone.
+var doctorSortKeys = map[model.DoctorSort]string{
+	model.SortName:               "name",
+	model.SortNameDesc:           "name",
+	model.SortSpecialization:     "specialization",
+	model.SortSpecializationDesc: "specialization",
+	model.SortCreated:            "",
+	model.SortCreatedDesc:        "",
+}
+
+// DoctorSortKey returns the cursor key of d under sort s.
+func DoctorSortKey(d model.Doctor, s model.DoctorSort) string {
+	switch doctorSortKeys[s] {
+	case "name":
+		return FoldCase(d.Name)
+	case "specialization":
+		return FoldCase(d.Specialization)
+	}
+	return ""
+}
+
+// FoldCase lowers ASCII letters only. SQLite's LOWER() does no more, and
+// neither does Postgres' under the C collation, so doctors match and sort
+// the same on every backend; other letters compare as written.
+func FoldCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// doctorSearch builds the shared WHERE and ORDER BY clauses of a catalogue
+// search. placeholder renders the n-th (1-based) bind parameter; collate is
+// applied to text columns so every backend folds case and orders the same
+// way as FoldCase.
+// filterArgs binds filter alone; args binds page, which extends it.
+// Keyset pagination compares (sort key, id) with the cursor, so pages stay
+// stable while doctors are added.
+func doctorSearch(q model.DoctorQuery, placeholder func(n int) string, collate string) (filter, page, order string, filterArgs, args []any) {
+	var conds []string
+	arg := func(v any) string {
+		args = append(args, v)
+		return placeholder(len(args))
+	}
+	lower := func(column string) string {
+		return fmt.Sprintf("LOWER(%s%s)", column, collate)
+	}
+	if q.Specialization != "" {
+		conds = append(conds, lower("specialization")+" = "+arg(FoldCase(q.Specialization)))
+	}
+	if q.Search != "" {
+		pattern := "%" + likeEscaper.Replace(FoldCase(q.Search)) + "%"
+		conds = append(conds, lower("name")+" LIKE "+arg(pattern)+` ESCAPE '\'`)
+	}
+	filter = "TRUE"
+	if len(conds) > 0 {
+		filter = strings.Join(conds, " AND ")
+	}
+	filterArgs = args[:len(args):len(args)]
+
+	dir, cmp := "ASC", ">"
+	if strings.HasPrefix(string(q.Sort), "-") {
+		dir, cmp = "DESC", "<"
+	}
+	column := doctorSortKeys[q.Sort]
+	page = filter
+	if column == "" {
+		order = "id " + dir
+		if q.After != nil {
+			page += fmt.Sprintf(" AND id %s %s", cmp, arg(q.After.ID))
+		}
+	} else {
+		key := lower(column)
+		order = fmt.Sprintf("%s %s, id %s", key, dir, dir)
+		if q.After != nil {
+			k := arg(q.After.Key)
+			page += fmt.Sprintf(" AND (%s %s %s OR (%s = %s AND id %s %s))", key, cmp, k, key, k, cmp, arg(q.After.ID))
+		}
+	}
+	return filter, page, order, filterArgs, args
+}
+
+// statusColumns maps each status reached by a transition to the column that
+// records when it happened.
+var statusColumns = map[model.AppointmentStatus]string{
+	model.StatusCheckedIn: "checked_in_at",
+	model.StatusCompleted: "completed_at",
+	model.StatusCancelled: "cancelled_at",
+	model.StatusNoShow:    "no_show_at",
+}
+
+func statusColumn(to model.AppointmentStatus) (string, error) {
+	column, ok := statusColumns[to]
+	if !ok {
+		return "", fmt.Errorf("no timestamp column for status %q", to)
+	}
+	return column, nil
+}
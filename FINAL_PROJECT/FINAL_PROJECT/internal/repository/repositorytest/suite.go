@@ -0,0 +1,931 @@
+// Package repositorytest contains the conformance suite shared by every
+// implementation of the repository interfaces.
+package repositorytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"clinic-cli/internal/importer"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns a registry backed by an empty store. It is called once per
+// subtest so cases never observe each other's data.
+type Factory func(t *testing.T) *repository.Registry
+
+// Run exercises a backend against the behaviour the services rely on.
+func Run(t *testing.T, newRegistry Factory) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, newRegistry) })
+	t.Run("Doctors", func(t *testing.T) { testDoctors(t, newRegistry) })
+	t.Run("Appointments", func(t *testing.T) { testAppointments(t, newRegistry) })
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, newRegistry) })
+	t.Run("UserTokens", func(t *testing.T) { testUserTokens(t, newRegistry) })
+	t.Run("LoginThrottles", func(t *testing.T) { testLoginThrottles(t, newRegistry) })
+	t.Run("Outbox", func(t *testing.T) { testOutbox(t, newRegistry) })
+	t.Run("Reminders", func(t *testing.T) { testReminders(t, newRegistry) })
+}
+
+// at parses a "2006-01-02 15:04" UTC timestamp for appointment fixtures.
+func at(t *testing.T, s string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse("2006-01-02 15:04", s)
+	require.NoError(t, err)
+	return parsed
+}
+
+func testUsers(t *testing.T, newRegistry Factory) {
+	ctx := context.Background()
+
+	t.Run("create then get", func(t *testing.T) {
+		repos := newRegistry(t)
+		created, err := repos.User.Create(ctx, "ann@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		assert.NotZero(t, created.ID)
+		assert.False(t, created.CreatedAt.IsZero())
+
+		byEmail, err := repos.User.GetByEmail(ctx, "ann@example.com")
+		require.NoError(t, err)
+		require.NotNil(t, byEmail)
+		assert.Equal(t, created.ID, byEmail.ID)
+		assert.Equal(t, "hash", byEmail.PasswordHash)
+		assert.Equal(t, model.RolePatient, byEmail.Role)
+
+		byID, err := repos.User.GetByID(ctx, created.ID)
+		require.NoError(t, err)
+		require.NotNil(t, byID)
+		assert.Equal(t, "ann@example.com", byID.Email)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repos := newRegistry(t)
+		_, err := repos.User.GetByEmail(ctx, "missing@example.com")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+
+		_, err = repos.User.GetByID(ctx, 4242)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("create doctor account", func(t *testing.T) {
+		repos := newRegistry(t)
+		doctor, err := repos.Doctor.Create(ctx, "Dr. House", "Diagnostics")
+		require.NoError(t, err)
+		_, err = repos.User.Create(ctx, "wilson@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+
+		created, err := repos.User.CreateDoctorAccount(ctx, "house@example.com", "hash", doctor.ID)
+		require.NoError(t, err)
+		linked, err := repos.User.GetByID(ctx, created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.RoleDoctor, linked.Role)
+		require.NotNil(t, linked.DoctorID)
+		assert.Equal(t, doctor.ID, *linked.DoctorID)
+
+		_, err = repos.User.CreateDoctorAccount(ctx, "cuddy@example.com", "hash", doctor.ID)
+		assert.ErrorIs(t, err, repository.ErrDoctorAlreadyLinked)
+		other, err := repos.Doctor.Create(ctx, "Dr. Cuddy", "Endocrinology")
+		require.NoError(t, err)
+		_, err = repos.User.CreateDoctorAccount(ctx, "wilson@example.com", "hash", other.ID)
+		assert.ErrorIs(t, err, repository.ErrEmailTaken)
+		_, err = repos.User.CreateDoctorAccount(ctx, "cuddy@example.com", "hash", other.ID+100)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+
+		_, err = repos.User.GetByEmail(ctx, "cuddy@example.com")
+		assert.ErrorIs(t, err, repository.ErrNotFound, "failed attempts leave no account behind")
+	})
+
+	t.Run("update password", func(t *testing.T) {
+		repos := newRegistry(t)
+		user, err := repos.User.Create(ctx, "ann@example.com", "old", model.RolePatient)
+		require.NoError(t, err)
+
+		require.NoError(t, repos.User.UpdatePassword(ctx, user.ID, "new"))
+		got, err := repos.User.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "new", got.PasswordHash)
+
+		assert.Error(t, repos.User.UpdatePassword(ctx, 4242, "new"))
+	})
+
+	t.Run("mark email verified", func(t *testing.T) {
+		repos := newRegistry(t)
+		user, err := repos.User.Create(ctx, "ann@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		assert.False(t, user.EmailVerified())
+
+		first := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)
+		require.NoError(t, repos.User.MarkEmailVerified(ctx, user.ID, first))
+		require.NoError(t, repos.User.MarkEmailVerified(ctx, user.ID, first.Add(time.Hour)))
+
+		got, err := repos.User.GetByEmail(ctx, "ann@example.com")
+		require.NoError(t, err)
+		require.True(t, got.EmailVerified())
+		assert.True(t, first.Equal(*got.EmailVerifiedAt))
+	})
+
+	t.Run("calendar token", func(t *testing.T) {
+		repos := newRegistry(t)
+		user, err := repos.User.Create(ctx, "ann@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+
+		require.NoError(t, repos.User.SetCalendarToken(ctx, user.ID, "first"))
+		got, err := repos.User.GetByCalendarToken(ctx, "first")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, user.ID, got.ID)
+
+		require.NoError(t, repos.User.SetCalendarToken(ctx, user.ID, "second"))
+		_, err = repos.User.GetByCalendarToken(ctx, "first")
+		assert.ErrorIs(t, err, repository.ErrNotFound, "rotating the token retires the old one")
+		got, err = repos.User.GetByCalendarToken(ctx, "second")
+		require.NoError(t, err)
+		assert.NotNil(t, got)
+
+		assert.Error(t, repos.User.SetCalendarToken(ctx, 4242, "third"))
+	})
+
+	t.Run("duplicate email rejected", func(t *testing.T) {
+		repos := newRegistry(t)
+		_, err := repos.User.Create(ctx, "dup@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		_, err = repos.User.Create(ctx, "dup@example.com", "hash", model.RolePatient)
+		assert.ErrorIs(t, err, repository.ErrEmailTaken)
+	})
+}
+
+func testDoctors(t *testing.T, newRegistry Factory) {
+	ctx := context.Background()
+
+	t.Run("import upserts by external ID", func(t *testing.T) {
+		repos := newRegistry(t)
+		manual, err := repos.Doctor.Create(ctx, "Dr. Manual", "Surgery")
+		require.NoError(t, err)
+
+		results, err := repos.Doctor.Import(ctx, []importer.Row{
+			{Line: 2, ExternalID: "g-1", Name: "Dr. Grey", Specialization: "Surgery"},
+			{Line: 3, ExternalID: "h-1", Name: "Dr. House", Specialization: "Diagnostics"},
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.True(t, results[0].Created)
+		assert.Equal(t, 3, results[1].Line)
+
+		results, err = repos.Doctor.Import(ctx, []importer.Row{
+			{Line: 2, ExternalID: "h-1", Name: "Dr. Gregory House", Specialization: "Nephrology"},
+			{Line: 3, ExternalID: "w-1", Name: "Dr. Wilson", Specialization: "Oncology"},
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.False(t, results[0].Created)
+		assert.True(t, results[1].Created)
+
+		house, err := repos.Doctor.GetByID(ctx, results[0].DoctorID)
+		require.NoError(t, err)
+		assert.Equal(t, "Dr. Gregory House", house.Name)
+		assert.Equal(t, "Nephrology", house.Specialization)
+		assert.Equal(t, "h-1", house.ExternalID)
+
+		_, total, err := repos.Doctor.Search(ctx, model.DoctorQuery{})
+		require.NoError(t, err)
+		assert.Equal(t, 4, total)
+		got, err := repos.Doctor.GetByID(ctx, manual.ID)
+		require.NoError(t, err)
+		assert.Empty(t, got.ExternalID)
+	})
+
+	t.Run("create then get", func(t *testing.T) {
+		repos := newRegistry(t)
+		created, err := repos.Doctor.Create(ctx, "Dr. House", "Diagnostics")
+		require.NoError(t, err)
+		assert.NotZero(t, created.ID)
+
+		got, err := repos.Doctor.GetByID(ctx, created.ID)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, "Dr. House", got.Name)
+		assert.Equal(t, "Diagnostics", got.Specialization)
+
+		all, total, err := repos.Doctor.Search(ctx, model.DoctorQuery{})
+		require.NoError(t, err)
+		assert.Len(t, all, 1)
+		assert.Equal(t, 1, total)
+	})
+
+	t.Run("search filters and pages", func(t *testing.T) {
+		repos := newRegistry(t)
+		for _, d := range [][2]string{
+			{"Dr. Gregory House", "Diagnostics"},
+			{"Dr. Lisa Cuddy", "Endocrinology"},
+			{"Dr. James Wilson", "Oncology"},
+			{"Dr. Allison Cameron", "immunology"},
+			{"Dr. Eric Foreman", "Neurology"},
+			{"Dr. Robert Chase", "Immunology"},
+			{"Dr. 100% Real_Doc", "Diagnostics"},
+		} {
+			_, err := repos.Doctor.Create(ctx, d[0], d[1])
+			require.NoError(t, err)
+		}
+		found, total, err := repos.Doctor.Search(ctx, model.DoctorQuery{Specialization: "IMMUNOLOGY", Sort: model.SortName})
+		require.NoError(t, err)
+		assert.Equal(t, 2, total)
+		assert.Equal(t, []string{"Dr. Allison Cameron", "Dr. Robert Chase"}, doctorNames(found))
+
+		found, total, err = repos.Doctor.Search(ctx, model.DoctorQuery{Search: "ER", Sort: model.SortNameDesc})
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		assert.Equal(t, []string{"Dr. Robert Chase", "Dr. Eric Foreman", "Dr. Allison Cameron"}, doctorNames(found))
+
+		found, _, err = repos.Doctor.Search(ctx, model.DoctorQuery{Search: "0%"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Dr. 100% Real_Doc"}, doctorNames(found))
+		found, _, err = repos.Doctor.Search(ctx, model.DoctorQuery{Search: "l_s"})
+		require.NoError(t, err)
+		assert.Empty(t, found, "underscore must match literally")
+
+		for _, sort := range []model.DoctorSort{model.SortName, model.SortSpecializationDesc, model.SortCreated, model.SortCreatedDesc} {
+			all, total, err := repos.Doctor.Search(ctx, model.DoctorQuery{Sort: sort})
+			require.NoError(t, err)
+			require.Len(t, all, 7)
+			assert.Equal(t, 7, total)
+
+			var paged []model.Doctor
+			q := model.DoctorQuery{Sort: sort, Limit: 3}
+			for {
+				page, total, err := repos.Doctor.Search(ctx, q)
+				require.NoError(t, err)
+				assert.Equal(t, 7, total)
+				paged = append(paged, page...)
+				if len(page) < q.Limit {
+					break
+				}
+				last := page[len(page)-1]
+				q.After = &model.DoctorCursor{Key: repository.DoctorSortKey(last, sort), ID: last.ID}
+			}
+			assert.Equal(t, doctorNames(all), doctorNames(paged), "sort %s", sort)
+		}
+	})
+
+	t.Run("search folds ASCII case only", func(t *testing.T) {
+		repos := newRegistry(t)
+		for _, name := range []string{"Dr. Émile", "Dr. zed", "Dr. Ärzt"} {
+			_, err := repos.Doctor.Create(ctx, name, "General")
+			require.NoError(t, err)
+		}
+
+		found, _, err := repos.Doctor.Search(ctx, model.DoctorQuery{Search: "ÉMILE"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Dr. Émile"}, doctorNames(found))
+		found, _, err = repos.Doctor.Search(ctx, model.DoctorQuery{Search: "émile"})
+		require.NoError(t, err)
+		assert.Empty(t, found)
+
+		var paged []model.Doctor
+		q := model.DoctorQuery{Sort: model.SortName, Limit: 1}
+		for {
+			page, _, err := repos.Doctor.Search(ctx, q)
+			require.NoError(t, err)
+			if len(page) == 0 {
+				break
+			}
+			paged = append(paged, page...)
+			last := page[len(page)-1]
+			q.After = &model.DoctorCursor{Key: repository.DoctorSortKey(last, model.SortName), ID: last.ID}
+		}
+		assert.Equal(t, []string{"Dr. zed", "Dr. Ärzt", "Dr. Émile"}, doctorNames(paged))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repos := newRegistry(t)
+		_, err := repos.Doctor.GetByID(ctx, 4242)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("working hours replace the template", func(t *testing.T) {
+		repos := newRegistry(t)
+		doc, err := repos.Doctor.Create(ctx, "Dr. Who", "Time")
+		require.NoError(t, err)
+
+		hours, err := repos.Doctor.GetWorkingHours(ctx, doc.ID)
+		require.NoError(t, err)
+		assert.Empty(t, hours)
+
+		require.NoError(t, repos.Doctor.SetWorkingHours(ctx, doc.ID, []model.WorkingHours{
+			{Weekday: time.Tuesday, Start: "13:00", End: "17:00"},
+			{Weekday: time.Monday, Start: "09:00", End: "12:00"},
+			{Weekday: time.Tuesday, Start: "08:00", End: "12:00"},
+		}))
+		hours, err = repos.Doctor.GetWorkingHours(ctx, doc.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []model.WorkingHours{
+			{Weekday: time.Monday, Start: "09:00", End: "12:00"},
+			{Weekday: time.Tuesday, Start: "08:00", End: "12:00"},
+			{Weekday: time.Tuesday, Start: "13:00", End: "17:00"},
+		}, hours)
+
+		require.NoError(t, repos.Doctor.SetWorkingHours(ctx, doc.ID, []model.WorkingHours{
+			{Weekday: time.Friday, Start: "10:00", End: "11:00"},
+		}))
+		hours, err = repos.Doctor.GetWorkingHours(ctx, doc.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []model.WorkingHours{{Weekday: time.Friday, Start: "10:00", End: "11:00"}}, hours)
+	})
+}
+
+func testAppointments(t *testing.T, newRegistry Factory) {
+	ctx := context.Background()
+
+	seed := func(t *testing.T, repos *repository.Registry) (patient *model.User, doctor *model.Doctor) {
+		t.Helper()
+		patient, err := repos.User.Create(ctx, "pat@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		doctor, err = repos.Doctor.Create(ctx, "Dr. Grey", "Surgery")
+		require.NoError(t, err)
+		return patient, doctor
+	}
+
+	t.Run("create", func(t *testing.T) {
+		repos := newRegistry(t)
+		patient, doctor := seed(t, repos)
+
+		app, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		require.NoError(t, err)
+		assert.NotZero(t, app.ID)
+		assert.Equal(t, model.StatusScheduled, app.Status)
+		assert.True(t, app.Time.Equal(at(t, "2030-05-01 10:00")))
+
+		apps, err := repos.Appointment.GetByDoctorID(ctx, doctor.ID, time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, apps, 1)
+		assert.True(t, apps[0].Time.Equal(at(t, "2030-05-01 10:00")), "time must round-trip through the store")
+	})
+
+	t.Run("doctor appointments filtered by range", func(t *testing.T) {
+		repos := newRegistry(t)
+		patient, doctor := seed(t, repos)
+		for _, ts := range []string{"2030-05-01 09:00", "2030-05-02 09:00", "2030-05-02 16:00", "2030-05-03 09:00"} {
+			_, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, ts))
+			require.NoError(t, err)
+		}
+
+		apps, err := repos.Appointment.GetByDoctorID(ctx, doctor.ID, at(t, "2030-05-02 00:00"), at(t, "2030-05-03 09:00"))
+		require.NoError(t, err)
+		require.Len(t, apps, 2, "range is half-open")
+		assert.True(t, apps[0].Time.Equal(at(t, "2030-05-02 09:00")))
+		assert.True(t, apps[1].Time.Equal(at(t, "2030-05-02 16:00")))
+		assert.Equal(t, "pat@example.com", apps[0].PatientEmail)
+		assert.Equal(t, "Dr. Grey", apps[0].DoctorName)
+
+		apps, err = repos.Appointment.GetByDoctorID(ctx, doctor.ID, at(t, "2030-05-02 12:00"), time.Time{})
+		require.NoError(t, err)
+		assert.Len(t, apps, 2, "zero upper bound is open")
+	})
+
+	t.Run("patient appointments ordered by time", func(t *testing.T) {
+		repos := newRegistry(t)
+		patient, doctor := seed(t, repos)
+		other, err := repos.User.Create(ctx, "other@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+
+		for _, ts := range []string{"2030-05-03 09:00", "2030-05-01 15:30", "2030-05-02 11:00"} {
+			_, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, ts))
+			require.NoError(t, err)
+		}
+		_, err = repos.Appointment.Create(ctx, other.ID, doctor.ID, at(t, "2030-04-01 09:00"))
+		require.NoError(t, err)
+
+		apps, err := repos.Appointment.GetByPatientID(ctx, patient.ID)
+		require.NoError(t, err)
+		require.Len(t, apps, 3)
+		for i := 1; i < len(apps); i++ {
+			assert.True(t, apps[i-1].Time.Before(apps[i].Time), "appointments must be ordered by time")
+		}
+		assert.Equal(t, "Dr. Grey", apps[0].DoctorName)
+		assert.Equal(t, "Surgery", apps[0].Specialization)
+
+		none, err := repos.Appointment.GetByPatientID(ctx, 4242)
+		assert.NoError(t, err)
+		assert.Empty(t, none)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		repos := newRegistry(t)
+		patient, doctor := seed(t, repos)
+		app, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		require.NoError(t, err)
+
+		cancelled, err := repos.Appointment.Cancel(ctx, app.ID)
+		require.NoError(t, err)
+		assert.True(t, cancelled)
+
+		apps, err := repos.Appointment.GetByPatientID(ctx, patient.ID)
+		require.NoError(t, err)
+		require.Len(t, apps, 1)
+		assert.Equal(t, model.StatusCancelled, apps[0].Status)
+		assert.NotNil(t, apps[0].CancelledAt)
+
+		cancelled, err = repos.Appointment.Cancel(ctx, app.ID)
+		require.NoError(t, err)
+		assert.False(t, cancelled, "an already cancelled appointment is not affected")
+
+		cancelled, err = repos.Appointment.Cancel(ctx, 4242)
+		require.NoError(t, err)
+		assert.False(t, cancelled)
+	})
+
+	t.Run("update status", func(t *testing.T) {
+		repos := newRegistry(t)
+		patient, doctor := seed(t, repos)
+		app, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		require.NoError(t, err)
+
+		checkedIn := at(t, "2030-05-01 09:55")
+		require.NoError(t, repos.Appointment.UpdateStatus(ctx, app.ID, model.StatusScheduled, model.StatusCheckedIn, checkedIn))
+		err = repos.Appointment.UpdateStatus(ctx, app.ID, model.StatusScheduled, model.StatusNoShow, checkedIn)
+		assert.ErrorIs(t, err, repository.ErrStatusChanged, "the status is compared before it is set")
+		require.NoError(t, repos.Appointment.UpdateStatus(ctx, app.ID, model.StatusCheckedIn, model.StatusCompleted, at(t, "2030-05-01 10:30")))
+
+		got, err := repos.Appointment.GetByID(ctx, app.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.StatusCompleted, got.Status)
+		require.NotNil(t, got.CheckedInAt)
+		assert.True(t, got.CheckedInAt.Equal(checkedIn))
+		require.NotNil(t, got.CompletedAt)
+		assert.Nil(t, got.NoShowAt)
+		assert.Equal(t, 2, got.Revision)
+
+		err = repos.Appointment.UpdateStatus(ctx, 4242, model.StatusScheduled, model.StatusCheckedIn, checkedIn)
+		assert.ErrorIs(t, err, repository.ErrStatusChanged)
+	})
+
+	t.Run("get by id", func(t *testing.T) {
+		repos := newRegistry(t)
+		patient, doctor := seed(t, repos)
+		app, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		require.NoError(t, err)
+
+		got, err := repos.Appointment.GetByID(ctx, app.ID)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, patient.ID, got.PatientID)
+		assert.Equal(t, "Dr. Grey", got.DoctorName)
+		assert.Nil(t, got.PreviousTime)
+
+		_, err = repos.Appointment.GetByID(ctx, 4242)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("reschedule", func(t *testing.T) {
+		repos := newRegistry(t)
+		patient, doctor := seed(t, repos)
+		second, err := repos.Doctor.Create(ctx, "Dr. Karev", "Pediatrics")
+		require.NoError(t, err)
+		app, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		require.NoError(t, err)
+		blocker, err := repos.Appointment.Create(ctx, patient.ID, second.ID, at(t, "2030-05-02 09:00"))
+		require.NoError(t, err)
+
+		moved, err := repos.Appointment.Reschedule(ctx, app.ID, second.ID, at(t, "2030-05-02 10:00"))
+		require.NoError(t, err)
+		assert.Equal(t, app.ID, moved.ID)
+		assert.Equal(t, second.ID, moved.DoctorID)
+		assert.Equal(t, "Dr. Karev", moved.DoctorName)
+		assert.True(t, moved.Time.Equal(at(t, "2030-05-02 10:00")))
+		require.NotNil(t, moved.PreviousTime)
+		assert.True(t, moved.PreviousTime.Equal(at(t, "2030-05-01 10:00")))
+		assert.Equal(t, app.Revision+1, moved.Revision)
+
+		_, err = repos.Appointment.Reschedule(ctx, app.ID, second.ID, at(t, "2030-05-02 09:00"))
+		assert.ErrorIs(t, err, repository.ErrSlotTaken)
+
+		_, err = repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		assert.NoError(t, err, "the old slot is free again")
+
+		_, err = repos.Appointment.Cancel(ctx, blocker.ID)
+		require.NoError(t, err)
+		_, err = repos.Appointment.Reschedule(ctx, blocker.ID, second.ID, at(t, "2030-05-03 09:00"))
+		assert.ErrorIs(t, err, repository.ErrNotScheduled)
+	})
+
+	t.Run("same slot cannot be booked twice", func(t *testing.T) {
+		repos := newRegistry(t)
+		patient, doctor := seed(t, repos)
+		other, err := repos.User.Create(ctx, "other@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+
+		_, err = repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		require.NoError(t, err)
+		_, err = repos.Appointment.Create(ctx, other.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		assert.ErrorIs(t, err, repository.ErrSlotTaken)
+
+		second, err := repos.Doctor.Create(ctx, "Dr. Karev", "Pediatrics")
+		require.NoError(t, err)
+		_, err = repos.Appointment.Create(ctx, other.ID, second.ID, at(t, "2030-05-01 10:00"))
+		assert.NoError(t, err, "another doctor's identical slot is independent")
+	})
+
+	t.Run("cancelled slot can be rebooked", func(t *testing.T) {
+		repos := newRegistry(t)
+		patient, doctor := seed(t, repos)
+		app, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		require.NoError(t, err)
+		_, err = repos.Appointment.Cancel(ctx, app.ID)
+		require.NoError(t, err)
+
+		_, err = repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("concurrent bookings of one slot", func(t *testing.T) {
+		repos := newRegistry(t)
+		_, doctor := seed(t, repos)
+
+		const workers = 25
+		slot := at(t, "2030-05-01 10:00")
+		patients := make([]int, workers)
+		for i := range patients {
+			u, err := repos.User.Create(ctx, fmt.Sprintf("racer%d@example.com", i), "hash", model.RolePatient)
+			require.NoError(t, err)
+			patients[i] = u.ID
+		}
+
+		var (
+			wg        sync.WaitGroup
+			start     = make(chan struct{})
+			errs      = make(chan error, workers)
+			successes = make(chan int, workers)
+		)
+		for _, pid := range patients {
+			wg.Add(1)
+			go func(pid int) {
+				defer wg.Done()
+				<-start
+				app, err := repos.Appointment.Create(ctx, pid, doctor.ID, slot)
+				if err != nil {
+					errs <- err
+					return
+				}
+				successes <- app.ID
+			}(pid)
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+		close(successes)
+
+		assert.Len(t, successes, 1, "exactly one booking must win")
+		for err := range errs {
+			assert.ErrorIs(t, err, repository.ErrSlotTaken)
+		}
+
+		apps, err := repos.Appointment.GetByDoctorID(ctx, doctor.ID, time.Time{}, time.Time{})
+		require.NoError(t, err)
+		assert.Len(t, apps, 1)
+	})
+}
+
+func doctorNames(ds []model.Doctor) []string {
+	out := make([]string, len(ds))
+	for i, d := range ds {
+		out[i] = d.Name
+	}
+	return out
+}
+
+func testSessions(t *testing.T, newRegistry Factory) {
+	ctx := context.Background()
+	now := at(t, "2030-05-01 10:00")
+
+	newSession := func(t *testing.T, repos *repository.Registry, id string, userID int, lastUsed time.Time) *model.Session {
+		t.Helper()
+		s := &model.Session{
+			ID:          id,
+			UserID:      userID,
+			Device:      "phone",
+			RefreshHash: "hash-" + id,
+			CreatedAt:   now,
+			LastUsedAt:  lastUsed,
+			ExpiresAt:   now.Add(24 * time.Hour),
+		}
+		require.NoError(t, repos.Session.Create(ctx, s))
+		return s
+	}
+
+	t.Run("create, get and list", func(t *testing.T) {
+		repos := newRegistry(t)
+		user, err := repos.User.Create(ctx, "ann@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		other, err := repos.User.Create(ctx, "bob@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+
+		newSession(t, repos, "a", user.ID, now)
+		newSession(t, repos, "b", user.ID, now.Add(time.Hour))
+		newSession(t, repos, "c", other.ID, now)
+
+		got, err := repos.Session.GetByID(ctx, "a")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, user.ID, got.UserID)
+		assert.Equal(t, "hash-a", got.RefreshHash)
+		assert.True(t, got.ExpiresAt.Equal(now.Add(24*time.Hour)))
+		assert.Nil(t, got.RevokedAt)
+
+		_, err = repos.Session.GetByID(ctx, "nope")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+
+		list, err := repos.Session.ListByUser(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, "b", list[0].ID, "most recently used first")
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		repos := newRegistry(t)
+		user, err := repos.User.Create(ctx, "ann@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		newSession(t, repos, "a", user.ID, now)
+
+		later := now.Add(time.Hour)
+		ok, err := repos.Session.Rotate(ctx, "a", "hash-a", "next", later, later.Add(24*time.Hour))
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = repos.Session.Rotate(ctx, "a", "hash-a", "again", later, later)
+		require.NoError(t, err)
+		assert.False(t, ok, "a replayed refresh hash must not rotate")
+
+		got, err := repos.Session.GetByID(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, "next", got.RefreshHash)
+		assert.True(t, got.LastUsedAt.Equal(later))
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		repos := newRegistry(t)
+		user, err := repos.User.Create(ctx, "ann@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		other, err := repos.User.Create(ctx, "bob@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		newSession(t, repos, "a", user.ID, now)
+		newSession(t, repos, "b", user.ID, now)
+		newSession(t, repos, "c", user.ID, now)
+		newSession(t, repos, "d", other.ID, now)
+
+		require.NoError(t, repos.Session.Revoke(ctx, "a", now))
+		got, err := repos.Session.GetByID(ctx, "a")
+		require.NoError(t, err)
+		require.NotNil(t, got.RevokedAt)
+		ok, err := repos.Session.Rotate(ctx, "a", "hash-a", "next", now, now)
+		require.NoError(t, err)
+		assert.False(t, ok, "revoked sessions cannot be refreshed")
+
+		require.NoError(t, repos.Session.RevokeAllForUser(ctx, user.ID, now))
+		list, err := repos.Session.ListByUser(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, list)
+		list, err = repos.Session.ListByUser(ctx, other.ID)
+		require.NoError(t, err)
+		assert.Len(t, list, 1, "other users keep their sessions")
+	})
+}
+
+func testUserTokens(t *testing.T, newRegistry Factory) {
+	ctx := context.Background()
+	now := at(t, "2030-05-01 10:00")
+
+	t.Run("consume once", func(t *testing.T) {
+		repos := newRegistry(t)
+		user, err := repos.User.Create(ctx, "ann@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		require.NoError(t, repos.UserToken.Create(ctx, &model.UserToken{
+			Hash: "h1", UserID: user.ID, Purpose: model.TokenPasswordReset, CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+		}))
+
+		wrongPurpose, err := repos.UserToken.Consume(ctx, "h1", "other", now)
+		require.NoError(t, err)
+		assert.Nil(t, wrongPurpose)
+
+		got, err := repos.UserToken.Consume(ctx, "h1", model.TokenPasswordReset, now)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, user.ID, got.UserID)
+		assert.True(t, got.ExpiresAt.Equal(now.Add(time.Hour)))
+		assert.NotNil(t, got.UsedAt)
+
+		again, err := repos.UserToken.Consume(ctx, "h1", model.TokenPasswordReset, now)
+		require.NoError(t, err)
+		assert.Nil(t, again, "tokens are single-use")
+	})
+
+	t.Run("invalidate for user", func(t *testing.T) {
+		repos := newRegistry(t)
+		user, err := repos.User.Create(ctx, "ann@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		for _, hash := range []string{"h1", "h2"} {
+			require.NoError(t, repos.UserToken.Create(ctx, &model.UserToken{
+				Hash: hash, UserID: user.ID, Purpose: model.TokenPasswordReset, CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+			}))
+		}
+
+		require.NoError(t, repos.UserToken.InvalidateForUser(ctx, user.ID, model.TokenPasswordReset, now))
+		got, err := repos.UserToken.Consume(ctx, "h2", model.TokenPasswordReset, now)
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+}
+
+func testLoginThrottles(t *testing.T, newRegistry Factory) {
+	ctx := context.Background()
+	repos := newRegistry(t)
+	first := at(t, "2030-01-07 09:00")
+
+	none, err := repos.LoginThrottle.Get(ctx, "account:ann@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, none)
+
+	for i := 1; i <= 3; i++ {
+		got, err := repos.LoginThrottle.RecordFailure(ctx, "account:ann@example.com", first.Add(time.Duration(i)*time.Minute), first)
+		require.NoError(t, err)
+		assert.Equal(t, i, got.Failures)
+	}
+	_, err = repos.LoginThrottle.RecordFailure(ctx, "ip:10.0.0.1", first, first)
+	require.NoError(t, err)
+
+	got, err := repos.LoginThrottle.Get(ctx, "account:ann@example.com")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, 3, got.Failures)
+	assert.True(t, got.LastFailureAt.Equal(first.Add(3*time.Minute)))
+
+	require.NoError(t, repos.LoginThrottle.Reset(ctx, "account:ann@example.com"))
+	got, err = repos.LoginThrottle.Get(ctx, "account:ann@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	other, err := repos.LoginThrottle.Get(ctx, "ip:10.0.0.1")
+	require.NoError(t, err)
+	require.NotNil(t, other, "reset only touches its own key")
+	assert.Equal(t, 1, other.Failures)
+
+	later := first.Add(time.Hour)
+	got, err = repos.LoginThrottle.RecordFailure(ctx, "ip:10.0.0.1", later, later.Add(-30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.Failures, "failures before forgetBefore are forgotten")
+	assert.True(t, got.LastFailureAt.Equal(later))
+	got, err = repos.LoginThrottle.RecordFailure(ctx, "ip:10.0.0.1", later.Add(time.Minute), later.Add(-30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.Failures)
+}
+
+func testOutbox(t *testing.T, newRegistry Factory) {
+	ctx := context.Background()
+
+	t.Run("appointment changes enqueue events", func(t *testing.T) {
+		repos := newRegistry(t)
+		patient, err := repos.User.Create(ctx, "pat@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		doctor, err := repos.Doctor.Create(ctx, "Dr. Grey", "Surgery")
+		require.NoError(t, err)
+
+		app, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		require.NoError(t, err)
+		_, err = repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+		require.ErrorIs(t, err, repository.ErrSlotTaken)
+		_, err = repos.Appointment.Reschedule(ctx, app.ID, doctor.ID, at(t, "2030-05-01 11:00"))
+		require.NoError(t, err)
+
+		events, err := repos.Outbox.List(ctx, model.OutboxPending, 10)
+		require.NoError(t, err)
+		require.Len(t, events, 2, "the rejected booking must not leave an event behind")
+
+		moved, booked := events[0], events[1]
+		assert.Equal(t, model.EventAppointmentBooked, booked.Kind)
+		assert.Equal(t, model.EventAppointmentRescheduled, moved.Kind)
+
+		var payload model.AppointmentEvent
+		require.NoError(t, json.Unmarshal(moved.Payload, &payload))
+		assert.Equal(t, app.ID, payload.AppointmentID)
+		assert.True(t, payload.Time.Equal(at(t, "2030-05-01 11:00")))
+		require.NotNil(t, payload.PreviousTime)
+		assert.True(t, payload.PreviousTime.Equal(at(t, "2030-05-01 10:00")))
+	})
+
+	t.Run("claim, fail, replay", func(t *testing.T) {
+		repos := newRegistry(t)
+		patient, err := repos.User.Create(ctx, "pat@example.com", "hash", model.RolePatient)
+		require.NoError(t, err)
+		doctor, err := repos.Doctor.Create(ctx, "Dr. Grey", "Surgery")
+		require.NoError(t, err)
+		for _, when := range []string{"2030-05-01 10:00", "2030-05-01 11:00"} {
+			_, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, when))
+			require.NoError(t, err)
+		}
+
+		now := time.Now().UTC().Add(time.Minute)
+		lease := now.Add(time.Hour)
+		claimed, err := repos.Outbox.ClaimDue(ctx, now, lease, 1)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		first := claimed[0]
+
+		claimed, err = repos.Outbox.ClaimDue(ctx, now, lease, 10)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1, "leased events are not handed out twice")
+		second := claimed[0]
+		assert.Greater(t, second.ID, first.ID)
+
+		require.NoError(t, repos.Outbox.MarkSent(ctx, first.ID, now))
+		require.NoError(t, repos.Outbox.Fail(ctx, second.ID, "smtp down", now, false))
+		claimed, err = repos.Outbox.ClaimDue(ctx, now, lease, 10)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1, "failed events come back when their retry is due")
+
+		require.NoError(t, repos.Outbox.Fail(ctx, second.ID, "still down", now, true))
+		dead, err := repos.Outbox.List(ctx, model.OutboxDead, 10)
+		require.NoError(t, err)
+		require.Len(t, dead, 1)
+		assert.Equal(t, 2, dead[0].Attempts)
+		assert.Equal(t, "still down", dead[0].LastError)
+
+		replayed, err := repos.Outbox.Replay(ctx, first.ID, now)
+		require.NoError(t, err)
+		assert.False(t, replayed, "only dead events can be replayed")
+		replayed, err = repos.Outbox.Replay(ctx, second.ID, now)
+		require.NoError(t, err)
+		assert.True(t, replayed)
+
+		got, err := repos.Outbox.Get(ctx, second.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.OutboxPending, got.Status)
+		assert.Zero(t, got.Attempts)
+
+		sent, err := repos.Outbox.Get(ctx, first.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.OutboxSent, sent.Status)
+		assert.NotNil(t, sent.SentAt)
+
+		_, err = repos.Outbox.Get(ctx, 4242)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+}
+
+func testReminders(t *testing.T, newRegistry Factory) {
+	ctx := context.Background()
+	repos := newRegistry(t)
+	patient, err := repos.User.Create(ctx, "pat@example.com", "hash", model.RolePatient)
+	require.NoError(t, err)
+	doctor, err := repos.Doctor.Create(ctx, "Dr. Grey", "Surgery")
+	require.NoError(t, err)
+
+	soon, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 10:00"))
+	require.NoError(t, err)
+	cancelled, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-01 11:00"))
+	require.NoError(t, err)
+	require.NoError(t, repos.Appointment.UpdateStatus(ctx, cancelled.ID, model.StatusScheduled, model.StatusCancelled, at(t, "2030-04-01 09:00")))
+	_, err = repos.Appointment.Create(ctx, patient.ID, doctor.ID, at(t, "2030-05-03 10:00"))
+	require.NoError(t, err)
+
+	now := at(t, "2030-04-30 12:00")
+	due, err := repos.Reminder.Due(ctx, 24*time.Hour, now, now.Add(24*time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1, "cancelled and far-off appointments are not due")
+	assert.Equal(t, soon.ID, due[0].ID)
+	assert.Equal(t, "pat@example.com", due[0].PatientEmail)
+
+	queued, err := repos.Reminder.Queue(ctx, due[0], 24*time.Hour, now)
+	require.NoError(t, err)
+	assert.True(t, queued)
+	queued, err = repos.Reminder.Queue(ctx, due[0], 24*time.Hour, now)
+	require.NoError(t, err)
+	assert.False(t, queued, "a reminder is queued once")
+
+	due, err = repos.Reminder.Due(ctx, 24*time.Hour, now, now.Add(24*time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+	events, err := repos.Outbox.List(ctx, model.OutboxPending, 10)
+	require.NoError(t, err)
+	assert.Equal(t, model.EventAppointmentReminder, events[0].Kind)
+	assert.NotEqual(t, model.EventAppointmentReminder, events[1].Kind, "the duplicate left no event behind")
+
+	// A moved appointment is due for the same reminder again.
+	_, err = repos.Appointment.Reschedule(ctx, soon.ID, doctor.ID, at(t, "2030-05-01 09:00"))
+	require.NoError(t, err)
+	due, err = repos.Reminder.Due(ctx, 24*time.Hour, now, now.Add(24*time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+
+	require.NoError(t, repos.Outbox.MarkSent(ctx, events[0].ID, now))
+	reminders, err := repos.Reminder.ListByAppointment(ctx, soon.ID)
+	require.NoError(t, err)
+	require.Len(t, reminders, 1)
+	assert.Equal(t, 24*60, reminders[0].OffsetMinutes)
+	assert.True(t, reminders[0].AppointmentTime.Equal(at(t, "2030-05-01 10:00")))
+	require.NotNil(t, reminders[0].SentAt)
+}
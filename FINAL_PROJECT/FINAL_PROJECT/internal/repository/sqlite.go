@@ -0,0 +1,773 @@
+package repository
+
+import (
+	"clinic-cli/internal/importer"
+	"clinic-cli/internal/model"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// NewSQLiteRegistry returns every repository backed by the given database.
+func NewSQLiteRegistry(db *sql.DB) *Registry {
+	return &Registry{
+		User:          NewSQLiteUserRepository(db),
+		Doctor:        NewSQLiteDoctorRepository(db),
+		Appointment:   NewSQLiteAppointmentRepository(db),
+		Session:       NewSQLiteSessionRepository(db),
+		UserToken:     NewSQLiteUserTokenRepository(db),
+		LoginThrottle: NewSQLiteLoginThrottleRepository(db),
+		Outbox:        NewSQLiteOutboxRepository(db),
+		Reminder:      NewSQLiteReminderRepository(db),
+	}
+}
+
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
+	return &SQLiteUserRepository{db: db}
+}
+
+func (r *SQLiteUserRepository) Create(ctx context.Context, email, passwordHash string, role model.Role) (*model.User, error) {
+	query := `INSERT INTO users (email, password_hash, role) VALUES (?, ?, ?) RETURNING id, created_at`
+	user := &model.User{
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         role,
+	}
+	err := r.db.QueryRowContext(ctx, query, email, passwordHash, role).Scan(&user.ID, &user.CreatedAt)
+	if isSQLiteUniqueViolation(err) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+func (r *SQLiteUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	user, err := scanUser(r.db.QueryRowContext(ctx, userSelect+` WHERE email = ?`, email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+func (r *SQLiteUserRepository) GetByID(ctx context.Context, id int) (*model.User, error) {
+	user, err := scanUser(r.db.QueryRowContext(ctx, userSelect+` WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+func (r *SQLiteUserRepository) CreateDoctorAccount(ctx context.Context, email, passwordHash string, doctorID int) (*model.User, error) {
+	query := `INSERT INTO users (email, password_hash, role, doctor_id) VALUES (?, ?, ?, ?) RETURNING id, created_at`
+	user := &model.User{
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         model.RoleDoctor,
+		DoctorID:     &doctorID,
+	}
+	err := r.db.QueryRowContext(ctx, query, email, passwordHash, model.RoleDoctor, doctorID).Scan(&user.ID, &user.CreatedAt)
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch {
+		// SQLite names the columns of the violated index in the message.
+		case sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE && strings.Contains(sqliteErr.Error(), "users.doctor_id"):
+			return nil, ErrDoctorAlreadyLinked
+		case sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+			return nil, ErrEmailTaken
+		case sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return nil, ErrNotFound
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create doctor account: %w", err)
+	}
+	return user, nil
+}
+
+func (r *SQLiteUserRepository) MarkEmailVerified(ctx context.Context, userID int, at time.Time) error {
+	query := `UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL`
+	if _, err := r.db.ExecContext(ctx, query, at.UTC(), userID); err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteUserRepository) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("failed to update password: user %d does not exist", userID)
+	}
+	return nil
+}
+
+func (r *SQLiteUserRepository) SetCalendarToken(ctx context.Context, userID int, tokenHash string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET calendar_token_hash = ? WHERE id = ?`, tokenHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set calendar token: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("failed to set calendar token: user %d does not exist", userID)
+	}
+	return nil
+}
+
+func (r *SQLiteUserRepository) GetByCalendarToken(ctx context.Context, tokenHash string) (*model.User, error) {
+	user, err := scanUser(r.db.QueryRowContext(ctx, userSelect+` WHERE calendar_token_hash = ?`, tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+type SQLiteDoctorRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteDoctorRepository(db *sql.DB) *SQLiteDoctorRepository {
+	return &SQLiteDoctorRepository{db: db}
+}
+
+func (r *SQLiteDoctorRepository) Create(ctx context.Context, name, specialization string) (*model.Doctor, error) {
+	query := `INSERT INTO doctors (name, specialization) VALUES (?, ?) RETURNING id, created_at`
+	doc := &model.Doctor{Name: name, Specialization: specialization}
+	err := r.db.QueryRowContext(ctx, query, name, specialization).Scan(&doc.ID, &doc.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (r *SQLiteDoctorRepository) Search(ctx context.Context, q model.DoctorQuery) ([]model.Doctor, int, error) {
+	filter, page, order, filterArgs, args := doctorSearch(q, sqlitePlaceholder, "")
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM doctors WHERE `+filter, filterArgs...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := doctorSelect + ` WHERE ` + page + ` ORDER BY ` + order
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(" LIMIT ?%d", len(args))
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var doctors []model.Doctor
+	for rows.Next() {
+		d, err := scanDoctor(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		doctors = append(doctors, d)
+	}
+	return doctors, total, rows.Err()
+}
+
+// SQLiteDoctorSearch returns the WHERE and ORDER BY clauses, and the
+// arguments they bind, with which Search selects the doctors matching q,
+// for callers that query a doctors table of their own.
+func SQLiteDoctorSearch(q model.DoctorQuery) (where, order string, args []any) {
+	where, _, order, args, _ = doctorSearch(q, sqlitePlaceholder, "")
+	return where, order, args
+}
+
+func sqlitePlaceholder(n int) string {
+	return fmt.Sprintf("?%d", n)
+}
+
+func (r *SQLiteDoctorRepository) GetByID(ctx context.Context, id int) (*model.Doctor, error) {
+	query := `SELECT id, name, specialization, COALESCE(external_id, ''), created_at FROM doctors WHERE id = ?`
+	doc := &model.Doctor{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&doc.ID, &doc.Name, &doc.Specialization, &doc.ExternalID, &doc.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (r *SQLiteDoctorRepository) Import(ctx context.Context, rows []importer.Row) ([]importer.Result, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]importer.Result, 0, len(rows))
+	for _, row := range rows {
+		res := importer.Result{Line: row.Line, ExternalID: row.ExternalID}
+		query := `UPDATE doctors SET name = ?, specialization = ? WHERE external_id = ? RETURNING id`
+		err := tx.QueryRowContext(ctx, query, row.Name, row.Specialization, row.ExternalID).Scan(&res.DoctorID)
+		if errors.Is(err, sql.ErrNoRows) {
+			query = `INSERT INTO doctors (name, specialization, external_id) VALUES (?, ?, ?) RETURNING id`
+			err = tx.QueryRowContext(ctx, query, row.Name, row.Specialization, row.ExternalID).Scan(&res.DoctorID)
+			res.Created = true
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to import row %d: %w", row.Line, err)
+		}
+		results = append(results, res)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *SQLiteDoctorRepository) GetWorkingHours(ctx context.Context, doctorID int) ([]model.WorkingHours, error) {
+	query := `SELECT weekday, start_time, end_time FROM doctor_working_hours WHERE doctor_id = ? ORDER BY weekday, start_time`
+	rows, err := r.db.QueryContext(ctx, query, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hours []model.WorkingHours
+	for rows.Next() {
+		var h model.WorkingHours
+		if err := rows.Scan(&h.Weekday, &h.Start, &h.End); err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+	return hours, rows.Err()
+}
+
+func (r *SQLiteDoctorRepository) SetWorkingHours(ctx context.Context, doctorID int, hours []model.WorkingHours) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM doctor_working_hours WHERE doctor_id = ?`, doctorID); err != nil {
+		return err
+	}
+	for _, h := range hours {
+		_, err := tx.ExecContext(ctx, `INSERT INTO doctor_working_hours (doctor_id, weekday, start_time, end_time) VALUES (?, ?, ?, ?)`,
+			doctorID, int(h.Weekday), h.Start, h.End)
+		if err != nil {
+			return fmt.Errorf("failed to save working hours: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+type SQLiteAppointmentRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteAppointmentRepository(db *sql.DB) *SQLiteAppointmentRepository {
+	return &SQLiteAppointmentRepository{db: db}
+}
+
+func (r *SQLiteAppointmentRepository) Create(ctx context.Context, patientID, doctorID int, at time.Time) (*model.Appointment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO appointments (patient_id, doctor_id, time, status) VALUES (?, ?, ?, ?)
+		ON CONFLICT (doctor_id, time) WHERE status <> 'cancelled' DO NOTHING
+		RETURNING id, created_at
+	`
+	app := &model.Appointment{
+		PatientID: patientID,
+		DoctorID:  doctorID,
+		Time:      at,
+		Status:    model.StatusScheduled,
+	}
+	err = tx.QueryRowContext(ctx, query, patientID, doctorID, at.UTC(), model.StatusScheduled).Scan(&app.ID, &app.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSlotTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = sqliteEnqueue(ctx, tx, model.EventAppointmentBooked, appointmentEventPayload(ctx, app.ID, at, nil))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func (r *SQLiteAppointmentRepository) GetByID(ctx context.Context, id int) (*model.Appointment, error) {
+	a, err := scanAppointment(r.db.QueryRowContext(ctx, appointmentSelect+`WHERE a.id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *SQLiteAppointmentRepository) GetByPatientID(ctx context.Context, patientID int) ([]model.Appointment, error) {
+	return r.list(ctx, appointmentSelect+`WHERE a.patient_id = ? ORDER BY a.time ASC`, patientID)
+}
+
+func (r *SQLiteAppointmentRepository) GetByDoctorID(ctx context.Context, doctorID int, from, to time.Time) ([]model.Appointment, error) {
+	from, to = rangeBounds(from, to)
+	return r.list(ctx, appointmentSelect+`WHERE a.doctor_id = ? AND a.time >= ? AND a.time < ? ORDER BY a.time ASC`, doctorID, from, to)
+}
+
+func (r *SQLiteAppointmentRepository) list(ctx context.Context, query string, args ...any) ([]model.Appointment, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var apps []model.Appointment
+	for rows.Next() {
+		a, err := scanAppointment(rows)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, a)
+	}
+	return apps, rows.Err()
+}
+
+func (r *SQLiteAppointmentRepository) Reschedule(ctx context.Context, id, doctorID int, at time.Time) (*model.Appointment, error) {
+	// previous_time = time reads the row's value from before the update. The
+	// partial unique index rejects the move if the target slot is booked.
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE appointments SET previous_time = time, doctor_id = ?, time = ?, revision = revision + 1
+		WHERE id = ? AND status = ?
+		RETURNING previous_time
+	`
+	var previous time.Time
+	err = tx.QueryRowContext(ctx, query, doctorID, at.UTC(), id, model.StatusScheduled).Scan(&previous)
+	if isSQLiteUniqueViolation(err) {
+		return nil, ErrSlotTaken
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotScheduled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reschedule appointment: %w", err)
+	}
+	_, err = sqliteEnqueue(ctx, tx, model.EventAppointmentRescheduled, appointmentEventPayload(ctx, id, at, &previous))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetByID(ctx, id)
+}
+
+func (r *SQLiteAppointmentRepository) UpdateStatus(ctx context.Context, id int, from, to model.AppointmentStatus, at time.Time) error {
+	column, err := statusColumn(to)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`UPDATE appointments SET status = ?, %s = ?, revision = revision + 1 WHERE id = ? AND status = ?`, column)
+	res, err := r.db.ExecContext(ctx, query, to, at.UTC(), id, from)
+	if err != nil {
+		return fmt.Errorf("failed to update appointment status: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrStatusChanged
+	}
+	return nil
+}
+
+func (r *SQLiteAppointmentRepository) Cancel(ctx context.Context, id int) (bool, error) {
+	err := r.UpdateStatus(ctx, id, model.StatusScheduled, model.StatusCancelled, time.Now().UTC())
+	if errors.Is(err, ErrStatusChanged) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type SQLiteSessionRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteSessionRepository(db *sql.DB) *SQLiteSessionRepository {
+	return &SQLiteSessionRepository{db: db}
+}
+
+func (r *SQLiteSessionRepository) Create(ctx context.Context, session *model.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, device, refresh_hash, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := r.db.ExecContext(ctx, query, session.ID, session.UserID, session.Device, session.RefreshHash,
+		session.CreatedAt.UTC(), session.LastUsedAt.UTC(), session.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteSessionRepository) GetByID(ctx context.Context, id string) (*model.Session, error) {
+	query := `
+		SELECT id, user_id, device, refresh_hash, created_at, last_used_at, expires_at, revoked_at
+		FROM sessions WHERE id = ?
+	`
+	var s model.Session
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&s.ID, &s.UserID, &s.Device, &s.RefreshHash,
+		&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *SQLiteSessionRepository) ListByUser(ctx context.Context, userID int) ([]model.Session, error) {
+	query := `
+		SELECT id, user_id, device, refresh_hash, created_at, last_used_at, expires_at, revoked_at
+		FROM sessions WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY last_used_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []model.Session
+	for rows.Next() {
+		var s model.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Device, &s.RefreshHash,
+			&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SQLiteSessionRepository) Rotate(ctx context.Context, id, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error) {
+	query := `
+		UPDATE sessions SET refresh_hash = ?, last_used_at = ?, expires_at = ?
+		WHERE id = ? AND refresh_hash = ? AND revoked_at IS NULL
+	`
+	res, err := r.db.ExecContext(ctx, query, newHash, usedAt.UTC(), expiresAt.UTC(), id, oldHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate session: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *SQLiteSessionRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	query := `UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, at.UTC(), id)
+	return err
+}
+
+func (r *SQLiteSessionRepository) RevokeAllForUser(ctx context.Context, userID int, at time.Time) error {
+	query := `UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, at.UTC(), userID)
+	return err
+}
+
+type SQLiteUserTokenRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteUserTokenRepository(db *sql.DB) *SQLiteUserTokenRepository {
+	return &SQLiteUserTokenRepository{db: db}
+}
+
+func (r *SQLiteUserTokenRepository) Create(ctx context.Context, token *model.UserToken) error {
+	query := `INSERT INTO user_tokens (token_hash, user_id, purpose, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := r.db.ExecContext(ctx, query, token.Hash, token.UserID, token.Purpose, token.CreatedAt.UTC(), token.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteUserTokenRepository) Consume(ctx context.Context, hash, purpose string, at time.Time) (*model.UserToken, error) {
+	query := `
+		UPDATE user_tokens SET used_at = ?
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL
+		RETURNING token_hash, user_id, purpose, created_at, expires_at, used_at
+	`
+	var t model.UserToken
+	err := r.db.QueryRowContext(ctx, query, at.UTC(), hash, purpose).
+		Scan(&t.Hash, &t.UserID, &t.Purpose, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *SQLiteUserTokenRepository) InvalidateForUser(ctx context.Context, userID int, purpose string, at time.Time) error {
+	query := `UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, at.UTC(), userID, purpose)
+	return err
+}
+
+type SQLiteLoginThrottleRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteLoginThrottleRepository(db *sql.DB) *SQLiteLoginThrottleRepository {
+	return &SQLiteLoginThrottleRepository{db: db}
+}
+
+func (r *SQLiteLoginThrottleRepository) Get(ctx context.Context, key string) (*model.LoginThrottle, error) {
+	query := `SELECT throttle_key, failures, last_failure_at FROM login_throttles WHERE throttle_key = ?`
+	var t model.LoginThrottle
+	err := r.db.QueryRowContext(ctx, query, key).Scan(&t.Key, &t.Failures, &t.LastFailureAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login throttle: %w", err)
+	}
+	return &t, nil
+}
+
+func (r *SQLiteLoginThrottleRepository) RecordFailure(ctx context.Context, key string, at, forgetBefore time.Time) (*model.LoginThrottle, error) {
+	query := `
+		INSERT INTO login_throttles (throttle_key, failures, last_failure_at) VALUES (?1, 1, ?2)
+		ON CONFLICT (throttle_key) DO UPDATE
+		SET failures = CASE WHEN login_throttles.last_failure_at < ?3 THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING throttle_key, failures, last_failure_at
+	`
+	var t model.LoginThrottle
+	err := r.db.QueryRowContext(ctx, query, key, at.UTC(), forgetBefore.UTC()).Scan(&t.Key, &t.Failures, &t.LastFailureAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+	return &t, nil
+}
+
+func (r *SQLiteLoginThrottleRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_throttles WHERE throttle_key = ?`, key)
+	return err
+}
+
+// sqliteEnqueue writes an outbox event inside tx, so it is only delivered if
+// the change it announces commits. It returns the event's ID.
+func sqliteEnqueue(ctx context.Context, tx *sql.Tx, kind, payload string) (int, error) {
+	now := time.Now().UTC()
+	query := `INSERT INTO outbox (kind, payload, next_attempt_at, created_at) VALUES (?, ?, ?, ?) RETURNING id`
+	var id int
+	if err := tx.QueryRowContext(ctx, query, kind, payload, now, now).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to enqueue %s event: %w", kind, err)
+	}
+	slog.DebugContext(ctx, "outbox event queued", "event_id", id, "kind", kind)
+	return id, nil
+}
+
+type SQLiteOutboxRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteOutboxRepository(db *sql.DB) *SQLiteOutboxRepository {
+	return &SQLiteOutboxRepository{db: db}
+}
+
+func (r *SQLiteOutboxRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error) {
+	query := `
+		UPDATE outbox SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY id
+			LIMIT ?
+		)
+		RETURNING id, kind, payload, status, attempts, last_error, next_attempt_at, created_at, sent_at
+	`
+	events, err := r.list(ctx, query, leaseUntil.UTC(), model.OutboxPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (r *SQLiteOutboxRepository) MarkSent(ctx context.Context, id int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE outbox SET status = ?, sent_at = ? WHERE id = ?`, model.OutboxSent, at.UTC(), id)
+	return err
+}
+
+func (r *SQLiteOutboxRepository) Fail(ctx context.Context, id int, lastErr string, retryAt time.Time, dead bool) error {
+	status := model.OutboxPending
+	if dead {
+		status = model.OutboxDead
+	}
+	query := `UPDATE outbox SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, status, lastErr, retryAt.UTC(), id)
+	return err
+}
+
+func (r *SQLiteOutboxRepository) Get(ctx context.Context, id int) (*model.OutboxEvent, error) {
+	e, err := scanOutboxEvent(r.db.QueryRowContext(ctx, outboxSelect+` WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *SQLiteOutboxRepository) List(ctx context.Context, status model.OutboxStatus, limit int) ([]model.OutboxEvent, error) {
+	return r.list(ctx, outboxSelect+` WHERE ?1 = '' OR status = ?1 ORDER BY id DESC LIMIT ?2`, status, limit)
+}
+
+func (r *SQLiteOutboxRepository) Replay(ctx context.Context, id int, at time.Time) (bool, error) {
+	query := `UPDATE outbox SET status = ?, attempts = 0, next_attempt_at = ? WHERE id = ? AND status = ?`
+	res, err := r.db.ExecContext(ctx, query, model.OutboxPending, at.UTC(), id, model.OutboxDead)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *SQLiteOutboxRepository) list(ctx context.Context, query string, args ...any) ([]model.OutboxEvent, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.OutboxEvent{}
+	for rows.Next() {
+		e, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+type SQLiteReminderRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteReminderRepository(db *sql.DB) *SQLiteReminderRepository {
+	return &SQLiteReminderRepository{db: db}
+}
+
+func (r *SQLiteReminderRepository) Due(ctx context.Context, offset time.Duration, from, to time.Time, limit int) ([]model.Appointment, error) {
+	query := appointmentSelect + `
+		WHERE a.status = ? AND a.time > ? AND a.time <= ?
+		AND NOT EXISTS (
+			SELECT 1 FROM appointment_reminders r
+			WHERE r.appointment_id = a.id AND r.offset_minutes = ? AND r.appointment_time = a.time
+		)
+		ORDER BY a.time ASC, a.id ASC
+		LIMIT ?
+	`
+	apps := &SQLiteAppointmentRepository{db: r.db}
+	return apps.list(ctx, query, model.StatusScheduled, from.UTC(), to.UTC(), int(offset/time.Minute), limit)
+}
+
+func (r *SQLiteReminderRepository) Queue(ctx context.Context, app model.Appointment, offset time.Duration, at time.Time) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	outboxID, err := sqliteEnqueue(ctx, tx, model.EventAppointmentReminder, appointmentEventPayload(ctx, app.ID, app.Time, nil))
+	if err != nil {
+		return false, err
+	}
+	query := `
+		INSERT INTO appointment_reminders (appointment_id, offset_minutes, appointment_time, outbox_id, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`
+	res, err := tx.ExecContext(ctx, query, app.ID, int(offset/time.Minute), app.Time.UTC(), outboxID, at.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to record reminder: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		// Already queued: the rollback discards the duplicate event.
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *SQLiteReminderRepository) ListByAppointment(ctx context.Context, appointmentID int) ([]model.Reminder, error) {
+	query := reminderSelect + `WHERE r.appointment_id = ? ORDER BY r.appointment_time ASC, r.offset_minutes DESC`
+	rows, err := r.db.QueryContext(ctx, query, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []model.Reminder{}
+	for rows.Next() {
+		rem, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, rem)
+	}
+	return reminders, rows.Err()
+}
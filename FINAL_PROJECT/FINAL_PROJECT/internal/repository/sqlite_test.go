@@ -0,0 +1,34 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"clinic-cli/internal/db"
+	"clinic-cli/internal/migrate"
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/repository/repositorytest"
+)
+
+func newSQLiteRegistry(t *testing.T) *repository.Registry {
+	t.Helper()
+	conn, err := db.ConnectSQLite("sqlite://:memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	m, err := migrate.New(conn, migrate.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return repository.NewSQLiteRegistry(conn)
+}
+
+func TestSQLiteRepositories(t *testing.T) {
+	repositorytest.Run(t, newSQLiteRegistry)
+}
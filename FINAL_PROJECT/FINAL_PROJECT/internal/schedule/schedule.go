@@ -0,0 +1,139 @@
+// Package schedule turns weekly working-hour templates into bookable slots.
+package schedule
+
+import (
+	"clinic-cli/internal/model"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const DefaultSlotLength = 30 * time.Minute
+
+// DefaultWeek is used for doctors who have no working hours configured:
+// Monday to Friday, 09:00 to 17:00.
+func DefaultWeek() []model.WorkingHours {
+	var week []model.WorkingHours
+	for d := time.Monday; d <= time.Friday; d++ {
+		week = append(week, model.WorkingHours{Weekday: d, Start: "09:00", End: "17:00"})
+	}
+	return week
+}
+
+// ParseClock converts "HH:MM" into minutes after midnight. "24:00" is
+// accepted as the end of the day.
+func ParseClock(s string) (int, error) {
+	if len(s) != 5 || s[2] != ':' {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	h, errH := strconv.Atoi(s[:2])
+	m, errM := strconv.Atoi(s[3:])
+	if errH != nil || errM != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return h*60 + m, nil
+}
+
+// Validate checks that every entry is well formed and that entries on the
+// same weekday do not overlap.
+func Validate(hours []model.WorkingHours) error {
+	type span struct{ start, end int }
+	byDay := make(map[time.Weekday][]span)
+
+	for _, h := range hours {
+		if h.Weekday < time.Sunday || h.Weekday > time.Saturday {
+			return fmt.Errorf("invalid weekday %d", h.Weekday)
+		}
+		start, err := ParseClock(h.Start)
+		if err != nil {
+			return err
+		}
+		end, err := ParseClock(h.End)
+		if err != nil {
+			return err
+		}
+		if start >= end {
+			return fmt.Errorf("%s: start %s must be before end %s", h.Weekday, h.Start, h.End)
+		}
+		byDay[h.Weekday] = append(byDay[h.Weekday], span{start, end})
+	}
+
+	for day, spans := range byDay {
+		sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+		for i := 1; i < len(spans); i++ {
+			if spans[i].start < spans[i-1].end {
+				return fmt.Errorf("%s: working hours overlap", day)
+			}
+		}
+	}
+	return nil
+}
+
+var ErrInvalidRange = errors.New("invalid range: from must be before to")
+
+// FreeSlots lists the slots of the given length that start within [from, to),
+// fall inside the working hours (interpreted in loc) and do not overlap any
+// booked appointment. Booked appointments are assumed to last one slot.
+func FreeSlots(hours []model.WorkingHours, booked []time.Time, from, to time.Time, length time.Duration, loc *time.Location) ([]model.Slot, error) {
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+	if length <= 0 {
+		return nil, fmt.Errorf("invalid slot length %s", length)
+	}
+	if err := Validate(hours); err != nil {
+		return nil, err
+	}
+
+	slots := []model.Slot{}
+	first := from.In(loc)
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, h := range hours {
+			if h.Weekday != day.Weekday() {
+				continue
+			}
+			startMin, _ := ParseClock(h.Start)
+			endMin, _ := ParseClock(h.End)
+			open := time.Date(day.Year(), day.Month(), day.Day(), 0, startMin, 0, 0, loc)
+			closing := time.Date(day.Year(), day.Month(), day.Day(), 0, endMin, 0, 0, loc)
+
+			for s := open; !s.Add(length).After(closing); s = s.Add(length) {
+				if s.Before(from) || !s.Before(to) {
+					continue
+				}
+				if overlapsBooked(s, length, booked) {
+					continue
+				}
+				slots = append(slots, model.Slot{Start: s, End: s.Add(length)})
+			}
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Start.Before(slots[j].Start) })
+	return slots, nil
+}
+
+// IsFree reports whether t is the exact start of a free slot.
+func IsFree(hours []model.WorkingHours, booked []time.Time, t time.Time, length time.Duration, loc *time.Location) (bool, error) {
+	slots, err := FreeSlots(hours, booked, t, t.Add(time.Nanosecond), length, loc)
+	if err != nil {
+		return false, err
+	}
+	return len(slots) == 1 && slots[0].Start.Equal(t), nil
+}
+
+func overlapsBooked(start time.Time, length time.Duration, booked []time.Time) bool {
+	end := start.Add(length)
+	for _, b := range booked {
+		if b.Before(end) && start.Before(b.Add(length)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"clinic-cli/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hours   []model.WorkingHours
+		wantErr bool
+	}{
+		{"default week", DefaultWeek(), false},
+		{"split shift", []model.WorkingHours{{Weekday: time.Monday, Start: "08:00", End: "12:00"}, {Weekday: time.Monday, Start: "13:00", End: "17:00"}}, false},
+		{"until midnight", []model.WorkingHours{{Weekday: time.Sunday, Start: "20:00", End: "24:00"}}, false},
+		{"bad clock", []model.WorkingHours{{Weekday: time.Monday, Start: "9am", End: "17:00"}}, true},
+		{"start after end", []model.WorkingHours{{Weekday: time.Monday, Start: "17:00", End: "09:00"}}, true},
+		{"bad weekday", []model.WorkingHours{{Weekday: 7, Start: "09:00", End: "17:00"}}, true},
+		{"overlap", []model.WorkingHours{{Weekday: time.Monday, Start: "08:00", End: "12:00"}, {Weekday: time.Monday, Start: "11:00", End: "17:00"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.hours)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	loc := time.FixedZone("clinic", 2*60*60)
+	hours := []model.WorkingHours{{Weekday: time.Monday, Start: "09:00", End: "11:00"}}
+	monday := time.Date(2030, 1, 7, 0, 0, 0, 0, loc)
+	booked := []time.Time{time.Date(2030, 1, 7, 9, 30, 0, 0, loc).UTC()}
+
+	slots, err := FreeSlots(hours, booked, monday, monday.AddDate(0, 0, 7), 30*time.Minute, loc)
+	require.NoError(t, err)
+
+	var starts []string
+	for _, s := range slots {
+		starts = append(starts, s.Start.In(loc).Format("Mon 15:04"))
+		assert.Equal(t, 30*time.Minute, s.End.Sub(s.Start))
+	}
+	assert.Equal(t, []string{"Mon 09:00", "Mon 10:00", "Mon 10:30"}, starts)
+}
+
+func TestFreeSlots_RangeClipsSlots(t *testing.T) {
+	loc := time.UTC
+	hours := []model.WorkingHours{{Weekday: time.Monday, Start: "09:00", End: "12:00"}}
+	from := time.Date(2030, 1, 7, 10, 15, 0, 0, loc)
+	to := time.Date(2030, 1, 7, 11, 30, 0, 0, loc)
+
+	slots, err := FreeSlots(hours, nil, from, to, 30*time.Minute, loc)
+	require.NoError(t, err)
+	require.Len(t, slots, 2)
+	assert.Equal(t, 10, slots[0].Start.Hour())
+	assert.Equal(t, 30, slots[0].Start.Minute())
+	assert.Equal(t, 11, slots[1].Start.Hour())
+
+	_, err = FreeSlots(hours, nil, to, from, 30*time.Minute, loc)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+}
+
+func TestIsFree(t *testing.T) {
+	loc := time.UTC
+	hours := DefaultWeek()
+	monday9 := time.Date(2030, 1, 7, 9, 0, 0, 0, loc)
+
+	ok, err := IsFree(hours, nil, monday9, 30*time.Minute, loc)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, _ = IsFree(hours, nil, monday9.Add(10*time.Minute), 30*time.Minute, loc)
+	assert.False(t, ok, "must start on a slot boundary")
+
+	ok, _ = IsFree(hours, nil, monday9.Add(-time.Hour), 30*time.Minute, loc)
+	assert.False(t, ok, "outside working hours")
+
+	ok, _ = IsFree(hours, []time.Time{monday9}, monday9, 30*time.Minute, loc)
+	assert.False(t, ok, "already booked")
+
+	saturday := time.Date(2030, 1, 12, 10, 0, 0, 0, loc)
+	ok, _ = IsFree(hours, nil, saturday, 30*time.Minute, loc)
+	assert.False(t, ok, "default week has no weekend hours")
+}
@@ -0,0 +1,575 @@
+package service
+
+import (
+	"clinic-cli/internal/apperr"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/validation"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials  = apperr.New(apperr.ErrUnauthorized, "invalid credentials")
+	ErrInvalidRefreshToken = apperr.New(apperr.ErrUnauthorized, "invalid or expired refresh token")
+	ErrSessionNotFound     = apperr.New(apperr.ErrNotFound, "session not found")
+	ErrInvalidResetToken   = errors.New("invalid or expired reset token")
+	ErrWeakPassword        = fmt.Errorf("must be %d to %d characters with at least one letter and one digit", MinPasswordLength, MaxPasswordLength)
+	ErrInvalidVerifyToken  = errors.New("invalid or expired verification token")
+	ErrUserNotFound        = apperr.New(apperr.ErrNotFound, "user not found")
+	ErrEmailTaken          = repository.ErrEmailTaken
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+	DefaultResetTokenTTL   = time.Hour
+	DefaultVerifyTokenTTL  = 48 * time.Hour
+)
+
+type AuthConfig struct {
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	ResetTokenTTL   time.Duration
+	VerifyTokenTTL  time.Duration
+	// AccountThrottle and IPThrottle default to DefaultAccountThrottle and
+	// DefaultIPThrottle when left zero.
+	AccountThrottle ThrottlePolicy
+	IPThrottle      ThrottlePolicy
+}
+
+type AuthService struct {
+	repo       repository.UserRepository
+	sessions   repository.SessionRepository
+	tokens     repository.UserTokenRepository
+	throttles  repository.LoginThrottleRepository
+	mailChan   chan<- model.Email
+	jwtSecret  string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	resetTTL   time.Duration
+	verifyTTL  time.Duration
+
+	accountThrottle ThrottlePolicy
+	ipThrottle      ThrottlePolicy
+	now             func() time.Time
+}
+
+// NewAuthService wires the service to its repositories. Outgoing e-mail is
+// handed to the background worker through mailChan.
+func NewAuthService(repos *repository.Registry, mailChan chan<- model.Email, cfg AuthConfig) *AuthService {
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if cfg.RefreshTokenTTL <= 0 {
+		cfg.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+	if cfg.ResetTokenTTL <= 0 {
+		cfg.ResetTokenTTL = DefaultResetTokenTTL
+	}
+	if cfg.VerifyTokenTTL <= 0 {
+		cfg.VerifyTokenTTL = DefaultVerifyTokenTTL
+	}
+	if cfg.AccountThrottle == (ThrottlePolicy{}) {
+		cfg.AccountThrottle = DefaultAccountThrottle
+	}
+	if cfg.IPThrottle == (ThrottlePolicy{}) {
+		cfg.IPThrottle = DefaultIPThrottle
+	}
+	return &AuthService{
+		repo:       repos.User,
+		sessions:   repos.Session,
+		tokens:     repos.UserToken,
+		throttles:  repos.LoginThrottle,
+		mailChan:   mailChan,
+		jwtSecret:  cfg.JWTSecret,
+		accessTTL:  cfg.AccessTokenTTL,
+		refreshTTL: cfg.RefreshTokenTTL,
+		resetTTL:   cfg.ResetTokenTTL,
+		verifyTTL:  cfg.VerifyTokenTTL,
+
+		accountThrottle: cfg.AccountThrottle,
+		ipThrottle:      cfg.IPThrottle,
+		now:             func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// TokenPair is what a client receives when it signs in or refreshes. The
+// refresh token is only ever shown once; the next refresh replaces it.
+type TokenPair struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	SessionID    string    `json:"session_id"`
+}
+
+// Password policy. bcrypt ignores everything past 72 bytes.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// CheckPassword enforces the password policy for new passwords.
+func CheckPassword(password string) error {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return ErrWeakPassword
+	}
+	hasLetter := strings.IndexFunc(password, unicode.IsLetter) >= 0
+	hasDigit := strings.IndexFunc(password, unicode.IsDigit) >= 0
+	if !hasLetter || !hasDigit {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+// Register creates an unverified account and e-mails the token that
+// verifies it.
+func (s *AuthService) Register(ctx context.Context, email, password string, role model.Role) (*model.User, error) {
+	hash, err := newAccountHash(email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == "" {
+		role = model.RolePatient
+	}
+
+	user, err := s.repo.Create(ctx, email, hash, role)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "user registered", "user_id", user.ID, "role", user.Role)
+	if err := s.sendVerification(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// dummyHash is a bcrypt hash of a random password, compared against when no
+// account matches.
+const dummyHash = "$2a$10$9IpiJmJenKYylOJSbnPChescdlgldfigIpeRsvpyhSdwquam5gPJG"
+
+// ComparePassword reports whether password matches the bcrypt hash. An
+// empty hash, for an account that does not exist, still costs a full
+// comparison, so response times do not reveal which accounts exist.
+func ComparePassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// newAccountHash validates the credentials of a new account and returns the
+// bcrypt hash of its password.
+func newAccountHash(email, password string) (string, error) {
+	v := &validation.Error{}
+	v.Add(validation.InBody, "email", validation.Email(email))
+	v.Add(validation.InBody, "password", CheckPassword(password))
+	if err := v.Err(); err != nil {
+		return "", err
+	}
+
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedBytes), nil
+}
+
+// VerifyEmail marks the account a token from Register or
+// ResendVerification was sent to as verified.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	now := s.now()
+	t, err := s.useToken(ctx, token, model.TokenEmailVerification, now)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return validation.Query("token", ErrInvalidVerifyToken)
+	}
+	if err := s.repo.MarkEmailVerified(ctx, t.UserID, now); err != nil {
+		return err
+	}
+	return s.tokens.InvalidateForUser(ctx, t.UserID, model.TokenEmailVerification, now)
+}
+
+// ResendVerification replaces any outstanding verification token with a new
+// one. Like ForgotPassword it does not reveal whether the address exists, or
+// whether it is already verified.
+func (s *AuthService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified() {
+		return nil
+	}
+	if err := s.tokens.InvalidateForUser(ctx, user.ID, model.TokenEmailVerification, s.now()); err != nil {
+		return err
+	}
+	return s.sendVerification(ctx, user)
+}
+
+// EmailVerified reports whether the user has confirmed their address.
+func (s *AuthService) EmailVerified(ctx context.Context, userID int) (bool, error) {
+	user, err := s.repo.GetByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerified(), nil
+}
+
+func (s *AuthService) sendVerification(ctx context.Context, user *model.User) error {
+	token, err := s.newToken(ctx, user.ID, model.TokenEmailVerification, s.verifyTTL)
+	if err != nil {
+		return err
+	}
+	return s.sendMail(ctx, model.Email{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Use this token to verify your address within %s:\n\n%s\n\n"+
+			"You can book appointments once your address is verified.", s.verifyTTL, token),
+	})
+}
+
+// Login checks the credentials and opens a new session for the device.
+// Failed attempts are counted per account and per client address ip (which
+// may be empty); once either has failed too often, Login returns a
+// ThrottledError without looking at the password.
+func (s *AuthService) Login(ctx context.Context, email, password, device, ip string) (*TokenPair, error) {
+	now := s.now()
+	keys := s.throttleKeys(email, ip)
+	account := accountKey(email)
+	seen, err := s.checkThrottle(ctx, keys, account, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.countAttempt(ctx, account, seen, now); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	var hash string
+	if user != nil {
+		hash = user.PasswordHash
+	}
+	if !ComparePassword(hash, password) {
+		if err := s.recordFailure(ctx, keys, account, now); err != nil {
+			return nil, err
+		}
+		slog.WarnContext(ctx, "login failed", "ip", ip)
+		return nil, ErrInvalidCredentials
+	}
+	if err := s.throttles.Reset(ctx, account); err != nil {
+		return nil, err
+	}
+
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	session := &model.Session{
+		ID:          sessionID,
+		UserID:      user.ID,
+		Device:      device,
+		RefreshHash: hashToken(secret),
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(s.refreshTTL),
+	}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "user logged in", "user_id", user.ID, "ip", ip)
+	return s.issue(user, sessionID, secret, now)
+}
+
+// Refresh exchanges a refresh token for a new token pair and invalidates the
+// presented one. Presenting a refresh token that has already been rotated
+// means it was copied, so the whole session is revoked.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+	session, err := s.sessions.GetByID(ctx, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if !session.Active(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	next, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.sessions.Rotate(ctx, sessionID, hashToken(secret), hashToken(next), now, now.Add(s.refreshTTL))
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		if err := s.sessions.Revoke(ctx, sessionID, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.repo.GetByID(ctx, session.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(user, sessionID, next, now)
+}
+
+// SessionActive reports whether access tokens of the session are still
+// accepted. AuthMiddleware calls it on every authenticated request.
+func (s *AuthService) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	session, err := s.sessions.GetByID(ctx, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return session.Active(s.now()), nil
+}
+
+func (s *AuthService) Sessions(ctx context.Context, userID int) ([]model.Session, error) {
+	sessions, err := s.sessions.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	active := []model.Session{}
+	for _, session := range sessions {
+		if session.Active(now) {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+// Logout revokes one of the user's sessions.
+func (s *AuthService) Logout(ctx context.Context, userID int, sessionID string) error {
+	session, err := s.sessions.GetByID(ctx, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return s.sessions.Revoke(ctx, sessionID, s.now())
+}
+
+// LogoutAll revokes every session of the user, signing out all devices.
+func (s *AuthService) LogoutAll(ctx context.Context, userID int) error {
+	return s.sessions.RevokeAllForUser(ctx, userID, s.now())
+}
+
+// ForgotPassword e-mails a single-use reset token to the account. Unknown
+// addresses are accepted silently so the endpoint cannot be used to find out
+// who is registered.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := s.newToken(ctx, user.ID, model.TokenPasswordReset, s.resetTTL)
+	if err != nil {
+		return err
+	}
+	return s.sendMail(ctx, model.Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use this token to choose a new password within %s:\n\n%s\n\n"+
+			"If you did not ask for a reset, you can ignore this message.", s.resetTTL, token),
+	})
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword. The
+// token is used up, and every session of the user is revoked so a stolen
+// session does not outlive the password change.
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if err := CheckPassword(newPassword); err != nil {
+		return validation.Body("password", err)
+	}
+
+	now := s.now()
+	t, err := s.useToken(ctx, token, model.TokenPasswordReset, now)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return validation.Body("token", ErrInvalidResetToken)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(ctx, t.UserID, string(hashed)); err != nil {
+		return err
+	}
+	if err := s.tokens.InvalidateForUser(ctx, t.UserID, model.TokenPasswordReset, now); err != nil {
+		return err
+	}
+	if err := s.sessions.RevokeAllForUser(ctx, t.UserID, now); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "password reset", "user_id", t.UserID)
+	return nil
+}
+
+// newToken stores the hash of a fresh single-use token and returns the
+// token itself, which is only ever sent to the user.
+func (s *AuthService) newToken(ctx context.Context, userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := s.now()
+	err = s.tokens.Create(ctx, &model.UserToken{
+		Hash:      hashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// useToken consumes the token and returns it, or nil when it is unknown,
+// already used or expired.
+func (s *AuthService) useToken(ctx context.Context, token, purpose string, now time.Time) (*model.UserToken, error) {
+	t, err := s.tokens.Consume(ctx, hashToken(token), purpose, now)
+	if err != nil || t == nil {
+		return nil, err
+	}
+	if !now.Before(t.ExpiresAt) {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// sendMail queues an e-mail for the worker, waiting for room in the queue
+// rather than dropping the message.
+func (s *AuthService) sendMail(ctx context.Context, mail model.Email) error {
+	select {
+	case s.mailChan <- mail:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *AuthService) issue(user *model.User, sessionID, secret string, now time.Time) (*TokenPair, error) {
+	expiresAt := now.Add(s.accessTTL)
+	claims := jwt.MapClaims{
+		"sub":   user.ID,
+		"sid":   sessionID,
+		"email": user.Email,
+		"role":  user.Role,
+		"exp":   expiresAt.Unix(),
+	}
+	if user.DoctorID != nil {
+		claims["doctor_id"] = *user.DoctorID
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	tokenString, err := token.SignedString([]byte(s.jwtSecret))
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  tokenString,
+		RefreshToken: sessionID + "." + secret,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+		SessionID:    sessionID,
+	}, nil
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is used for high-entropy random tokens only, where a fast hash
+// is enough; passwords go through bcrypt.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateDoctorAccount registers a doctor-role user linked to doctorID. The
+// account is created and linked in one repository call, so a clash leaves
+// nothing behind, and the verification e-mail only goes out once it exists.
+func (s *AuthService) CreateDoctorAccount(ctx context.Context, email, password string, doctorID int) (*model.User, error) {
+	hash, err := newAccountHash(email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.CreateDoctorAccount(ctx, email, hash, doctorID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrDoctorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "doctor account created", "user_id", user.ID, "doctor_id", doctorID)
+	if err := s.sendVerification(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
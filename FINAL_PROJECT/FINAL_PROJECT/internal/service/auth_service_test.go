@@ -1,66 +1,362 @@
-package service
-
-import (
-	"context"
-	"testing"
-
-	"clinic-cli/internal/model"
-
-	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
-)
-
-type MockUserRepo struct {
-	mock.Mock
-}
-type UserRepository interface {
-	Create(ctx context.Context, email, passwordHash string, role model.Role) (*model.User, error)
-}
-
-func (m *MockUserRepo) Create(ctx context.Context, email, passwordHash string, role model.Role) (*model.User, error) {
-	args := m.Called(ctx, email, passwordHash, role)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*model.User), args.Error(1)
-}
-
-func (m *MockUserRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
-	args := m.Called(ctx, email)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*model.User), args.Error(1)
-}
-
-func (m *MockUserRepo) GetByID(ctx context.Context, id int) (*model.User, error) {
-	return nil, nil
-}
-
-func TestAuthService_Register(t *testing.T) {
-	repo := new(MockUserRepo)
-	service := NewAuthService(repo, "secret")
-
-	repo.On(
-		"Create",
-		mock.Anything,
-		"test@example.com",
-		mock.AnythingOfType("string"),
-		model.RolePatient,
-	).Return(&model.User{
-		ID:    1,
-		Email: "test@example.com",
-	}, nil)
-
-	user, err := service.Register(
-		context.Background(),
-		"test@example.com",
-		"password123",
-		model.RolePatient,
-	)
-
-	assert.NoError(t, err)
-	assert.NotNil(t, user)
-
-	repo.AssertExpectations(t)
-}
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/validation"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthService_Register(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	service := NewAuthService(repos, make(chan model.Email, 10), AuthConfig{JWTSecret: "secret"})
+
+	user, err := service.Register(
+		context.Background(),
+		"test@example.com",
+		"password123",
+		model.RolePatient,
+	)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, user)
+	assert.Equal(t, "test@example.com", user.Email)
+	assert.NotEqual(t, "password123", user.PasswordHash)
+
+	stored, err := repos.User.GetByEmail(context.Background(), "test@example.com")
+	assert.NoError(t, err)
+	assert.NotNil(t, stored)
+}
+
+func TestAuthService_RegisterValidatesInput(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	service := NewAuthService(repos, make(chan model.Email, 10), AuthConfig{JWTSecret: "secret"})
+
+	_, err := service.Register(context.Background(), "Ann <ann@example.com>", "password", "")
+	verr, ok := validation.As(err)
+	require.True(t, ok, "got %v", err)
+	assert.Equal(t, []validation.FieldError{
+		{In: "body", Field: "email", Message: "must be a valid email address"},
+		{In: "body", Field: "password", Message: ErrWeakPassword.Error()},
+	}, verr.Fields)
+	assert.ErrorIs(t, err, ErrWeakPassword)
+
+	for _, password := range []string{"", "abc123", "12345678", strings.Repeat("a1", 37)} {
+		assert.ErrorIs(t, CheckPassword(password), ErrWeakPassword, password)
+	}
+	assert.NoError(t, CheckPassword("correct horse 1"))
+}
+
+func TestAuthService_Login(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	service := NewAuthService(repos, make(chan model.Email, 10), AuthConfig{JWTSecret: "secret"})
+	ctx := context.Background()
+
+	_, err := service.Register(ctx, "test@example.com", "password123", "")
+	assert.NoError(t, err)
+
+	tokens, err := service.Login(ctx, "test@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	_, err = service.Login(ctx, "test@example.com", "wrong", "laptop", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = service.Login(ctx, "nobody@example.com", "password123", "laptop", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestAuthService_CreateDoctorAccount(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	service := NewAuthService(repos, make(chan model.Email, 10), AuthConfig{JWTSecret: "secret"})
+	ctx := context.Background()
+
+	doctor, err := repos.Doctor.Create(ctx, "Dr. Grey", "Surgery")
+	assert.NoError(t, err)
+
+	user, err := service.CreateDoctorAccount(ctx, "grey@example.com", "password123", doctor.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RoleDoctor, user.Role)
+
+	tokens, err := service.Login(ctx, "grey@example.com", "password123", "", "")
+	assert.NoError(t, err)
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokens.AccessToken, claims, func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil })
+	assert.NoError(t, err)
+	assert.Equal(t, float64(doctor.ID), claims["doctor_id"])
+
+	_, err = service.CreateDoctorAccount(ctx, "other@example.com", "password123", doctor.ID)
+	assert.ErrorIs(t, err, repository.ErrDoctorAlreadyLinked)
+	_, err = service.CreateDoctorAccount(ctx, "other@example.com", "password123", doctor.ID+1)
+	assert.ErrorIs(t, err, ErrDoctorNotFound)
+
+	// The failed attempts neither kept an account nor sent it mail, so the
+	// address is still free.
+	mails := make(chan model.Email, 10)
+	service = NewAuthService(repos, mails, AuthConfig{JWTSecret: "secret"})
+	_, err = service.Register(ctx, "other@example.com", "password123", model.RolePatient)
+	assert.NoError(t, err)
+	assert.Len(t, mails, 1)
+}
+
+func TestAuthService_RefreshRotatesTokens(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	service := NewAuthService(repos, make(chan model.Email, 10), AuthConfig{JWTSecret: "secret"})
+	ctx := context.Background()
+
+	user, err := service.Register(ctx, "test@example.com", "password123", "")
+	require.NoError(t, err)
+	first, err := service.Login(ctx, "test@example.com", "password123", "phone", "")
+	require.NoError(t, err)
+
+	second, err := service.Refresh(ctx, first.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, first.SessionID, second.SessionID)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	_, err = service.Refresh(ctx, "garbage")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// Replaying the rotated token means it leaked: the session is revoked,
+	// which also locks out the holder of the newer token.
+	_, err = service.Refresh(ctx, first.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = service.Refresh(ctx, second.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	active, err := service.SessionActive(ctx, first.SessionID)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	sessions, err := service.Sessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestAuthService_Logout(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	service := NewAuthService(repos, make(chan model.Email, 10), AuthConfig{JWTSecret: "secret"})
+	ctx := context.Background()
+
+	user, err := service.Register(ctx, "test@example.com", "password123", "")
+	require.NoError(t, err)
+	phone, err := service.Login(ctx, "test@example.com", "password123", "phone", "")
+	require.NoError(t, err)
+	laptop, err := service.Login(ctx, "test@example.com", "password123", "laptop", "")
+	require.NoError(t, err)
+	_, err = service.Login(ctx, "test@example.com", "password123", "tablet", "")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, service.Logout(ctx, user.ID+1, phone.SessionID), ErrSessionNotFound)
+	require.NoError(t, service.Logout(ctx, user.ID, phone.SessionID))
+	active, err := service.SessionActive(ctx, phone.SessionID)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	sessions, err := service.Sessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	require.NoError(t, service.LogoutAll(ctx, user.ID))
+	active, err = service.SessionActive(ctx, laptop.SessionID)
+	require.NoError(t, err)
+	assert.False(t, active)
+}
+
+func TestAuthService_ResetPassword(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	mail := make(chan model.Email, 10)
+	service := NewAuthService(repos, mail, AuthConfig{JWTSecret: "secret"})
+	ctx := context.Background()
+
+	_, err := service.Register(ctx, "test@example.com", "password123", "")
+	require.NoError(t, err)
+	mailedToken(t, mail)
+	session, err := service.Login(ctx, "test@example.com", "password123", "phone", "")
+	require.NoError(t, err)
+
+	require.NoError(t, service.ForgotPassword(ctx, "nobody@example.com"))
+	assert.Empty(t, mail)
+
+	require.NoError(t, service.ForgotPassword(ctx, "test@example.com"))
+	token := mailedToken(t, mail)
+
+	assert.ErrorIs(t, service.ResetPassword(ctx, "garbage", "newpassword1"), ErrInvalidResetToken)
+	assert.ErrorIs(t, service.ResetPassword(ctx, token, "newpassword"), ErrWeakPassword)
+	require.NoError(t, service.ResetPassword(ctx, token, "newpassword1"))
+	assert.ErrorIs(t, service.ResetPassword(ctx, token, "password789"), ErrInvalidResetToken)
+
+	active, err := service.SessionActive(ctx, session.SessionID)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	_, err = service.Login(ctx, "test@example.com", "password123", "", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = service.Login(ctx, "test@example.com", "newpassword1", "", "")
+	assert.NoError(t, err)
+}
+
+func TestAuthService_VerifyEmail(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	mail := make(chan model.Email, 10)
+	service := NewAuthService(repos, mail, AuthConfig{JWTSecret: "secret"})
+	ctx := context.Background()
+
+	user, err := service.Register(ctx, "test@example.com", "password123", "")
+	require.NoError(t, err)
+	first := mailedToken(t, mail)
+	verified, err := service.EmailVerified(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, verified)
+
+	// Resending replaces the outstanding token.
+	require.NoError(t, service.ResendVerification(ctx, "test@example.com"))
+	second := mailedToken(t, mail)
+	assert.ErrorIs(t, service.VerifyEmail(ctx, first), ErrInvalidVerifyToken)
+
+	require.NoError(t, service.VerifyEmail(ctx, second))
+	verified, err = service.EmailVerified(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, verified)
+	assert.ErrorIs(t, service.VerifyEmail(ctx, second), ErrInvalidVerifyToken)
+
+	require.NoError(t, service.ResendVerification(ctx, "test@example.com"))
+	require.NoError(t, service.ResendVerification(ctx, "nobody@example.com"))
+	assert.Empty(t, mail)
+}
+
+// mailedToken takes the next queued e-mail and returns the token in it,
+// which sits on its own line after the greeting.
+func mailedToken(t *testing.T, mail <-chan model.Email) string {
+	t.Helper()
+	require.NotEmpty(t, mail)
+	lines := strings.Split((<-mail).Body, "\n")
+	require.Greater(t, len(lines), 2)
+	return lines[2]
+}
+
+func TestComparePassword(t *testing.T) {
+	hash, err := newAccountHash("ann@example.com", "password123")
+	require.NoError(t, err)
+	assert.True(t, ComparePassword(hash, "password123"))
+	assert.False(t, ComparePassword(hash, "password456"))
+	assert.False(t, ComparePassword("", "password123"), "no account never matches")
+
+	// The stand-in hash must cost as much as a real one.
+	dummyCost, err := bcrypt.Cost([]byte(dummyHash))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, dummyCost)
+}
+
+func TestAuthService_LoginThrottling(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	policy := ThrottlePolicy{FreeAttempts: 2, LockoutAfter: 4, BaseDelay: time.Minute, Lockout: time.Hour}
+	service := NewAuthService(repos, make(chan model.Email, 10), AuthConfig{
+		JWTSecret:       "secret",
+		AccountThrottle: policy,
+		IPThrottle:      policy,
+	})
+	now := time.Now().UTC()
+	service.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	user, err := service.Register(ctx, "test@example.com", "password123", "")
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = service.Login(ctx, "test@example.com", "wrong", "", "")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+	_, err = service.Login(ctx, "test@example.com", "wrong", "", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// The third failure starts the backoff, so even the right password is
+	// refused until it has passed.
+	_, err = service.Login(ctx, "test@example.com", "password123", "", "")
+	var throttled *ThrottledError
+	require.ErrorAs(t, err, &throttled)
+	assert.Equal(t, time.Minute, throttled.RetryAfter)
+
+	now = now.Add(59 * time.Second)
+	_, err = service.Login(ctx, "test@example.com", "password123", "", "")
+	require.ErrorAs(t, err, &throttled)
+	assert.Equal(t, time.Second, throttled.RetryAfter)
+
+	require.NoError(t, service.Unlock(ctx, user.ID))
+	_, err = service.Login(ctx, "test@example.com", "password123", "", "")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, service.Unlock(ctx, user.ID+1), ErrUserNotFound)
+
+	// Guessing across accounts from one address slows the address down.
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		_, err = service.Login(ctx, email, "wrong", "", "10.0.0.1")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+	_, err = service.Login(ctx, "test@example.com", "password123", "", "10.0.0.1")
+	assert.ErrorAs(t, err, &throttled)
+	_, err = service.Login(ctx, "test@example.com", "password123", "", "10.0.0.2")
+	assert.NoError(t, err)
+}
+
+func TestAuthService_LoginThrottlingConcurrent(t *testing.T) {
+	repos := repository.NewMemoryRegistry()
+	policy := ThrottlePolicy{FreeAttempts: 2, LockoutAfter: 4, BaseDelay: time.Minute, Lockout: time.Hour}
+	service := NewAuthService(repos, make(chan model.Email, 10), AuthConfig{
+		JWTSecret:       "secret",
+		AccountThrottle: policy,
+		IPThrottle:      policy,
+	})
+	ctx := context.Background()
+	_, err := service.Register(ctx, "test@example.com", "password123", "")
+	require.NoError(t, err)
+
+	// A burst of guesses all pass the check before any of them fails, yet
+	// only the free attempts and the one starting the backoff get through.
+	errs := make(chan error, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.Login(ctx, "test@example.com", "wrong", "", "")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var invalid, throttled int
+	for err := range errs {
+		var te *ThrottledError
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			invalid++
+		case errors.As(err, &te):
+			throttled++
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	assert.Equal(t, policy.FreeAttempts+1, invalid)
+	assert.Equal(t, cap(errs)-invalid, throttled)
+}
+
+func TestThrottlePolicy_Wait(t *testing.T) {
+	p := ThrottlePolicy{FreeAttempts: 3, LockoutAfter: 10, BaseDelay: time.Second, Lockout: 15 * time.Minute}
+	assert.Equal(t, time.Duration(0), p.wait(3))
+	assert.Equal(t, time.Second, p.wait(4))
+	assert.Equal(t, 2*time.Second, p.wait(5))
+	assert.Equal(t, 32*time.Second, p.wait(9))
+	assert.Equal(t, 15*time.Minute, p.wait(10))
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"clinic-cli/internal/apperr"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrFeedNotFound = apperr.New(apperr.ErrNotFound, "calendar feed not found")
+
+// Calendar feed kinds, as they appear in the feed URL.
+const (
+	FeedPatient = "patient"
+	FeedDoctor  = "doctor"
+)
+
+// doctorFeedHistory bounds how far back a doctor's feed reaches.
+const doctorFeedHistory = 90 * 24 * time.Hour
+
+// Appointment returns an appointment the actor has access to.
+func (s *ClinicService) Appointment(ctx context.Context, actor Actor, appID int) (*model.Appointment, error) {
+	return s.accessibleAppointment(ctx, actor, appID)
+}
+
+// RotateCalendarFeed issues a new secret feed path for the actor, replacing
+// any earlier one. Doctors get their agenda, everybody else their own
+// appointments.
+func (s *ClinicService) RotateCalendarFeed(ctx context.Context, actor Actor) (string, error) {
+	kind := FeedPatient
+	if actor.Role == model.RoleDoctor {
+		kind = FeedDoctor
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.userRepo.SetCalendarToken(ctx, actor.UserID, hashToken(token)); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/calendar/%s/%s.ics", kind, token), nil
+}
+
+// CalendarFeed returns the appointments behind a feed URL. Unknown tokens,
+// and tokens used with the wrong kind of feed, are reported as not found.
+func (s *ClinicService) CalendarFeed(ctx context.Context, kind, token string) ([]model.Appointment, error) {
+	user, err := s.userRepo.GetByCalendarToken(ctx, hashToken(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrFeedNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case kind == FeedDoctor && user.Role == model.RoleDoctor && user.DoctorID != nil:
+		return s.appointmentRepo.GetByDoctorID(ctx, *user.DoctorID, time.Now().Add(-doctorFeedHistory), time.Time{})
+	case kind == FeedPatient && user.Role != model.RoleDoctor:
+		return s.appointmentRepo.GetByPatientID(ctx, user.ID)
+	default:
+		return nil, ErrFeedNotFound
+	}
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"clinic-cli/internal/importer"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/validation"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClinic(t *testing.T) (*ClinicService, *repository.Registry, *model.User, *model.Doctor) {
+	t.Helper()
+	ctx := context.Background()
+	repos := repository.NewMemoryRegistry()
+
+	patient, err := repos.User.Create(ctx, "pat@example.com", "hash", model.RolePatient)
+	require.NoError(t, err)
+	doctor, err := repos.Doctor.Create(ctx, "Dr. Grey", "Surgery")
+	require.NoError(t, err)
+
+	svc := NewClinicService(repos, ClinicConfig{
+		SlotLength: 30 * time.Minute,
+		Location:   time.UTC,
+	})
+	return svc, repos, patient, doctor
+}
+
+func TestClinicService_BookAppointmentRespectsSlots(t *testing.T) {
+	svc, _, patient, doctor := newTestClinic(t)
+	ctx := context.Background()
+
+	// 2030-01-07 is a Monday, covered by the default week.
+	app, err := svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-07 09:30")
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusScheduled, app.Status)
+
+	_, err = svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-07 09:30")
+	assert.ErrorIs(t, err, ErrSlotTaken)
+
+	_, err = svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-07 07:00")
+	assert.ErrorIs(t, err, ErrSlotUnavailable, "outside working hours")
+
+	_, err = svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-07 09:10")
+	assert.ErrorIs(t, err, ErrSlotUnavailable, "not on a slot boundary")
+
+	_, err = svc.BookAppointment(ctx, patient.ID, doctor.ID, "next tuesday")
+	assert.ErrorIs(t, err, ErrInvalidTime)
+
+	_, err = svc.BookAppointment(ctx, patient.ID, doctor.ID, "2020-01-06 09:30")
+	assert.ErrorIs(t, err, ErrTimeInPast)
+
+	_, err = svc.BookAppointment(ctx, patient.ID, 0, "")
+	verr, ok := validation.As(err)
+	require.True(t, ok)
+	assert.Len(t, verr.Fields, 2, "every problem is reported at once")
+
+	_, err = svc.BookAppointment(ctx, patient.ID, 4242, "2030-01-07 10:00")
+	assert.ErrorIs(t, err, ErrDoctorNotFound)
+}
+
+func TestClinicService_AvailabilityUsesWorkingHours(t *testing.T) {
+	svc, _, patient, doctor := newTestClinic(t)
+	ctx := context.Background()
+
+	require.NoError(t, svc.SetWorkingHours(ctx, doctor.ID, []model.WorkingHours{
+		{Weekday: time.Tuesday, Start: "14:00", End: "15:30"},
+	}))
+	_, err := svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-08 14:30")
+	require.NoError(t, err)
+
+	from := time.Date(2030, 1, 7, 0, 0, 0, 0, time.UTC)
+	slots, err := svc.DoctorAvailability(ctx, doctor.ID, from, from.AddDate(0, 0, 7))
+	require.NoError(t, err)
+
+	var starts []string
+	for _, s := range slots {
+		starts = append(starts, s.Start.Format("2006-01-02 15:04"))
+	}
+	assert.Equal(t, []string{"2030-01-08 14:00", "2030-01-08 15:00"}, starts)
+
+	_, err = svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-07 10:00")
+	assert.ErrorIs(t, err, ErrSlotUnavailable, "Monday is no longer a working day")
+
+	err = svc.SetWorkingHours(ctx, doctor.ID, []model.WorkingHours{{Weekday: time.Monday, Start: "18:00", End: "09:00"}})
+	assert.ErrorIs(t, err, ErrInvalidHours)
+
+	_, err = svc.DoctorAvailability(ctx, doctor.ID, from, from.AddDate(0, 2, 0))
+	assert.ErrorIs(t, err, ErrRangeTooLong)
+}
+
+func TestClinicService_ConcurrentBookingSameSlot(t *testing.T) {
+	svc, repos, _, doctor := newTestClinic(t)
+	ctx := context.Background()
+
+	const workers = 30
+	var patients []int
+	for i := 0; i < workers; i++ {
+		u, err := repos.User.Create(ctx, fmt.Sprintf("p%d@example.com", i), "hash", model.RolePatient)
+		require.NoError(t, err)
+		patients = append(patients, u.ID)
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan error, workers)
+	for _, pid := range patients {
+		wg.Add(1)
+		go func(pid int) {
+			defer wg.Done()
+			_, err := svc.BookAppointment(ctx, pid, doctor.ID, "2030-01-07 11:00")
+			results <- err
+		}(pid)
+	}
+	wg.Wait()
+	close(results)
+
+	won := 0
+	for err := range results {
+		if err == nil {
+			won++
+			continue
+		}
+		assert.ErrorIs(t, err, ErrSlotTaken)
+	}
+	assert.Equal(t, 1, won)
+}
+
+func TestClinicService_DoctorAgenda(t *testing.T) {
+	svc, _, patient, doctor := newTestClinic(t)
+	ctx := context.Background()
+
+	for _, ts := range []string{"2030-01-07 09:00", "2030-01-09 10:00", "2030-01-09 09:00", "2030-01-14 09:00"} {
+		_, err := svc.BookAppointment(ctx, patient.ID, doctor.ID, ts)
+		require.NoError(t, err)
+	}
+	cancelled, err := svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-08 09:00")
+	require.NoError(t, err)
+	require.NoError(t, svc.CancelAppointment(ctx, Actor{UserID: patient.ID, Role: model.RolePatient}, cancelled.ID))
+
+	// 2030-01-10 is a Thursday; the week view starts on the Monday before.
+	thursday := time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC)
+	week, err := svc.DoctorAgenda(ctx, doctor.ID, AgendaViewWeek, thursday)
+	require.NoError(t, err)
+	require.Len(t, week.Days, 7)
+	assert.Equal(t, "2030-01-07", week.Days[0].Date)
+	assert.Len(t, week.Days[0].Appointments, 1)
+	assert.Empty(t, week.Days[1].Appointments, "cancelled appointments are hidden")
+	require.Len(t, week.Days[2].Appointments, 2)
+	assert.Equal(t, 9, week.Days[2].Appointments[0].Time.Hour())
+	assert.Equal(t, "pat@example.com", week.Days[2].Appointments[0].PatientEmail)
+
+	day, err := svc.DoctorAgenda(ctx, doctor.ID, AgendaViewDay, thursday.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	require.Len(t, day.Days, 1)
+	assert.Len(t, day.Days[0].Appointments, 2)
+
+	_, err = svc.DoctorAgenda(ctx, doctor.ID, "month", thursday)
+	assert.ErrorIs(t, err, ErrInvalidView)
+}
+
+func TestClinicService_RescheduleAppointment(t *testing.T) {
+	svc, repos, patient, doctor := newTestClinic(t)
+	ctx := context.Background()
+
+	app, err := svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-07 09:00")
+	require.NoError(t, err)
+
+	// Moving into the adjacent slot must not be blocked by the appointment itself.
+	moved, err := svc.RescheduleAppointment(ctx, patient.ID, app.ID, 0, "2030-01-07 09:30")
+	require.NoError(t, err)
+	assert.Equal(t, app.ID, moved.ID)
+	require.NotNil(t, moved.PreviousTime)
+	assert.True(t, moved.PreviousTime.Equal(app.Time))
+	events, err := repos.Outbox.List(ctx, model.OutboxPending, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, model.EventAppointmentRescheduled, events[0].Kind, "the move is queued for notification")
+
+	other, err := repos.User.Create(ctx, "other@example.com", "hash", model.RolePatient)
+	require.NoError(t, err)
+	_, err = svc.BookAppointment(ctx, other.ID, doctor.ID, "2030-01-07 11:00")
+	require.NoError(t, err)
+
+	_, err = svc.RescheduleAppointment(ctx, patient.ID, app.ID, 0, "2030-01-07 11:00")
+	assert.ErrorIs(t, err, ErrSlotTaken)
+	_, err = svc.RescheduleAppointment(ctx, patient.ID, app.ID, 0, "2030-01-07 09:30")
+	assert.ErrorIs(t, err, ErrSameSlot, "the slot is the appointment's own")
+	_, err = svc.RescheduleAppointment(ctx, patient.ID, app.ID, 0, "2030-01-07 07:00")
+	assert.ErrorIs(t, err, ErrSlotUnavailable)
+	_, err = svc.RescheduleAppointment(ctx, other.ID, app.ID, 0, "2030-01-07 12:00")
+	assert.ErrorIs(t, err, ErrAppointmentNotFound, "patients cannot move someone else's appointment")
+
+	require.NoError(t, svc.CancelAppointment(ctx, Actor{UserID: patient.ID, Role: model.RolePatient}, app.ID))
+	_, err = svc.RescheduleAppointment(ctx, patient.ID, app.ID, 0, "2030-01-07 12:00")
+	assert.ErrorIs(t, err, ErrNotScheduled)
+}
+
+func TestClinicService_StatusLifecycle(t *testing.T) {
+	svc, _, patient, doctor := newTestClinic(t)
+	ctx := context.Background()
+
+	staff := Actor{UserID: 99, Role: model.RoleDoctor, DoctorID: doctor.ID}
+	admin := Actor{UserID: 1, Role: model.RoleAdmin}
+	owner := Actor{UserID: patient.ID, Role: model.RolePatient}
+
+	app, err := svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-07 09:00")
+	require.NoError(t, err)
+
+	_, err = svc.UpdateAppointmentStatus(ctx, staff, app.ID, model.StatusCompleted)
+	assert.ErrorIs(t, err, ErrInvalidTransition, "a visit must be checked in before it completes")
+	_, err = svc.UpdateAppointmentStatus(ctx, Actor{Role: model.RoleDoctor, DoctorID: doctor.ID + 1}, app.ID, model.StatusCheckedIn)
+	assert.ErrorIs(t, err, ErrAppointmentNotFound, "doctors only manage their own appointments")
+	_, err = svc.UpdateAppointmentStatus(ctx, admin, app.ID, "lost")
+	assert.ErrorIs(t, err, ErrInvalidStatus)
+
+	checkedIn, err := svc.UpdateAppointmentStatus(ctx, staff, app.ID, model.StatusCheckedIn)
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusCheckedIn, checkedIn.Status)
+	assert.NotNil(t, checkedIn.CheckedInAt)
+
+	assert.ErrorIs(t, svc.CancelAppointment(ctx, owner, app.ID), ErrInvalidTransition)
+
+	completed, err := svc.UpdateAppointmentStatus(ctx, admin, app.ID, model.StatusCompleted)
+	require.NoError(t, err)
+	assert.NotNil(t, completed.CompletedAt)
+	assert.ErrorIs(t, svc.CancelAppointment(ctx, owner, app.ID), ErrInvalidTransition, "completed visits cannot be cancelled")
+
+	noShow, err := svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-07 10:00")
+	require.NoError(t, err)
+	_, err = svc.UpdateAppointmentStatus(ctx, staff, noShow.ID, model.StatusNoShow)
+	require.NoError(t, err)
+	_, err = svc.UpdateAppointmentStatus(ctx, staff, noShow.ID, model.StatusCheckedIn)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+}
+
+func TestClinicService_CancelChecksOwnership(t *testing.T) {
+	svc, repos, patient, doctor := newTestClinic(t)
+	ctx := context.Background()
+
+	other, err := repos.User.Create(ctx, "other@example.com", "hash", model.RolePatient)
+	require.NoError(t, err)
+	app, err := svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-07 09:00")
+	require.NoError(t, err)
+
+	err = svc.CancelAppointment(ctx, Actor{UserID: other.ID, Role: model.RolePatient}, app.ID)
+	assert.ErrorIs(t, err, ErrAppointmentNotFound, "foreign appointments look missing")
+	err = svc.CancelAppointment(ctx, Actor{UserID: 1, Role: model.RoleDoctor, DoctorID: doctor.ID + 1}, app.ID)
+	assert.ErrorIs(t, err, ErrAppointmentNotFound, "only the assigned doctor may cancel")
+	err = svc.CancelAppointment(ctx, Actor{UserID: patient.ID, Role: model.RolePatient}, 4242)
+	assert.ErrorIs(t, err, ErrAppointmentNotFound)
+
+	require.NoError(t, svc.CancelAppointment(ctx, Actor{UserID: 1, Role: model.RoleDoctor, DoctorID: doctor.ID}, app.ID))
+
+	second, err := svc.BookAppointment(ctx, patient.ID, doctor.ID, "2030-01-07 10:00")
+	require.NoError(t, err)
+	require.NoError(t, svc.CancelAppointment(ctx, Actor{UserID: other.ID, Role: model.RoleAdmin}, second.ID))
+}
+
+func TestClinicService_ImportDoctors(t *testing.T) {
+	svc, repos, _, _ := newTestClinic(t)
+	ctx := context.Background()
+
+	bad := "external_id,name,specialization\ng-1,Dr. Grey,Surgery\nh-1,,Diagnostics\n"
+	report, err := svc.ImportDoctors(ctx, strings.NewReader(bad), importer.CSV)
+	require.ErrorIs(t, err, ErrImportRows)
+	require.Len(t, report.Errors, 1)
+	assert.Equal(t, 3, report.Errors[0].Line)
+	_, total, err := repos.Doctor.Search(ctx, model.DoctorQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total, "a bad row blocks the whole import")
+
+	good := `[{"external_id": "g-1", "name": "Dr. Grey", "specialization": "Surgery"}]`
+	report, err = svc.ImportDoctors(ctx, strings.NewReader(good), importer.JSON)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Created)
+	report, err = svc.ImportDoctors(ctx, strings.NewReader(good), importer.JSON)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Updated)
+
+	_, err = svc.ImportDoctors(ctx, strings.NewReader("not json"), importer.JSON)
+	assert.ErrorIs(t, err, ErrInvalidImport)
+}
+
+func TestClinicService_ListDoctors(t *testing.T) {
+	svc, _, _, _ := newTestClinic(t)
+	ctx := context.Background()
+	for _, name := range []string{"Dr. Adams", "Dr. Baker", "Dr. Clark", "Dr. Davis", "Dr. Evans"} {
+		_, err := svc.CreateDoctor(ctx, name, "General")
+		require.NoError(t, err)
+	}
+
+	var names []string
+	search := DoctorSearch{Query: "dr.", Limit: 2}
+	for {
+		page, err := svc.ListDoctors(ctx, search)
+		require.NoError(t, err)
+		assert.Equal(t, 6, page.Total)
+		for _, d := range page.Doctors {
+			names = append(names, d.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		search.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"Dr. Adams", "Dr. Baker", "Dr. Clark", "Dr. Davis", "Dr. Evans", "Dr. Grey"}, names)
+
+	_, err := svc.ListDoctors(ctx, DoctorSearch{Sort: "rating"})
+	assert.ErrorIs(t, err, ErrInvalidSort)
+	_, err = svc.ListDoctors(ctx, DoctorSearch{Limit: 500})
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+	_, err = svc.ListDoctors(ctx, DoctorSearch{Cursor: "not-a-cursor"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	first, err := svc.ListDoctors(ctx, DoctorSearch{Limit: 1})
+	require.NoError(t, err)
+	_, err = svc.ListDoctors(ctx, DoctorSearch{Sort: "-name", Cursor: first.NextCursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor, "a cursor is bound to its sort")
+}
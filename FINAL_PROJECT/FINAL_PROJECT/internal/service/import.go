@@ -0,0 +1,40 @@
+package service
+
+import (
+	"clinic-cli/internal/apperr"
+	"clinic-cli/internal/importer"
+	"clinic-cli/internal/validation"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrInvalidImport = errors.New("invalid import document")
+	ErrImportRows    = apperr.New(apperr.ErrValidation, "import has invalid rows, nothing was imported")
+)
+
+// ImportDoctors creates or updates doctors by external ID. If any row is
+// invalid nothing is written and the report lists every bad row together
+// with ErrImportRows.
+func (s *ClinicService) ImportDoctors(ctx context.Context, r io.Reader, format importer.Format) (*importer.Report, error) {
+	rows, rowErrs, err := importer.Parse(r, format)
+	if err != nil {
+		return nil, validation.Body("", fmt.Errorf("%w: %w", ErrInvalidImport, err))
+	}
+
+	report := &importer.Report{Rows: []importer.Result{}, Errors: []importer.RowError{}}
+	if len(rowErrs) > 0 {
+		report.Errors = rowErrs
+		return report, ErrImportRows
+	}
+	results, err := s.doctorRepo.Import(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range results {
+		report.Add(res)
+	}
+	return report, nil
+}
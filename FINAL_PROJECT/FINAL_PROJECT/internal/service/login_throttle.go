@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+)
+
+// ThrottlePolicy decides how long a key must wait after failed logins. The
+// first FreeAttempts failures cost nothing; after that the wait starts at
+// BaseDelay and doubles with every failure until LockoutAfter failures lock
+// the key for Lockout. Failures older than Lockout are forgotten.
+type ThrottlePolicy struct {
+	FreeAttempts int
+	LockoutAfter int
+	BaseDelay    time.Duration
+	Lockout      time.Duration
+}
+
+var (
+	DefaultAccountThrottle = ThrottlePolicy{FreeAttempts: 3, LockoutAfter: 10, BaseDelay: time.Second, Lockout: 15 * time.Minute}
+	// Many users can share an address, so clients get more room than
+	// accounts before they are slowed down.
+	DefaultIPThrottle = ThrottlePolicy{FreeAttempts: 20, LockoutAfter: 100, BaseDelay: time.Second, Lockout: 15 * time.Minute}
+)
+
+// ThrottledError is returned by Login while an account or client address is
+// backing off or locked out.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// wait returns how long after its last failure the throttle blocks logins.
+func (p ThrottlePolicy) wait(failures int) time.Duration {
+	if failures >= p.LockoutAfter {
+		return p.Lockout
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.Lockout; i++ {
+		delay *= 2
+	}
+	return min(delay, p.Lockout)
+}
+
+// stale reports whether the failures are old enough to be forgotten.
+func (p ThrottlePolicy) stale(t *model.LoginThrottle, now time.Time) bool {
+	return t == nil || now.Sub(t.LastFailureAt) >= p.Lockout
+}
+
+// ForgetBefore is the cut-off for RecordFailure: failures last recorded
+// before it are forgotten.
+func (p ThrottlePolicy) ForgetBefore(now time.Time) time.Time {
+	return now.Add(-p.Lockout)
+}
+
+// Counted returns how many of the failures in t still count at now.
+func (p ThrottlePolicy) Counted(t *model.LoginThrottle, now time.Time) int {
+	if p.stale(t, now) {
+		return 0
+	}
+	return t.Failures
+}
+
+// RetryAfter returns how long the throttle t blocks logins from now on.
+func (p ThrottlePolicy) RetryAfter(t *model.LoginThrottle, now time.Time) time.Duration {
+	if p.stale(t, now) {
+		return 0
+	}
+	return max(t.LastFailureAt.Add(p.wait(t.Failures)).Sub(now), 0)
+}
+
+// Admit decides whether an attempt that passed the check with seen failures
+// counted may go ahead, given the throttle RecordFailure returned when the
+// attempt itself was counted. Failures counted in between come from
+// concurrent attempts and happened just now, so the attempt has to wait
+// out their backoff; it returns that wait, or zero to admit it.
+func (p ThrottlePolicy) Admit(seen int, t *model.LoginThrottle) time.Duration {
+	if t.Failures-1 <= seen {
+		return 0
+	}
+	return p.wait(t.Failures - 1)
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// throttleKeys pairs each key a login attempt is tracked under with its
+// policy. Attempts without a known client address are tracked per account
+// only.
+func (s *AuthService) throttleKeys(email, ip string) map[string]ThrottlePolicy {
+	keys := map[string]ThrottlePolicy{accountKey(email): s.accountThrottle}
+	if ip != "" {
+		keys[ipKey(ip)] = s.ipThrottle
+	}
+	return keys
+}
+
+// checkThrottle returns a ThrottledError if any of the keys is still
+// blocked, and otherwise how many failures the account key has counted.
+func (s *AuthService) checkThrottle(ctx context.Context, keys map[string]ThrottlePolicy, account string, now time.Time) (int, error) {
+	var wait time.Duration
+	var seen int
+	for key, policy := range keys {
+		t, err := s.throttles.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, policy.RetryAfter(t, now))
+		if key == account {
+			seen = policy.Counted(t, now)
+		}
+	}
+	if wait > 0 {
+		return 0, &ThrottledError{RetryAfter: wait}
+	}
+	return seen, nil
+}
+
+// countAttempt counts a login attempt as a failure of the account before
+// its password is checked, and decides from the count RecordFailure returns
+// whether it may go ahead. Concurrent guesses that all passed checkThrottle
+// are thus still held to the backoff; a successful login resets the count.
+func (s *AuthService) countAttempt(ctx context.Context, account string, seen int, now time.Time) error {
+	policy := s.accountThrottle
+	t, err := s.throttles.RecordFailure(ctx, account, now, policy.ForgetBefore(now))
+	if err != nil {
+		return err
+	}
+	if wait := policy.Admit(seen, t); wait > 0 {
+		return &ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordFailure counts a failed login against the keys other than the
+// account, which countAttempt has already charged. Client addresses are
+// only charged for actual failures, so that many users logging in from one
+// address do not add up.
+func (s *AuthService) recordFailure(ctx context.Context, keys map[string]ThrottlePolicy, account string, now time.Time) error {
+	for key, policy := range keys {
+		if key == account {
+			continue
+		}
+		if _, err := s.throttles.RecordFailure(ctx, key, now, policy.ForgetBefore(now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unlock clears the failed logins of a user's account so they can log in
+// again straight away. Failures tracked per client address are kept.
+func (s *AuthService) Unlock(ctx context.Context, userID int) error {
+	user, err := s.repo.GetByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.throttles.Reset(ctx, accountKey(user.Email))
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"clinic-cli/internal/apperr"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/validation"
+)
+
+var (
+	ErrEventNotFound     = apperr.New(apperr.ErrNotFound, "outbox event not found")
+	ErrEventNotDead      = apperr.New(apperr.ErrConflict, "only dead outbox events can be replayed")
+	ErrInvalidEventState = errors.New("status must be pending, sent or dead")
+)
+
+const maxOutboxList = 100
+
+// OutboxEvents lists the newest notification events, optionally only those
+// in one status, for admins looking into failed deliveries.
+func (s *ClinicService) OutboxEvents(ctx context.Context, status model.OutboxStatus, limit int) ([]model.OutboxEvent, error) {
+	switch status {
+	case "", model.OutboxPending, model.OutboxSent, model.OutboxDead:
+	default:
+		return nil, validation.Query("status", ErrInvalidEventState)
+	}
+	if limit <= 0 || limit > maxOutboxList {
+		limit = maxOutboxList
+	}
+	return s.outboxRepo.List(ctx, status, limit)
+}
+
+func (s *ClinicService) OutboxEvent(ctx context.Context, id int) (*model.OutboxEvent, error) {
+	e, err := s.outboxRepo.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ReplayOutboxEvent queues a dead event for immediate delivery with a fresh
+// set of attempts.
+func (s *ClinicService) ReplayOutboxEvent(ctx context.Context, id int) (*model.OutboxEvent, error) {
+	replayed, err := s.outboxRepo.Replay(ctx, id, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if !replayed {
+		if _, err := s.OutboxEvent(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrEventNotDead
+	}
+	return s.OutboxEvent(ctx, id)
+}
@@ -1,108 +1,561 @@
-package service
-
-import (
-	"clinic-cli/internal/model"
-	"clinic-cli/internal/repository"
-	"context"
-	"errors"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
-)
-
-type AuthService struct {
-	repo      repository.UserRepository
-	jwtSecret string
-}
-
-func NewAuthService(repo repository.UserRepository, secret string) *AuthService {
-	return &AuthService{repo: repo, jwtSecret: secret}
-}
-
-func (s *AuthService) Register(ctx context.Context, email, password string, role model.Role) (*model.User, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, err
-	}
-
-	if role == "" {
-		role = model.RolePatient
-	}
-
-	return s.repo.Create(ctx, email, string(hashedBytes), role)
-}
-
-func (s *AuthService) Login(ctx context.Context, email, password string) (string, error) {
-	user, err := s.repo.GetByEmail(ctx, email)
-	if err != nil {
-		return "", err
-	}
-	if user == nil {
-		return "", errors.New("invalid credentials")
-	}
-
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
-	if err != nil {
-		return "", errors.New("invalid credentials")
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":   user.ID,
-		"email": user.Email,
-		"role":  user.Role,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(s.jwtSecret))
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
-}
-
-type ClinicService struct {
-	doctorRepo      repository.DoctorRepository
-	appointmentRepo repository.AppointmentRepository
-	notifyChan      chan<- model.Appointment
-}
-
-func NewClinicService(dr repository.DoctorRepository, ar repository.AppointmentRepository, notifyChan chan<- model.Appointment) *ClinicService {
-	return &ClinicService{
-		doctorRepo:      dr,
-		appointmentRepo: ar,
-		notifyChan:      notifyChan,
-	}
-}
-
-func (s *ClinicService) ListDoctors(ctx context.Context) ([]model.Doctor, error) {
-	return s.doctorRepo.GetAll(ctx)
-}
-
-func (s *ClinicService) CreateDoctor(ctx context.Context, name, spec string) (*model.Doctor, error) {
-	return s.doctorRepo.Create(ctx, name, spec)
-}
-
-func (s *ClinicService) BookAppointment(ctx context.Context, patientID, doctorID int, timeStr string) (*model.Appointment, error) {
-	app, err := s.appointmentRepo.Create(ctx, patientID, doctorID, timeStr)
-	if err != nil {
-		return nil, err
-	}
-
-	select {
-	case s.notifyChan <- *app:
-	default:
-
-	}
-
-	return app, nil
-}
-
-func (s *ClinicService) MyAppointments(ctx context.Context, patientID int) ([]model.Appointment, error) {
-	return s.appointmentRepo.GetByPatientID(ctx, patientID)
-}
-
-func (s *ClinicService) CancelAppointment(ctx context.Context, appID int) error {
-	return s.appointmentRepo.Cancel(ctx, appID)
-}
+package service
+
+import (
+	"clinic-cli/internal/apperr"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+	"clinic-cli/internal/schedule"
+	"clinic-cli/internal/validation"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDoctorNotFound      = apperr.New(apperr.ErrNotFound, "doctor not found")
+	ErrInvalidTime         = errors.New("invalid time, expected YYYY-MM-DD HH:MM")
+	ErrTimeInPast          = errors.New("time must be in the future")
+	ErrSameSlot            = errors.New("appointment is already at this time")
+	ErrDoctorRequired      = errors.New("doctor_id is required")
+	ErrSlotUnavailable     = apperr.New(apperr.ErrValidation, "requested time is outside the doctor's working hours")
+	ErrSlotTaken           = repository.ErrSlotTaken
+	ErrNotScheduled        = repository.ErrNotScheduled
+	ErrAppointmentNotFound = apperr.New(apperr.ErrNotFound, "appointment not found")
+	ErrInvalidTransition   = apperr.New(apperr.ErrConflict, "illegal status transition")
+	ErrInvalidStatus       = errors.New("unknown appointment status")
+	ErrRangeTooLong        = errors.New("availability range must not exceed 31 days")
+	ErrInvalidHours        = errors.New("invalid working hours")
+	ErrNameRequired        = errors.New("must not be empty")
+	ErrInvalidView         = errors.New("view must be day or week")
+	ErrInvalidSort         = errors.New("sort must be name, specialization or created, optionally prefixed with -")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrInvalidLimit        = errors.New("limit must be between 1 and 100")
+)
+
+const (
+	AgendaViewDay  = "day"
+	AgendaViewWeek = "week"
+)
+
+// AppointmentTimeLayout is the wall-clock format accepted for bookings; it is
+// interpreted in the clinic's time zone.
+const AppointmentTimeLayout = "2006-01-02 15:04"
+
+const maxAvailabilityRange = 31 * 24 * time.Hour
+
+const (
+	DefaultDoctorPageSize = 20
+	MaxDoctorPageSize     = 100
+)
+
+type ClinicConfig struct {
+	SlotLength time.Duration
+	Location   *time.Location
+}
+
+type ClinicService struct {
+	userRepo        repository.UserRepository
+	doctorRepo      repository.DoctorRepository
+	appointmentRepo repository.AppointmentRepository
+	outboxRepo      repository.OutboxRepository
+	reminderRepo    repository.ReminderRepository
+	slotLength      time.Duration
+	loc             *time.Location
+}
+
+// NewClinicService wires the service to its repositories. It needs no
+// notification channel: the repositories record outbox events with every
+// booking, reschedule and reminder.
+func NewClinicService(repos *repository.Registry, cfg ClinicConfig) *ClinicService {
+	if cfg.SlotLength <= 0 {
+		cfg.SlotLength = schedule.DefaultSlotLength
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	return &ClinicService{
+		userRepo:        repos.User,
+		doctorRepo:      repos.Doctor,
+		appointmentRepo: repos.Appointment,
+		outboxRepo:      repos.Outbox,
+		reminderRepo:    repos.Reminder,
+		slotLength:      cfg.SlotLength,
+		loc:             cfg.Location,
+	}
+}
+
+func (s *ClinicService) SlotLength() time.Duration {
+	return s.slotLength
+}
+
+func (s *ClinicService) Location() *time.Location {
+	return s.loc
+}
+
+// ParseTime accepts either the booking layout in clinic time or RFC 3339.
+func (s *ClinicService) ParseTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(AppointmentTimeLayout, value, s.loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, ErrInvalidTime
+}
+
+// parseFutureTime is ParseTime for new appointment times, which must not be
+// in the past.
+func (s *ClinicService) parseFutureTime(value string) (time.Time, error) {
+	t, err := s.ParseTime(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !t.After(time.Now()) {
+		return time.Time{}, ErrTimeInPast
+	}
+	return t, nil
+}
+
+// DoctorSearch is a catalogue query as the API receives it.
+type DoctorSearch struct {
+	Specialization string
+	Query          string
+	Sort           string
+	Limit          int
+	Cursor         string
+}
+
+// ListDoctors returns one page of the doctor catalogue. The cursor is opaque
+// to clients and only valid with the sort it was issued for.
+func (s *ClinicService) ListDoctors(ctx context.Context, in DoctorSearch) (*model.DoctorPage, error) {
+	q := model.DoctorQuery{
+		Specialization: strings.TrimSpace(in.Specialization),
+		Search:         strings.TrimSpace(in.Query),
+		Sort:           model.DoctorSort(in.Sort),
+		Limit:          in.Limit,
+	}
+	switch q.Sort {
+	case "":
+		q.Sort = model.SortName
+	case model.SortName, model.SortNameDesc, model.SortSpecialization, model.SortSpecializationDesc, model.SortCreated, model.SortCreatedDesc:
+	default:
+		return nil, validation.Query("sort", ErrInvalidSort)
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultDoctorPageSize
+	}
+	if q.Limit < 1 || q.Limit > MaxDoctorPageSize {
+		return nil, validation.Query("limit", ErrInvalidLimit)
+	}
+	if in.Cursor != "" {
+		after, err := decodeDoctorCursor(in.Cursor, q.Sort)
+		if err != nil {
+			return nil, validation.Query("cursor", err)
+		}
+		q.After = after
+	}
+
+	// One extra row tells whether another page follows.
+	limit := q.Limit
+	q.Limit++
+	doctors, total, err := s.doctorRepo.Search(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	page := &model.DoctorPage{Doctors: doctors, Total: total}
+	if len(doctors) > limit {
+		page.Doctors = doctors[:limit]
+		last := page.Doctors[limit-1]
+		page.NextCursor = encodeDoctorCursor(doctorCursor{
+			Sort:         q.Sort,
+			DoctorCursor: model.DoctorCursor{Key: repository.DoctorSortKey(last, q.Sort), ID: last.ID},
+		})
+	}
+	if page.Doctors == nil {
+		page.Doctors = []model.Doctor{}
+	}
+	return page, nil
+}
+
+type doctorCursor struct {
+	Sort model.DoctorSort `json:"s"`
+	model.DoctorCursor
+}
+
+func encodeDoctorCursor(c doctorCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeDoctorCursor(value string, sort model.DoctorSort) (*model.DoctorCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c doctorCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Sort != sort || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c.DoctorCursor, nil
+}
+
+func (s *ClinicService) CreateDoctor(ctx context.Context, name, spec string) (*model.Doctor, error) {
+	name, spec = strings.TrimSpace(name), strings.TrimSpace(spec)
+	v := &validation.Error{}
+	if name == "" {
+		v.Add(validation.InBody, "name", ErrNameRequired)
+	}
+	if spec == "" {
+		v.Add(validation.InBody, "specialization", ErrNameRequired)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return s.doctorRepo.Create(ctx, name, spec)
+}
+
+func (s *ClinicService) GetDoctor(ctx context.Context, doctorID int) (*model.Doctor, error) {
+	return s.getDoctor(ctx, doctorID)
+}
+
+func (s *ClinicService) GetWorkingHours(ctx context.Context, doctorID int) ([]model.WorkingHours, error) {
+	if _, err := s.getDoctor(ctx, doctorID); err != nil {
+		return nil, err
+	}
+	return s.workingHours(ctx, doctorID)
+}
+
+func (s *ClinicService) SetWorkingHours(ctx context.Context, doctorID int, hours []model.WorkingHours) error {
+	if _, err := s.getDoctor(ctx, doctorID); err != nil {
+		return err
+	}
+	if err := schedule.Validate(hours); err != nil {
+		return validation.Body("", fmt.Errorf("%w: %v", ErrInvalidHours, err))
+	}
+	return s.doctorRepo.SetWorkingHours(ctx, doctorID, hours)
+}
+
+// DoctorAvailability returns the free slots starting within [from, to).
+func (s *ClinicService) DoctorAvailability(ctx context.Context, doctorID int, from, to time.Time) ([]model.Slot, error) {
+	if !from.Before(to) {
+		return nil, validation.Query("to", schedule.ErrInvalidRange)
+	}
+	if to.Sub(from) > maxAvailabilityRange {
+		return nil, validation.Query("to", ErrRangeTooLong)
+	}
+	if _, err := s.getDoctor(ctx, doctorID); err != nil {
+		return nil, err
+	}
+	hours, err := s.workingHours(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	booked, err := s.bookedTimes(ctx, doctorID, from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+	return schedule.FreeSlots(hours, booked, from, to, s.slotLength, s.loc)
+}
+
+// DoctorAgenda lays out the doctor's live appointments by clinic day. The day
+// view covers date only; the week view covers the Monday-to-Sunday week that
+// contains date. Days without appointments are included so the agenda reads
+// as a calendar.
+func (s *ClinicService) DoctorAgenda(ctx context.Context, doctorID int, view string, date time.Time) (*model.Agenda, error) {
+	if _, err := s.getDoctor(ctx, doctorID); err != nil {
+		return nil, err
+	}
+
+	date = date.In(s.loc)
+	from := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, s.loc)
+	days := 1
+	switch view {
+	case AgendaViewDay:
+	case AgendaViewWeek:
+		offset := (int(from.Weekday()) + 6) % 7
+		from = from.AddDate(0, 0, -offset)
+		days = 7
+	default:
+		return nil, validation.Query("view", ErrInvalidView)
+	}
+	to := from.AddDate(0, 0, days)
+
+	apps, err := s.appointmentRepo.GetByDoctorID(ctx, doctorID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	agenda := &model.Agenda{DoctorID: doctorID, View: view, From: from, To: to}
+	index := make(map[string]int, days)
+	for i := 0; i < days; i++ {
+		key := from.AddDate(0, 0, i).Format("2006-01-02")
+		index[key] = i
+		agenda.Days = append(agenda.Days, model.AgendaDay{Date: key, Appointments: []model.Appointment{}})
+	}
+	for _, a := range apps {
+		if a.Status == model.StatusCancelled {
+			continue
+		}
+		if i, ok := index[a.Time.In(s.loc).Format("2006-01-02")]; ok {
+			agenda.Days[i].Appointments = append(agenda.Days[i].Appointments, a)
+		}
+	}
+	return agenda, nil
+}
+
+func (s *ClinicService) BookAppointment(ctx context.Context, patientID, doctorID int, timeStr string) (*model.Appointment, error) {
+	v := &validation.Error{}
+	if doctorID <= 0 {
+		v.Add(validation.InBody, "doctor_id", ErrDoctorRequired)
+	}
+	at, err := s.parseFutureTime(timeStr)
+	v.Add(validation.InBody, "time", err)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.checkSlot(ctx, doctorID, at, 0); err != nil {
+		return nil, err
+	}
+
+	// The repository enforces uniqueness atomically, so a concurrent booking
+	// that slipped past the check above still fails with ErrSlotTaken.
+	created, err := s.appointmentRepo.Create(ctx, patientID, doctorID, at)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "appointment booked", "appointment_id", created.ID, "patient_id", patientID, "doctor_id", doctorID, "time", at)
+	// Reload to pick up the doctor and patient details.
+	return s.appointmentRepo.GetByID(ctx, created.ID)
+}
+
+// RescheduleAppointment moves one of the patient's scheduled appointments to
+// a free slot, keeping its ID. A doctorID of 0 keeps the current doctor. The
+// move is a single repository update, so the original slot is never released
+// unless the new one has been taken.
+func (s *ClinicService) RescheduleAppointment(ctx context.Context, patientID, appID, doctorID int, timeStr string) (*model.Appointment, error) {
+	app, err := s.appointmentRepo.GetByID(ctx, appID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrAppointmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if app.PatientID != patientID {
+		return nil, ErrAppointmentNotFound
+	}
+	if app.Status != model.StatusScheduled {
+		return nil, ErrNotScheduled
+	}
+	if doctorID == 0 {
+		doctorID = app.DoctorID
+	}
+
+	at, err := s.parseFutureTime(timeStr)
+	if err != nil {
+		return nil, validation.Body("time", err)
+	}
+	if doctorID == app.DoctorID && at.Equal(app.Time) {
+		return nil, validation.Body("time", ErrSameSlot)
+	}
+	if err := s.checkSlot(ctx, doctorID, at, app.ID); err != nil {
+		return nil, err
+	}
+
+	moved, err := s.appointmentRepo.Reschedule(ctx, app.ID, doctorID, at)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "appointment rescheduled", "appointment_id", app.ID, "doctor_id", doctorID, "from", app.Time, "to", at)
+	return moved, nil
+}
+
+func (s *ClinicService) MyAppointments(ctx context.Context, patientID int) ([]model.Appointment, error) {
+	return s.appointmentRepo.GetByPatientID(ctx, patientID)
+}
+
+// Actor is the authenticated user a request is made on behalf of.
+type Actor struct {
+	UserID   int
+	Role     model.Role
+	DoctorID int // set for doctor accounts
+}
+
+// canAccess reports whether the actor may act on the appointment: admins on
+// any, doctors on those assigned to them, patients on their own.
+func (a Actor) canAccess(app *model.Appointment) bool {
+	switch a.Role {
+	case model.RoleAdmin:
+		return true
+	case model.RoleDoctor:
+		return a.DoctorID != 0 && app.DoctorID == a.DoctorID
+	default:
+		return app.PatientID == a.UserID
+	}
+}
+
+// CancelAppointment cancels a scheduled appointment the actor has access to.
+// Appointments of other patients are reported as not found so their IDs do
+// not leak.
+func (s *ClinicService) CancelAppointment(ctx context.Context, actor Actor, appID int) error {
+	app, err := s.accessibleAppointment(ctx, actor, appID)
+	if err != nil {
+		return err
+	}
+	if !CanTransition(app.Status, model.StatusCancelled) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, app.Status, model.StatusCancelled)
+	}
+
+	cancelled, err := s.appointmentRepo.Cancel(ctx, appID)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return fmt.Errorf("%w: %s changed concurrently", ErrInvalidTransition, app.Status)
+	}
+	slog.InfoContext(ctx, "appointment cancelled", "appointment_id", appID, "by_user_id", actor.UserID)
+	return nil
+}
+
+// statusTransitions is the appointment lifecycle. Cancelled, completed and
+// no-show appointments are final.
+var statusTransitions = map[model.AppointmentStatus][]model.AppointmentStatus{
+	model.StatusScheduled: {model.StatusCheckedIn, model.StatusCancelled, model.StatusNoShow},
+	model.StatusCheckedIn: {model.StatusCompleted},
+}
+
+func CanTransition(from, to model.AppointmentStatus) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateAppointmentStatus moves an appointment along its lifecycle on behalf
+// of clinic staff: admins, or the doctor the appointment is assigned to.
+func (s *ClinicService) UpdateAppointmentStatus(ctx context.Context, actor Actor, appID int, to model.AppointmentStatus) (*model.Appointment, error) {
+	switch to {
+	case model.StatusScheduled, model.StatusCheckedIn, model.StatusCompleted, model.StatusCancelled, model.StatusNoShow:
+	default:
+		return nil, validation.Body("status", ErrInvalidStatus)
+	}
+	if actor.Role != model.RoleAdmin && actor.Role != model.RoleDoctor {
+		return nil, ErrAppointmentNotFound
+	}
+
+	app, err := s.accessibleAppointment(ctx, actor, appID)
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransition(app.Status, to) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, app.Status, to)
+	}
+
+	// The repository compares the status again, so a concurrent transition
+	// of the same appointment cannot be silently overwritten.
+	err = s.appointmentRepo.UpdateStatus(ctx, appID, app.Status, to, time.Now().UTC())
+	if errors.Is(err, repository.ErrStatusChanged) {
+		return nil, fmt.Errorf("%w: %s changed concurrently", ErrInvalidTransition, app.Status)
+	}
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "appointment status changed", "appointment_id", appID, "from", app.Status, "to", to, "by_user_id", actor.UserID)
+	return s.appointmentRepo.GetByID(ctx, appID)
+}
+
+// AppointmentReminders lists the reminders queued for an appointment the
+// actor has access to, and whether each has been delivered.
+func (s *ClinicService) AppointmentReminders(ctx context.Context, actor Actor, appID int) ([]model.Reminder, error) {
+	if _, err := s.accessibleAppointment(ctx, actor, appID); err != nil {
+		return nil, err
+	}
+	return s.reminderRepo.ListByAppointment(ctx, appID)
+}
+
+func (s *ClinicService) accessibleAppointment(ctx context.Context, actor Actor, appID int) (*model.Appointment, error) {
+	app, err := s.appointmentRepo.GetByID(ctx, appID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrAppointmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !actor.canAccess(app) {
+		return nil, ErrAppointmentNotFound
+	}
+	return app, nil
+}
+
+// checkSlot verifies that at is a free slot of the doctor, ignoring the
+// appointment exceptID (0 for none) so an appointment can move next to itself.
+func (s *ClinicService) checkSlot(ctx context.Context, doctorID int, at time.Time, exceptID int) error {
+	if _, err := s.getDoctor(ctx, doctorID); err != nil {
+		return err
+	}
+	hours, err := s.workingHours(ctx, doctorID)
+	if err != nil {
+		return err
+	}
+	if ok, err := schedule.IsFree(hours, nil, at, s.slotLength, s.loc); err != nil {
+		return err
+	} else if !ok {
+		return ErrSlotUnavailable
+	}
+	booked, err := s.bookedTimes(ctx, doctorID, at, at.Add(s.slotLength), exceptID)
+	if err != nil {
+		return err
+	}
+	if ok, err := schedule.IsFree(hours, booked, at, s.slotLength, s.loc); err != nil {
+		return err
+	} else if !ok {
+		return ErrSlotTaken
+	}
+	return nil
+}
+
+func (s *ClinicService) getDoctor(ctx context.Context, doctorID int) (*model.Doctor, error) {
+	doc, err := s.doctorRepo.GetByID(ctx, doctorID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrDoctorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// workingHours falls back to the clinic default week when the doctor has no
+// template of their own.
+func (s *ClinicService) workingHours(ctx context.Context, doctorID int) ([]model.WorkingHours, error) {
+	hours, err := s.doctorRepo.GetWorkingHours(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	if len(hours) == 0 {
+		return schedule.DefaultWeek(), nil
+	}
+	return hours, nil
+}
+
+// bookedTimes lists the live appointments, other than exceptID, that could
+// overlap a slot starting within [from, to).
+func (s *ClinicService) bookedTimes(ctx context.Context, doctorID int, from, to time.Time, exceptID int) ([]time.Time, error) {
+	apps, err := s.appointmentRepo.GetByDoctorID(ctx, doctorID, from.Add(-s.slotLength), to.Add(s.slotLength))
+	if err != nil {
+		return nil, err
+	}
+	var booked []time.Time
+	for _, a := range apps {
+		if a.Status != model.StatusCancelled && a.ID != exceptID {
+			booked = append(booked, a.Time)
+		}
+	}
+	return booked, nil
+}
@@ -0,0 +1,116 @@
+// Package validation describes invalid input field by field, so that every
+// endpoint can answer with the same machine-readable list of problems.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// Where a FieldError points.
+const (
+	InPath   = "path"
+	InQuery  = "query"
+	InHeader = "header"
+	InBody   = "body"
+)
+
+// FieldError is one problem with the input. Field names the parameter, or
+// the JSON path inside the body such as "hours[2].start"; it is empty when
+// the problem is with the body as a whole.
+type FieldError struct {
+	In      string `json:"in"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) String() string {
+	if e.Field == "" {
+		return e.In + ": " + e.Message
+	}
+	return e.In + " " + e.Field + ": " + e.Message
+}
+
+// Error collects every problem with one request. It marshals to the body of
+// a 400 response. errors.Is sees the sentinel errors it was built from.
+type Error struct {
+	Message string       `json:"error"`
+	Fields  []FieldError `json:"fields"`
+
+	causes []error
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.String()
+	}
+	return "invalid input: " + strings.Join(msgs, "; ")
+}
+
+func (e *Error) Unwrap() []error {
+	return e.causes
+}
+
+// Addf records a problem described by a message.
+func (e *Error) Addf(in, field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{In: in, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Add records err as the problem with a field. A nil err is ignored, so
+// checks can be chained: v.Add(InBody, "email", Email(email)).
+func (e *Error) Add(in, field string, err error) {
+	if err == nil {
+		return
+	}
+	e.Fields = append(e.Fields, FieldError{In: in, Field: field, Message: err.Error()})
+	e.causes = append(e.causes, err)
+}
+
+// Err returns e if it holds any problem, and nil otherwise.
+func (e *Error) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	if e.Message == "" {
+		e.Message = "Invalid request"
+	}
+	return e
+}
+
+// Field is a single problem with one field.
+func Field(in, field string, err error) error {
+	v := &Error{}
+	v.Add(in, field, err)
+	return v.Err()
+}
+
+// Body is a single problem with one body field.
+func Body(field string, err error) error {
+	return Field(InBody, field, err)
+}
+
+// Query is a single problem with one query parameter.
+func Query(field string, err error) error {
+	return Field(InQuery, field, err)
+}
+
+// As returns the validation problems in err's chain, if any.
+func As(err error) (*Error, bool) {
+	var v *Error
+	ok := errors.As(err, &v)
+	return v, ok
+}
+
+var ErrInvalidEmail = errors.New("must be a valid email address")
+
+// Email accepts a bare address such as ann@example.com.
+func Email(addr string) error {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil || parsed.Address != addr || parsed.Name != "" {
+		return ErrInvalidEmail
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package worker
+
+import (
+	"clinic-cli/internal/logging"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/notify"
+	"clinic-cli/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type DispatcherConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// MaxAttempts failed deliveries move an event to the dead state.
+	MaxAttempts int
+	// The wait before a retry starts at BaseBackoff and doubles with every
+	// failed attempt, up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Lease is how long a claimed event is hidden from other dispatchers.
+	Lease time.Duration
+}
+
+func (c *DispatcherConfig) setDefaults() {
+	if c.PollInterval <= 0 {
+		c.PollInterval = 2 * time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 10
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 8
+	}
+	if c.BaseBackoff <= 0 {
+		c.BaseBackoff = 30 * time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = time.Hour
+	}
+	if c.Lease <= 0 {
+		c.Lease = 10 * time.Minute
+	}
+}
+
+// Dispatcher delivers the notifications recorded in the outbox. Any number
+// of dispatchers can share one outbox.
+type Dispatcher struct {
+	outbox       repository.OutboxRepository
+	appointments repository.AppointmentRepository
+	notifier     notify.Notifier
+	loc          *time.Location
+	cfg          DispatcherConfig
+	now          func() time.Time
+}
+
+func NewDispatcher(repos *repository.Registry, notifier notify.Notifier, loc *time.Location, cfg DispatcherConfig) *Dispatcher {
+	cfg.setDefaults()
+	return &Dispatcher{
+		outbox:       repos.Outbox,
+		appointments: repos.Appointment,
+		notifier:     notifier,
+		loc:          loc,
+		cfg:          cfg,
+		now:          func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run polls the outbox until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "outbox dispatcher started", "poll_interval", d.cfg.PollInterval)
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DispatchDue(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "outbox dispatch failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("outbox dispatcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchDue delivers one batch of due events and returns how many it
+// handled, successfully or not. An event whose outcome cannot be recorded
+// is logged and left to be claimed again once its lease runs out; the rest
+// of the batch still goes out.
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	now := d.now()
+	events, err := d.outbox.ClaimDue(ctx, now, now.Add(d.cfg.Lease), d.cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	handled := 0
+	for _, e := range events {
+		if err := d.dispatch(ctx, e); err != nil {
+			slog.ErrorContext(ctx, "could not record outbox event outcome", "event_id", e.ID, "error", err)
+			continue
+		}
+		handled++
+	}
+	return handled, nil
+}
+
+// errPermanent marks failures that retrying cannot fix.
+var errPermanent = errors.New("permanent failure")
+
+func (d *Dispatcher) dispatch(ctx context.Context, e model.OutboxEvent) error {
+	ctx = logging.WithRequestID(ctx, eventRequestID(e))
+	logger := slog.With("event_id", e.ID, "kind", e.Kind)
+	err := d.deliver(ctx, e)
+	now := d.now()
+	if err == nil {
+		logger.InfoContext(ctx, "notification sent")
+		return d.outbox.MarkSent(ctx, e.ID, now)
+	}
+
+	attempts := e.Attempts + 1
+	dead := attempts >= d.cfg.MaxAttempts || errors.Is(err, errPermanent)
+	if dead {
+		logger.ErrorContext(ctx, "notification is dead", "attempts", attempts, "error", err)
+	} else {
+		logger.WarnContext(ctx, "notification failed, will retry", "attempts", attempts, "error", err)
+	}
+	return d.outbox.Fail(ctx, e.ID, err.Error(), now.Add(d.backoff(attempts)), dead)
+}
+
+// eventRequestID is the request that queued e, so that its delivery is
+// logged under the same ID. Payloads it cannot read have none.
+func eventRequestID(e model.OutboxEvent) string {
+	var payload model.AppointmentEvent
+	if json.Unmarshal(e.Payload, &payload) != nil {
+		return ""
+	}
+	return payload.RequestID
+}
+
+// backoff is the wait after the given number of failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.cfg.BaseBackoff
+	for i := 1; i < attempts && wait < d.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, d.cfg.MaxBackoff)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, e model.OutboxEvent) error {
+	switch e.Kind {
+	case model.EventAppointmentBooked, model.EventAppointmentRescheduled, model.EventAppointmentReminder:
+	default:
+		return fmt.Errorf("%w: unknown event kind %q", errPermanent, e.Kind)
+	}
+
+	var payload model.AppointmentEvent
+	if err := json.Unmarshal(e.Payload, &payload); err != nil {
+		return fmt.Errorf("%w: bad payload: %v", errPermanent, err)
+	}
+	app, err := d.appointments.GetByID(ctx, payload.AppointmentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("%w: appointment %d not found", errPermanent, payload.AppointmentID)
+	}
+	if err != nil {
+		return err
+	}
+	// Nobody needs to hear about an appointment that no longer takes place.
+	if app.Status == model.StatusCancelled {
+		return nil
+	}
+
+	var mail model.Email
+	if e.Kind == model.EventAppointmentReminder {
+		// A reminder for a slot the appointment has since left is stale; the
+		// scheduler queues a new one for the new time.
+		if app.Status != model.StatusScheduled || !app.Time.Equal(payload.Time) {
+			return nil
+		}
+		mail = ReminderEmail(*app, d.loc)
+	} else {
+		app.Time = payload.Time
+		app.PreviousTime = payload.PreviousTime
+		mail = AppointmentEmail(*app, d.loc)
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return d.notifier.Send(sendCtx, mail)
+}
@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"clinic-cli/internal/logging"
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNotifier struct {
+	fail       bool
+	sent       []model.Email
+	requestIDs []string
+}
+
+func (n *fakeNotifier) Send(ctx context.Context, e model.Email) error {
+	if n.fail {
+		return errors.New("mail server down")
+	}
+	n.sent = append(n.sent, e)
+	n.requestIDs = append(n.requestIDs, logging.RequestID(ctx))
+	return nil
+}
+
+func TestDispatcher_RetriesThenDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRegistry()
+	patient, err := repos.User.Create(ctx, "pat@example.com", "hash", model.RolePatient)
+	require.NoError(t, err)
+	doctor, err := repos.Doctor.Create(ctx, "Dr. Grey", "Surgery")
+	require.NoError(t, err)
+	_, err = repos.Appointment.Create(ctx, patient.ID, doctor.ID, time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	notifier := &fakeNotifier{fail: true}
+	d := NewDispatcher(repos, notifier, time.UTC, DispatcherConfig{MaxAttempts: 2, BaseBackoff: time.Minute})
+	now := time.Now().UTC()
+	d.now = func() time.Time { return now }
+
+	n, err := d.DispatchDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// The retry waits for the backoff to pass.
+	n, err = d.DispatchDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	now = now.Add(2 * time.Minute)
+	_, err = d.DispatchDue(ctx)
+	require.NoError(t, err)
+	dead, err := repos.Outbox.List(ctx, model.OutboxDead, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 2, dead[0].Attempts)
+	assert.Equal(t, "mail server down", dead[0].LastError)
+
+	notifier.fail = false
+	replayed, err := repos.Outbox.Replay(ctx, dead[0].ID, now)
+	require.NoError(t, err)
+	require.True(t, replayed)
+	_, err = d.DispatchDue(ctx)
+	require.NoError(t, err)
+	require.Len(t, notifier.sent, 1)
+	assert.Equal(t, "pat@example.com", notifier.sent[0].To)
+
+	event, err := repos.Outbox.Get(ctx, dead[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.OutboxSent, event.Status)
+}
+
+// failingOutbox cannot record that the event failID was sent.
+type failingOutbox struct {
+	repository.OutboxRepository
+	failID int
+}
+
+func (o *failingOutbox) MarkSent(ctx context.Context, id int, at time.Time) error {
+	if id == o.failID {
+		return errors.New("database is locked")
+	}
+	return o.OutboxRepository.MarkSent(ctx, id, at)
+}
+
+func TestDispatcher_ContinuesAfterRecordError(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRegistry()
+	patient, err := repos.User.Create(ctx, "pat@example.com", "hash", model.RolePatient)
+	require.NoError(t, err)
+	doctor, err := repos.Doctor.Create(ctx, "Dr. Grey", "Surgery")
+	require.NoError(t, err)
+	for _, day := range []int{7, 8} {
+		_, err = repos.Appointment.Create(ctx, patient.ID, doctor.ID, time.Date(2030, 1, day, 9, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+	}
+	pending, err := repos.Outbox.List(ctx, model.OutboxPending, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	repos.Outbox = &failingOutbox{OutboxRepository: repos.Outbox, failID: pending[0].ID}
+
+	notifier := &fakeNotifier{}
+	d := NewDispatcher(repos, notifier, time.UTC, DispatcherConfig{})
+	n, err := d.DispatchDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Len(t, notifier.sent, 2)
+
+	event, err := repos.Outbox.Get(ctx, pending[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.OutboxSent, event.Status)
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := NewDispatcher(repository.NewMemoryRegistry(), &fakeNotifier{}, time.UTC, DispatcherConfig{BaseBackoff: time.Minute, MaxBackoff: 10 * time.Minute})
+	assert.Equal(t, time.Minute, d.backoff(1))
+	assert.Equal(t, 4*time.Minute, d.backoff(3))
+	assert.Equal(t, 10*time.Minute, d.backoff(8))
+}
+
+func TestDispatcher_KeepsRequestID(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRegistry()
+	patient, err := repos.User.Create(ctx, "pat@example.com", "hash", model.RolePatient)
+	require.NoError(t, err)
+	doctor, err := repos.Doctor.Create(ctx, "Dr. Grey", "Surgery")
+	require.NoError(t, err)
+	_, err = repos.Appointment.Create(logging.WithRequestID(ctx, "req-42"), patient.ID, doctor.ID, time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	notifier := &fakeNotifier{}
+	_, err = NewDispatcher(repos, notifier, time.UTC, DispatcherConfig{}).DispatchDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"req-42"}, notifier.requestIDs, "the booking's request ID reaches the notification")
+}
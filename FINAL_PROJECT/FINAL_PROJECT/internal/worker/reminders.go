@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"clinic-cli/internal/repository"
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// DefaultReminderOffsets remind patients a day and two hours ahead.
+var DefaultReminderOffsets = []time.Duration{24 * time.Hour, 2 * time.Hour}
+
+type ReminderConfig struct {
+	// Offsets before the appointment at which a reminder is sent.
+	Offsets      []time.Duration
+	PollInterval time.Duration
+	BatchSize    int
+}
+
+// ReminderScheduler queues reminders for upcoming appointments into the
+// outbox, from where the Dispatcher delivers them. Which reminders have been
+// queued is stored with the appointment, so restarts and concurrent
+// schedulers never queue one twice.
+type ReminderScheduler struct {
+	reminders repository.ReminderRepository
+	offsets   []time.Duration
+	cfg       ReminderConfig
+	now       func() time.Time
+}
+
+func NewReminderScheduler(repos *repository.Registry, cfg ReminderConfig) *ReminderScheduler {
+	if cfg.Offsets == nil {
+		cfg.Offsets = DefaultReminderOffsets
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Minute
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	// Longest first, so each offset owns the window down to the next one.
+	offsets := append([]time.Duration(nil), cfg.Offsets...)
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+	return &ReminderScheduler{
+		reminders: repos.Reminder,
+		offsets:   offsets,
+		cfg:       cfg,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run queues due reminders until ctx is cancelled.
+func (s *ReminderScheduler) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "reminder scheduler started", "offsets", s.offsets)
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.QueueDue(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "queueing reminders failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("reminder scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// QueueDue queues every reminder that is due and returns how many it
+// queued. An appointment is only reminded at the shortest offset it is
+// already within: one booked an hour ahead gets the two-hour reminder but
+// not the one-day reminder.
+func (s *ReminderScheduler) QueueDue(ctx context.Context) (int, error) {
+	now := s.now()
+	queued := 0
+	for i, offset := range s.offsets {
+		from := now
+		if i+1 < len(s.offsets) {
+			from = now.Add(s.offsets[i+1])
+		}
+		for {
+			apps, err := s.reminders.Due(ctx, offset, from, now.Add(offset), s.cfg.BatchSize)
+			if err != nil {
+				return queued, fmt.Errorf("failed to find due %s reminders: %w", offset, err)
+			}
+			for _, app := range apps {
+				ok, err := s.reminders.Queue(ctx, app, offset, now)
+				if err != nil {
+					return queued, fmt.Errorf("failed to queue reminder for appointment %d: %w", app.ID, err)
+				}
+				if ok {
+					queued++
+				}
+			}
+			if len(apps) < s.cfg.BatchSize {
+				break
+			}
+		}
+	}
+	return queued, nil
+}
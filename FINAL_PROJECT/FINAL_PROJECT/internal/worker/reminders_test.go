@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReminderScheduler_QueuesEachReminderOnce(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRegistry()
+	patient, err := repos.User.Create(ctx, "pat@example.com", "hash", model.RolePatient)
+	require.NoError(t, err)
+	doctor, err := repos.Doctor.Create(ctx, "Dr. Grey", "Surgery")
+	require.NoError(t, err)
+
+	now := time.Date(2030, 1, 7, 8, 0, 0, 0, time.UTC)
+	tomorrow, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, now.Add(20*time.Hour))
+	require.NoError(t, err)
+	soon, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, now.Add(time.Hour))
+	require.NoError(t, err)
+	cancelled, err := repos.Appointment.Create(ctx, patient.ID, doctor.ID, now.Add(90*time.Minute))
+	require.NoError(t, err)
+	_, err = repos.Appointment.Cancel(ctx, cancelled.ID)
+	require.NoError(t, err)
+
+	s := NewReminderScheduler(repos, ReminderConfig{})
+	s.now = func() time.Time { return now }
+
+	n, err := s.QueueDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// Only the shortest offset applies to an appointment booked at short notice.
+	reminders, err := repos.Reminder.ListByAppointment(ctx, soon.ID)
+	require.NoError(t, err)
+	require.Len(t, reminders, 1)
+	assert.Equal(t, 120, reminders[0].OffsetMinutes)
+
+	// A fresh scheduler, as after a restart, has nothing new to queue.
+	restarted := NewReminderScheduler(repos, ReminderConfig{})
+	restarted.now = s.now
+	n, err = restarted.QueueDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	now = now.Add(19 * time.Hour)
+	n, err = s.QueueDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	reminders, err = repos.Reminder.ListByAppointment(ctx, tomorrow.ID)
+	require.NoError(t, err)
+	assert.Len(t, reminders, 2)
+}
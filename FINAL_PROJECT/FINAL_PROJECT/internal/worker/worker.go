@@ -1,23 +1,73 @@
-package worker
-
-import (
-	"clinic-cli/internal/model"
-	"context"
-	"log"
-	"time"
-)
-
-func StartEmailWorker(ctx context.Context, appChan <-chan model.Appointment) {
-	log.Println("Background Email Worker Started...")
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Email Worker shutting down...")
-			return
-		case app := <-appChan:
-			time.Sleep(500 * time.Millisecond)
-			log.Printf("[WORKER] Sending confirmation email for Appointment ID %d (Patient: %d, Doctor: %d)\n",
-				app.ID, app.PatientID, app.DoctorID)
-		}
-	}
-}
+package worker
+
+import (
+	"clinic-cli/internal/model"
+	"clinic-cli/internal/notify"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// StartEmailWorker delivers queued account e-mails through notifier until ctx
+// is cancelled. A message that cannot be delivered is logged and dropped;
+// appointment notifications go through the Dispatcher instead.
+func StartEmailWorker(ctx context.Context, notifier notify.Notifier, mailChan <-chan model.Email) {
+	slog.InfoContext(ctx, "email worker started")
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("email worker stopped")
+			return
+		case mail := <-mailChan:
+			deliver(ctx, notifier, mail)
+		}
+	}
+}
+
+func deliver(ctx context.Context, notifier notify.Notifier, mail model.Email) {
+	sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := notifier.Send(sendCtx, mail); err != nil {
+		slog.ErrorContext(ctx, "email dropped", "subject", mail.Subject, "to", mail.To, "error", err)
+	}
+}
+
+const appointmentLayout = "Monday, 2 January 2006 at 15:04 MST"
+
+// AppointmentEmail is the confirmation for a booked appointment, or the
+// notice that it moved when PreviousTime is set.
+func AppointmentEmail(app model.Appointment, loc *time.Location) model.Email {
+	doctor := doctorName(app)
+
+	if app.PreviousTime != nil {
+		return model.Email{
+			To:      app.PatientEmail,
+			Subject: "Your appointment has been rescheduled",
+			Body: fmt.Sprintf("Your appointment #%d with %s has moved from %s to %s.",
+				app.ID, doctor, app.PreviousTime.In(loc).Format(appointmentLayout), app.Time.In(loc).Format(appointmentLayout)),
+		}
+	}
+	return model.Email{
+		To:      app.PatientEmail,
+		Subject: "Your appointment is confirmed",
+		Body:    fmt.Sprintf("Your appointment #%d with %s is booked for %s.", app.ID, doctor, app.Time.In(loc).Format(appointmentLayout)),
+	}
+}
+
+// ReminderEmail reminds the patient of an upcoming appointment.
+func ReminderEmail(app model.Appointment, loc *time.Location) model.Email {
+	return model.Email{
+		To:      app.PatientEmail,
+		Subject: "Reminder: upcoming appointment",
+		Body: fmt.Sprintf("This is a reminder of your appointment #%d with %s on %s.",
+			app.ID, doctorName(app), app.Time.In(loc).Format(appointmentLayout)),
+	}
+}
+
+func doctorName(app model.Appointment) string {
+	if app.DoctorName == "" {
+		return fmt.Sprintf("doctor #%d", app.DoctorID)
+	}
+	return app.DoctorName
+}
@@ -1,7 +1,7 @@
-package model
-
-type Doctor struct {
-	ID             int64  `json:"id"`
-	Name           string `json:"name"`
-	Specialization string `json:"specialization"`
-}
+package model
+
+type Doctor struct {
+	ID             int64  `json:"id"`
+	Name           string `json:"name"`
+	Specialization string `json:"specialization"`
+}
@@ -1,290 +1,443 @@
-package main
-
-import (
-	"bufio"
-	"clinic-cli/auth"
-	"clinic-cli/core"
-	"clinic-cli/db"
-	"database/sql"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"os"
-	"strings"
-	"syscall"
-
-	_ "github.com/mattn/go-sqlite3"
-	"golang.org/x/term"
-)
-
-func main() {
-	go startHTTPServer()
-	db.InitDB()
-	fmt.Println("Welcome ,please choose")
-
-	scanner := bufio.NewScanner(os.Stdin)
-
-	for {
-		if auth.CurrentUser == nil {
-			showGuestMenu()
-			if !scanner.Scan() {
-				break
-			}
-			choice := strings.TrimSpace(scanner.Text())
-			handleGuestChoice(choice, scanner)
-		} else {
-			showUserMenu()
-			if !scanner.Scan() {
-				break
-			}
-			choice := strings.TrimSpace(scanner.Text())
-			handleUserChoice(choice, scanner)
-		}
-		fmt.Println()
-	}
-}
-
-func showGuestMenu() {
-	fmt.Println("1. Login")
-	fmt.Println("2. Register")
-	fmt.Println("3. Exit")
-	fmt.Print("Enter choice: ")
-}
-
-func showUserMenu() {
-	fmt.Printf("Welcome, %s!\n", auth.CurrentUser.Username)
-	fmt.Println("1. List Doctors")
-	fmt.Println("2. Book Appointment")
-	fmt.Println("3. My Appointments")
-	fmt.Println("4. Logout")
-	fmt.Print("Enter choice: ")
-}
-
-func handleGuestChoice(choice string, scanner *bufio.Scanner) {
-	switch choice {
-	case "1":
-		login(scanner)
-	case "2":
-		register(scanner)
-	case "3":
-		fmt.Println("Goodbye!")
-		os.Exit(0)
-	default:
-		fmt.Println("Invalid choice")
-	}
-}
-
-func handleUserChoice(choice string, scanner *bufio.Scanner) {
-	switch choice {
-	case "1":
-		listDoctors()
-	case "2":
-		bookAppointment(scanner)
-	case "3":
-		listMyAppointments()
-	case "4":
-		auth.Logout()
-		fmt.Println("Logged out successfully.")
-	default:
-		fmt.Println("Invalid choice")
-	}
-}
-
-func login(scanner *bufio.Scanner) {
-	fmt.Print("Username: ")
-	scanner.Scan()
-	username := strings.TrimSpace(scanner.Text())
-
-	fmt.Print("Password: ")
-	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
-	if err != nil {
-		fmt.Println("\nError reading password")
-		return
-	}
-	password := string(bytePassword)
-	fmt.Println()
-
-	err = auth.Login(username, password)
-	if err != nil {
-		fmt.Printf("Login failed: %v\n", err)
-	} else {
-		fmt.Println("Login successful!")
-	}
-}
-
-func register(scanner *bufio.Scanner) {
-	fmt.Print("New Username: ")
-	scanner.Scan()
-	username := strings.TrimSpace(scanner.Text())
-
-	fmt.Print("New Password: ")
-	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
-	if err != nil {
-		fmt.Println("\nError reading password")
-		return
-	}
-	password := string(bytePassword)
-	fmt.Println()
-
-	err = auth.Register(username, password)
-	if err != nil {
-		fmt.Printf("Registration failed: %v\n", err)
-	} else {
-		fmt.Println("Registration successful! You can now login.")
-	}
-}
-
-func listDoctors() {
-	doctors, err := core.ListDoctors()
-	if err != nil {
-		fmt.Printf("Error fetching doctors: %v\n", err)
-		return
-	}
-	fmt.Println("\n--- Available Doctors ---")
-	for _, d := range doctors {
-		fmt.Printf("[%d] %s (%s)\n", d.ID, d.Name, d.Specialization)
-	}
-}
-
-func bookAppointment(scanner *bufio.Scanner) {
-	listDoctors()
-	fmt.Print("\nEnter Doctor ID to book: ")
-	scanner.Scan()
-	var docID int
-	_, err := fmt.Sscan(scanner.Text(), &docID)
-	if err != nil {
-		fmt.Println("Invalid ID")
-		return
-	}
-
-	fmt.Print("Enter Date and Time (e.g., 2023-12-01 14:00): ")
-	scanner.Scan()
-	dateTime := strings.TrimSpace(scanner.Text())
-
-	err = core.BookAppointment(docID, dateTime)
-	if err != nil {
-		fmt.Printf("Booking failed: %v\n", err)
-	} else {
-		fmt.Println("Appointment booked successfully!")
-	}
-}
-
-func getUsersFromDB() ([]string, error) {
-	dbConn, err := sql.Open("sqlite3", "clinic.db")
-	if err != nil {
-		return nil, err
-	}
-	defer dbConn.Close()
-
-	rows, err := dbConn.Query("SELECT username FROM users")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []string
-	for rows.Next() {
-		var username string
-		if err := rows.Scan(&username); err != nil {
-			return nil, err
-		}
-		users = append(users, username)
-	}
-
-	return users, nil
-}
-
-func listMyAppointments() {
-	apps, err := core.ListMyAppointments()
-	if err != nil {
-		fmt.Printf("Error fetching appointments: %v\n", err)
-		return
-	}
-	if len(apps) == 0 {
-		fmt.Println("\nYou have no upcoming appointments.")
-		return
-	}
-
-	fmt.Println("\n--- My Appointments ---")
-	for _, a := range apps {
-		fmt.Printf("- %s with %s (%s)\n", a.DateTime, a.DoctorName, a.Specialization)
-	}
-}
-
-func startHTTPServer() {
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Doctor Appointment API is running"))
-	})
-
-	http.HandleFunc("/appointments", func(w http.ResponseWriter, r *http.Request) {
-		data, err := getAppointmentsDetailed()
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
-		json.NewEncoder(w).Encode(data)
-	})
-
-	http.HandleFunc("/doctors", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`["Dr. Smith", "Dr. Brown"]`))
-	})
-
-	http.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
-		users, err := getUsersFromDB()
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
-		json.NewEncoder(w).Encode(users)
-	})
-
-	http.ListenAndServe(":8080", nil)
-}
-
-type AppointmentResponse struct {
-	ID       int    `json:"id"`
-	User     string `json:"user"`
-	Doctor   string `json:"doctor"`
-	DateTime string `json:"datetime"`
-}
-
-func getAppointmentsDetailed() ([]AppointmentResponse, error) {
-	dbConn, err := sql.Open("sqlite3", "clinic.db")
-	if err != nil {
-		return nil, err
-	}
-	defer dbConn.Close()
-
-	query := `
-	SELECT 
-		a.id,
-		u.username,
-		d.name,
-		a.datetime
-	FROM appointments a
-	JOIN users u ON a.user_id = u.id
-	JOIN doctors d ON a.doctor_id = d.id
-	`
-
-	rows, err := dbConn.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	result := []AppointmentResponse{}
-
-	for rows.Next() {
-		var ap AppointmentResponse
-		if err := rows.Scan(&ap.ID, &ap.User, &ap.Doctor, &ap.DateTime); err != nil {
-			return nil, err
-		}
-		result = append(result, ap)
-	}
-
-	return result, nil
-}
+package main
+
+import (
+	"bufio"
+	"clinic-cli/auth"
+	"clinic-cli/core"
+	"clinic-cli/db"
+	"clinic-cli/internal/service"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/term"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "weak-hashes" {
+		db.InitDB()
+		reportWeakHashes()
+		return
+	}
+	if len(os.Args) > 2 && os.Args[1] == "unlock" {
+		db.InitDB()
+		if err := auth.Unlock(os.Args[2]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Unlocked %s.\n", os.Args[2])
+		return
+	}
+
+	if len(os.Args) > 2 && os.Args[1] == "import-doctors" {
+		db.InitDB()
+		importDoctors(os.Args[2])
+		return
+	}
+
+	go startHTTPServer()
+	db.InitDB()
+	fmt.Println("Welcome ,please choose")
+
+	scanner := bufio.NewScanner(os.Stdin)
+
+	for {
+		if auth.CurrentUser == nil {
+			showGuestMenu()
+			if !scanner.Scan() {
+				break
+			}
+			choice := strings.TrimSpace(scanner.Text())
+			handleGuestChoice(choice, scanner)
+		} else {
+			showUserMenu()
+			if !scanner.Scan() {
+				break
+			}
+			choice := strings.TrimSpace(scanner.Text())
+			handleUserChoice(choice, scanner)
+		}
+		fmt.Println()
+	}
+}
+
+// reportWeakHashes lists the accounts still on the legacy SHA-256 password
+// scheme; each one is upgraded the next time its owner logs in.
+func reportWeakHashes() {
+	users, err := auth.WeakHashUsers()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if len(users) == 0 {
+		fmt.Println("All users have bcrypt password hashes.")
+		return
+	}
+
+	fmt.Printf("%d user(s) still on weak password hashes:\n", len(users))
+	for _, u := range users {
+		fmt.Printf("[%d] %s (%s)\n", u.ID, u.Username, u.HashAlgorithm)
+	}
+}
+
+func importDoctors(path string) {
+	report, err := core.ImportDoctors(path)
+	if errors.Is(err, service.ErrImportRows) {
+		fmt.Printf("Nothing imported, %d row(s) have errors:\n", len(report.Errors))
+		for _, e := range report.Errors {
+			fmt.Printf("  row %d: %s\n", e.Line, e.Message)
+		}
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Imported %d doctor(s): %d created, %d updated.\n", len(report.Rows), report.Created, report.Updated)
+}
+
+func showGuestMenu() {
+	fmt.Println("1. Login")
+	fmt.Println("2. Register")
+	fmt.Println("3. Exit")
+	fmt.Print("Enter choice: ")
+}
+
+func showUserMenu() {
+	fmt.Printf("Welcome, %s!\n", auth.CurrentUser.Username)
+	fmt.Println("1. List Doctors")
+	fmt.Println("2. Book Appointment")
+	fmt.Println("3. My Appointments")
+	fmt.Println("4. Doctor Availability")
+	fmt.Println("5. Reschedule Appointment")
+	fmt.Println("6. Logout")
+	fmt.Print("Enter choice: ")
+}
+
+func handleGuestChoice(choice string, scanner *bufio.Scanner) {
+	switch choice {
+	case "1":
+		login(scanner)
+	case "2":
+		register(scanner)
+	case "3":
+		fmt.Println("Goodbye!")
+		os.Exit(0)
+	default:
+		fmt.Println("Invalid choice")
+	}
+}
+
+func handleUserChoice(choice string, scanner *bufio.Scanner) {
+	switch choice {
+	case "1":
+		listDoctors(scanner)
+	case "2":
+		bookAppointment(scanner)
+	case "3":
+		listMyAppointments()
+	case "4":
+		showAvailability(scanner)
+	case "5":
+		rescheduleAppointment(scanner)
+	case "6":
+		auth.Logout()
+		fmt.Println("Logged out successfully.")
+	default:
+		fmt.Println("Invalid choice")
+	}
+}
+
+func login(scanner *bufio.Scanner) {
+	fmt.Print("Username: ")
+	scanner.Scan()
+	username := strings.TrimSpace(scanner.Text())
+
+	fmt.Print("Password: ")
+	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+	if err != nil {
+		fmt.Println("\nError reading password")
+		return
+	}
+	password := string(bytePassword)
+	fmt.Println()
+
+	err = auth.Login(username, password)
+	if err != nil {
+		fmt.Printf("Login failed: %v\n", err)
+	} else {
+		fmt.Println("Login successful!")
+	}
+}
+
+func register(scanner *bufio.Scanner) {
+	fmt.Print("New Username: ")
+	scanner.Scan()
+	username := strings.TrimSpace(scanner.Text())
+
+	fmt.Print("New Password: ")
+	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+	if err != nil {
+		fmt.Println("\nError reading password")
+		return
+	}
+	password := string(bytePassword)
+	fmt.Println()
+
+	err = auth.Register(username, password)
+	if err != nil {
+		fmt.Printf("Registration failed: %v\n", err)
+	} else {
+		fmt.Println("Registration successful! You can now login.")
+	}
+}
+
+func listDoctors(scanner *bufio.Scanner) {
+	fmt.Print("Filter by name (Enter for all): ")
+	scanner.Scan()
+	filter := strings.TrimSpace(scanner.Text())
+
+	doctors, err := core.SearchDoctors(filter)
+	if err != nil {
+		fmt.Printf("Error fetching doctors: %v\n", err)
+		return
+	}
+	fmt.Println("\n--- Available Doctors ---")
+	switch {
+	case len(doctors) == 0 && filter != "":
+		fmt.Printf("No doctors match %q.\n", filter)
+	case len(doctors) == 0:
+		fmt.Println("No doctors yet. Import some with: go run main.go import-doctors doctors.csv")
+	}
+	for _, d := range doctors {
+		fmt.Printf("[%d] %s (%s)\n", d.ID, d.Name, d.Specialization)
+	}
+}
+
+func bookAppointment(scanner *bufio.Scanner) {
+	listDoctors(scanner)
+	fmt.Print("\nEnter Doctor ID to book: ")
+	scanner.Scan()
+	var docID int
+	_, err := fmt.Sscan(scanner.Text(), &docID)
+	if err != nil {
+		fmt.Println("Invalid ID")
+		return
+	}
+
+	fmt.Print("Enter Date and Time (e.g., 2023-12-01 14:00): ")
+	scanner.Scan()
+	dateTime := strings.TrimSpace(scanner.Text())
+
+	err = core.BookAppointment(docID, dateTime)
+	if err != nil {
+		fmt.Printf("Booking failed: %v\n", err)
+	} else {
+		fmt.Println("Appointment booked successfully!")
+	}
+}
+
+func rescheduleAppointment(scanner *bufio.Scanner) {
+	listMyAppointments()
+	fmt.Print("\nEnter Appointment ID to reschedule: ")
+	scanner.Scan()
+	var appID int
+	_, err := fmt.Sscan(scanner.Text(), &appID)
+	if err != nil {
+		fmt.Println("Invalid ID")
+		return
+	}
+
+	listDoctors(scanner)
+	fmt.Print("\nEnter new Doctor ID (empty to keep the same doctor): ")
+	scanner.Scan()
+	var docID int
+	if input := strings.TrimSpace(scanner.Text()); input != "" {
+		if _, err := fmt.Sscan(input, &docID); err != nil {
+			fmt.Println("Invalid ID")
+			return
+		}
+	}
+
+	fmt.Print("Enter new Date and Time (e.g., 2023-12-01 14:00): ")
+	scanner.Scan()
+	dateTime := strings.TrimSpace(scanner.Text())
+
+	err = core.RescheduleAppointment(appID, docID, dateTime)
+	if err != nil {
+		fmt.Printf("Reschedule failed: %v\n", err)
+	} else {
+		fmt.Println("Appointment rescheduled successfully!")
+	}
+}
+
+func showAvailability(scanner *bufio.Scanner) {
+	listDoctors(scanner)
+	fmt.Print("\nEnter Doctor ID: ")
+	scanner.Scan()
+	var docID int
+	_, err := fmt.Sscan(scanner.Text(), &docID)
+	if err != nil {
+		fmt.Println("Invalid ID")
+		return
+	}
+
+	fmt.Print("Start date (YYYY-MM-DD, empty for today): ")
+	scanner.Scan()
+	from := time.Now()
+	if input := strings.TrimSpace(scanner.Text()); input != "" {
+		from, err = time.ParseInLocation("2006-01-02", input, time.Local)
+		if err != nil {
+			fmt.Println("Invalid date")
+			return
+		}
+	}
+
+	slots, err := core.DoctorAvailability(docID, from, from.AddDate(0, 0, 7))
+	if err != nil {
+		fmt.Printf("Error fetching availability: %v\n", err)
+		return
+	}
+	if len(slots) == 0 {
+		fmt.Println("\nNo free slots in the next 7 days.")
+		return
+	}
+
+	fmt.Println("\n--- Free Slots ---")
+	day := ""
+	for _, s := range slots {
+		if d := s.Start.Format("Mon 2006-01-02"); d != day {
+			day = d
+			fmt.Printf("\n%s:", day)
+		}
+		fmt.Printf(" %s", s.Start.Format("15:04"))
+	}
+	fmt.Println()
+}
+
+func getUsersFromDB() ([]string, error) {
+	dbConn, err := sql.Open("sqlite3", "clinic.db")
+	if err != nil {
+		return nil, err
+	}
+	defer dbConn.Close()
+
+	rows, err := dbConn.Query("SELECT username FROM users")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		users = append(users, username)
+	}
+
+	return users, nil
+}
+
+func listMyAppointments() {
+	apps, err := core.ListMyAppointments()
+	if err != nil {
+		fmt.Printf("Error fetching appointments: %v\n", err)
+		return
+	}
+	if len(apps) == 0 {
+		fmt.Println("\nYou have no upcoming appointments.")
+		return
+	}
+
+	fmt.Println("\n--- My Appointments ---")
+	for _, a := range apps {
+		fmt.Printf("[%d] %s with %s (%s)\n", a.ID, a.DateTime, a.DoctorName, a.Specialization)
+	}
+}
+
+func startHTTPServer() {
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Doctor Appointment API is running"))
+	})
+
+	http.HandleFunc("/appointments", func(w http.ResponseWriter, r *http.Request) {
+		data, err := getAppointmentsDetailed()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		json.NewEncoder(w).Encode(data)
+	})
+
+	http.HandleFunc("/doctors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`["Dr. Smith", "Dr. Brown"]`))
+	})
+
+	http.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		users, err := getUsersFromDB()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		json.NewEncoder(w).Encode(users)
+	})
+
+	http.ListenAndServe(":8080", nil)
+}
+
+type AppointmentResponse struct {
+	ID       int    `json:"id"`
+	User     string `json:"user"`
+	Doctor   string `json:"doctor"`
+	DateTime string `json:"datetime"`
+}
+
+func getAppointmentsDetailed() ([]AppointmentResponse, error) {
+	dbConn, err := sql.Open("sqlite3", "clinic.db")
+	if err != nil {
+		return nil, err
+	}
+	defer dbConn.Close()
+
+	query := `
+	SELECT 
+		a.id,
+		u.username,
+		d.name,
+		a.datetime
+	FROM appointments a
+	JOIN users u ON a.user_id = u.id
+	JOIN doctors d ON a.doctor_id = d.id
+	`
+
+	rows, err := dbConn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []AppointmentResponse{}
+
+	for rows.Next() {
+		var ap AppointmentResponse
+		if err := rows.Scan(&ap.ID, &ap.User, &ap.Doctor, &ap.DateTime); err != nil {
+			return nil, err
+		}
+		result = append(result, ap)
+	}
+
+	return result, nil
+}
@@ -1,22 +1,25 @@
-package models
-
-import "time"
-
-type User struct {
-	ID           int
-	Username     string
-	PasswordHash string
-}
-
-type Doctor struct {
-	ID             int
-	Name           string
-	Specialization string
-}
-type Appointment struct {
-	ID        int
-	UserID    int
-	DoctorID  int
-	DateTime  string
-	CreatedAt time.Time
-}
+package models
+
+import "time"
+
+type User struct {
+	ID           int
+	Username     string
+	PasswordHash string
+	// HashAlgorithm is auth.AlgoBcrypt, or auth.AlgoSHA256 for accounts
+	// that have not logged in since bcrypt was introduced.
+	HashAlgorithm string
+}
+
+type Doctor struct {
+	ID             int
+	Name           string
+	Specialization string
+}
+type Appointment struct {
+	ID        int
+	UserID    int
+	DoctorID  int
+	DateTime  string
+	CreatedAt time.Time
+}